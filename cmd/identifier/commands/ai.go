@@ -14,15 +14,12 @@ import (
 	"strings"
 
 	"emperror.dev/errors"
-	"github.com/dgraph-io/badger/v4"
-	badgerOptions "github.com/dgraph-io/badger/v4/options"
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/core/api"
 	"github.com/firebase/genkit/go/genkit"
 	oai "github.com/firebase/genkit/go/plugins/compat_oai"
 	"github.com/firebase/genkit/go/plugins/compat_oai/openai"
 	"github.com/firebase/genkit/go/plugins/googlegenai"
-	"github.com/je4/utils/v2/pkg/zLogger"
 	"github.com/ocfl-archive/identifier/identifier"
 	"github.com/spf13/cobra"
 	"golang.org/x/exp/maps"
@@ -52,7 +49,9 @@ var aiCmd = &cobra.Command{
 	Use:     "ai",
 	Aliases: []string{},
 	Short:   "retrieves AI descriptions",
-	Long:    `retrieves AI descriptions`,
+	Long: `retrieves AI descriptions
+The folders are described by the files of the database. With --where only the matching files are selected.
+` + whereHelp,
 	Example: ``,
 	Args:    cobra.NoArgs,
 	Run:     doAi,
@@ -60,35 +59,30 @@ var aiCmd = &cobra.Command{
 
 var dbFolderAIFlag string
 var prefixAIFlag string
-var csvAIFlag string
-var jsonlAIFlag string
-var xlsxAIFlag string
-var consoleAIFlag bool
+var aiOutputFlags = &outputFlags{}
 var modelAIFlag string
 var apikeyAIFlag string
 var aiQuery string
 var aiAdditionalQuery string
 var aiResultFolder int64
 var aiMaxFiles int64
+var sourceAIFlag string
+var whereAIFlag string
 
 func aiInit() {
-	aiCmd.Flags().StringVar(&dbFolderAIFlag, "database", "", "folder for database (must already exist)")
+	aiCmd.Flags().StringVar(&dbFolderAIFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
 	aiCmd.Flags().StringVar(&prefixAIFlag, "prefix", "", "folder path prefix")
-	aiCmd.Flags().StringVar(&csvAIFlag, "csv", "", "write ai to csv file")
-	aiCmd.Flags().StringVar(&jsonlAIFlag, "jsonl", "", "write ai to jsonl file")
-	aiCmd.Flags().StringVar(&xlsxAIFlag, "xlsx", "", "write ai to xlsx file (needs memory)")
-	aiCmd.Flags().BoolVar(&consoleAIFlag, "console", false, "write ai to console")
+	addOutputFlags(aiCmd, aiOutputFlags, "ai descriptions")
 	aiCmd.Flags().StringVar(&modelAIFlag, "model", "googleai/gemini-2.5-flash", "model for ai")
 	aiCmd.Flags().StringVar(&apikeyAIFlag, "apikey", "%%GEMINI_API_KEY%%", "apikey for ai")
 	aiCmd.Flags().StringVar(&aiQuery, "query", "", "query for ai")
 	aiCmd.Flags().Int64Var(&aiResultFolder, "result-folder", 50, "folder number for result, if 0, all folders are used")
 	aiCmd.Flags().Int64Var(&aiMaxFiles, "max-files", 8, "maximum number of files per folder")
 	aiCmd.Flags().StringVar(&aiAdditionalQuery, "additional-query", "", "additional query for ai, will be prepended to the main query")
+	aiCmd.Flags().StringVar(&sourceAIFlag, "source", "", "source to be described (required, if the database contains several sources)")
+	aiCmd.Flags().StringVar(&whereAIFlag, "where", "", "select files by filter expression (i.e. 'path ~ \"^payload/\"')")
 	aiCmd.MarkFlagDirname("database")
 	aiCmd.MarkFlagRequired("database")
-	aiCmd.MarkFlagFilename("jsonl", "jsonl", "json")
-	aiCmd.MarkFlagFilename("csv", "csv")
-	aiCmd.MarkFlagFilename("xlsx", "xlsx")
 
 	aiRoCrateInit()
 	aiCmd.AddCommand(aiRoCrateCmd)
@@ -101,6 +95,7 @@ var envRegexp = regexp.MustCompile(`%%([A-Z0-9_]+)%%`)
 var regexpJSON = regexp.MustCompile(`(?s)^[^{\[]*([{\[].*[}\]])[^}\]]*$`)
 
 var fieldsAI = []string{"folder", "title", "description", "place", "date", "tags", "persons", "institutions"}
+var typesAI = identifier.FieldTypes{"tags": identifier.FieldList, "persons": identifier.FieldList, "institutions": identifier.FieldList}
 
 func addUnique[S interface{ ~[]E }, E cmp.Ordered](x S, target E) S {
 	pos, found := slices.BinarySearch(x, target)
@@ -210,10 +205,9 @@ Sprache ist Englisch und der Duktus wissenschaftlich. Achte darauf, dass das JSO
 		genkit.WithDefaultModel(modelAIFlag),
 	)
 
-	var badgerDB *badger.DB
+	var store identifier.Store
 
-	output, err := identifier.NewOutput(consoleAIFlag || (csvAIFlag == "" && jsonlAIFlag == "" && xlsxAIFlag == ""),
-		csvAIFlag, jsonlAIFlag, xlsxAIFlag, "ai", fieldsAI, logger)
+	output, err := aiOutputFlags.output("ai", fieldsAI, typesAI)
 	if err != nil {
 		logger.Error().Err(err).Msg("cannot create output")
 		defer os.Exit(1)
@@ -225,12 +219,32 @@ Sprache ist Englisch und der Duktus wissenschaftlich. Achte darauf, dass das JSO
 		}
 	}()
 
-	if badgerDB, err = badger.Open(badger.DefaultOptions(dbFolderAIFlag).WithCompression(badgerOptions.Snappy).WithLogger(zLogger.NewZWrapper(logger))); err != nil {
-		logger.Error().Err(err).Msgf("cannot open badger database in '%s'", dbFolderFlag)
+	where, err := identifier.ParseWhere(whereAIFlag)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot parse filter expression")
+		defer os.Exit(1)
+		return
+	}
+
+	if store, err = identifier.OpenStore(dbFolderAIFlag, false, logger); err != nil {
+		logger.Error().Err(err).Msgf("cannot open database '%s'", dbFolderAIFlag)
+		defer os.Exit(1)
+		return
+	}
+	defer store.Close()
+
+	sources, err := identifier.LoadSources(store)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load sources")
+		defer os.Exit(1)
+		return
+	}
+	source, err := singleSource(sources, sourceAIFlag, "")
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot select source")
 		defer os.Exit(1)
 		return
 	}
-	defer badgerDB.Close()
 
 	flow := genkit.DefineFlow(g, "identifier", func(ctx context.Context, input []*folderT) (*resultList, error) {
 		inputBytes, err := json.Marshal(input)
@@ -259,52 +273,43 @@ Sprache ist Englisch und der Duktus wissenschaftlich. Achte darauf, dass das JSO
 		return resultData, nil
 	})
 
-	var prefix = "file:" + prefixAIFlag
+	var prefix = string(identifier.FileKey(source.ID, prefixAIFlag))
 	// input := fileList{}
 	// folderList0 := []string{}
 	folderList := map[string]*folderT{}
-	if err := badgerDB.View(func(txn *badger.Txn) error {
-		options := badger.DefaultIteratorOptions
-		options.PrefetchValues = true
-		options.Prefix = []byte(prefix)
-		it := txn.NewIterator(options)
-		defer it.Close()
-		for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
-			item := it.Item()
-			k := item.Key()
-			if err := item.Value(func(val []byte) error {
-				fData := &identifier.FileData{}
-				if err := json.Unmarshal(val, fData); err != nil {
-					return errors.Wrapf(err, "cannot unmarshal file data from key '%s'", k)
-				}
-				if fData.Indexer == nil {
-					logger.Error().Msgf("no indexer data for '%s'", fData.Path)
-					return nil
-				}
-				fData.Indexer.Metadata = map[string]any{}
-				fData.Path = ""
-				fData.LastSeen = 0
-				fData.LastMod = 0
-				fData.Folder = filepath.ToSlash(fData.Folder)
-				addFolderFileUnique(folderList, fData.Folder, fData)
-
-				parts := strings.Split(fData.Folder, "/")
-				folder := ""
-				for _, part := range parts {
-					newFolder := path.Join(folder, part)
-					addFolderFolderUnique(folderList, folder, part)
-					//folderList0 = addUnique(folderList0, newFolder)
-					folder = newFolder
-				}
-
+	if err := store.View(func(txn identifier.Txn) error {
+		return txn.Iterate([]byte(prefix), func(k, val []byte) error {
+			fData := &identifier.FileData{}
+			if err := json.Unmarshal(val, fData); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal file data from key '%s'", k)
+			}
+			if fData.Indexer == nil {
+				logger.Error().Msgf("no indexer data for '%s'", fData.Path)
 				return nil
-			}); err != nil {
-				return errors.WithStack(err)
 			}
-		}
-		return nil
+			if !where.Match(fData) {
+				return nil
+			}
+			fData.Indexer.Metadata = map[string]any{}
+			fData.Path = ""
+			fData.LastSeen = 0
+			fData.LastMod = 0
+			fData.Folder = filepath.ToSlash(fData.Folder)
+			addFolderFileUnique(folderList, fData.Folder, fData)
+
+			parts := strings.Split(fData.Folder, "/")
+			folder := ""
+			for _, part := range parts {
+				newFolder := path.Join(folder, part)
+				addFolderFolderUnique(folderList, folder, part)
+				//folderList0 = addUnique(folderList0, newFolder)
+				folder = newFolder
+			}
+
+			return nil
+		})
 	}); err != nil {
-		logger.Error().Err(err).Msgf("cannot iterate over badger database with prefix '%s'", prefixAIFlag)
+		logger.Error().Err(err).Msgf("cannot iterate over database with prefix '%s'", prefixAIFlag)
 		defer os.Exit(1)
 		return
 	}
@@ -330,32 +335,24 @@ Sprache ist Englisch und der Duktus wissenschaftlich. Achte darauf, dass das JSO
 			defer os.Exit(1)
 			return
 		}
-		if err := badgerDB.Update(func(txn *badger.Txn) error {
+		if err := store.Update(func(txn identifier.Txn) error {
 			for _, r := range *out {
 				data, err := json.Marshal(r)
 				if err != nil {
 					return errors.Wrapf(err, "cannot marshal result for '%s'", r.Folder)
 				}
-				if err := txn.Set([]byte(fmt.Sprintf("ai:%s:%s", modelAIFlag, r.Folder)), data); err != nil {
+				if err := txn.Set([]byte(fmt.Sprintf("ai:%s:%s:%s", source.ID, modelAIFlag, r.Folder)), data); err != nil {
 					return errors.Wrapf(err, "cannot write result for '%s'", r.Folder)
 				}
-				persons := ""
-				for _, p := range r.Persons {
-					if p.Name != "" {
-						persons += p.Name
-					}
-					if p.Role != "" {
-						persons += " (" + p.Role + ")"
-					}
-					persons += " -- "
+				var persons []string
+				for _, person := range r.Persons {
+					persons = append(persons, person.String())
 				}
-				persons = strings.TrimSuffix(persons, " -- ")
-				institutions := strings.Join(r.Institutions, " -- ")
-				output.Write([]any{r.Folder, r.Title, r.Description, r.Place, r.Date, strings.Join(r.Tags, ";"), persons, institutions}, r)
+				output.Write([]any{r.Folder, r.Title, r.Description, r.Place, r.Date, r.Tags, persons, r.Institutions}, r)
 			}
 			return nil
 		}); err != nil {
-			logger.Error().Err(err).Msg("cannot write result to badger")
+			logger.Error().Err(err).Msg("cannot write result to database")
 		}
 	}
 
@@ -3,6 +3,7 @@ package commands
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"emperror.dev/errors"
@@ -10,14 +11,13 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var csvAiListFlag string
-var jsonlAiListFlag string
-var xlsxAiListFlag string
+var aiListOutputFlags = &outputFlags{}
 var dbFolderAiListFlag string
 var prefixAiListFlag string
-var consoleAiListFlag bool
+var sourceAiListFlag string
 
 var fieldsAiList = []string{"key", "folder", "title", "description", "place", "date", "tags", "persons", "institutions"}
+var typesAiList = identifier.FieldTypes{"tags": identifier.FieldList, "persons": identifier.FieldList, "institutions": identifier.FieldList}
 
 var aiListCmd = &cobra.Command{
 	Use:     "list",
@@ -30,12 +30,10 @@ var aiListCmd = &cobra.Command{
 }
 
 func aiListInit() {
-	aiListCmd.Flags().StringVar(&dbFolderAiListFlag, "database", "", "folder for database (must already exist)")
-	aiListCmd.Flags().StringVar(&csvAiListFlag, "csv", "", "write aiList to csv file")
-	aiListCmd.Flags().StringVar(&jsonlAiListFlag, "jsonl", "", "write aiList to jsonl file")
-	aiListCmd.Flags().StringVar(&xlsxAiListFlag, "xlsx", "", "write aiList to xlsx file (needs memory)")
+	aiListCmd.Flags().StringVar(&dbFolderAiListFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	addOutputFlags(aiListCmd, aiListOutputFlags, "ai descriptions")
 	aiListCmd.Flags().StringVar(&prefixAiListFlag, "prefix", "", "folder path prefix")
-	aiListCmd.Flags().BoolVar(&consoleAiListFlag, "console", false, "write ai to console")
+	aiListCmd.Flags().StringVar(&sourceAiListFlag, "source", "", "list only descriptions of this source")
 	aiListCmd.MarkFlagRequired("database")
 }
 
@@ -43,25 +41,13 @@ func doaiList(cmd *cobra.Command, args []string) {
 	var dataPath string
 	var err error
 	if len(args) > 0 {
-		dataPath, err = identifier.Fullpath(args[0])
-		cobra.CheckErr(err)
-		if fi, err := os.Stat(dataPath); err != nil || !fi.IsDir() {
-			cobra.CheckErr(errors.Errorf("'%s' is not a directory", dataPath))
-		}
+		dataPath = dataLocation(args[0])
 	}
 
 	if prefixAiListFlag != "" {
-		fmt.Printf("#including prefix \"%s\"\n", prefixAiListFlag)
+		fmt.Fprintf(aiListOutputFlags.info(), "#including prefix \"%s\"\n", prefixAiListFlag)
 	}
-	output, err := identifier.NewOutput(
-		consoleAiListFlag || (csvAiListFlag == "" && jsonlAiListFlag == "" && xlsxAiListFlag == ""),
-		csvAiListFlag,
-		jsonlAiListFlag,
-		xlsxAiListFlag,
-		"list",
-		fieldsAiList,
-		logger,
-	)
+	output, err := aiListOutputFlags.output("list", fieldsAiList, typesAiList)
 	if err != nil {
 		logger.Error().Err(err).Msg("cannot create output")
 		defer os.Exit(1)
@@ -73,19 +59,39 @@ func doaiList(cmd *cobra.Command, args []string) {
 		}
 	}()
 
-	badgerIterator, err := identifier.NewBadgerIterator(dbFolderAiListFlag, true, logger)
+	storeIterator, err := identifier.NewStoreIterator(dbFolderAiListFlag, true, logger)
 	if err != nil {
-		logger.Error().Err(err).Msg("cannot create badger reader")
+		logger.Error().Err(err).Msg("cannot open database")
 		defer os.Exit(1)
 		return
 	}
 	defer func() {
-		if err := badgerIterator.Close(); err != nil {
-			logger.Error().Err(err).Msg("cannot close badger reader")
+		if err := storeIterator.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
 		}
 	}()
 
-	if err := badgerIterator.IterateAI("ai:"+prefixAiListFlag, func(key string, aiData *identifier.AIResultStruct) (remove bool, err error) {
+	sources, err := storeIterator.Sources()
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load sources")
+		defer os.Exit(1)
+		return
+	}
+	source, err := selectSource(sources, sourceAiListFlag, dataPath)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot select source")
+		defer os.Exit(1)
+		return
+	}
+	var prefix = "ai:"
+	if source != nil {
+		prefix += source.ID + ":"
+	}
+
+	if err := storeIterator.IterateAI(prefix, func(key string, aiData *identifier.AIResultStruct) (remove bool, err error) {
+		if !strings.HasPrefix(filepath.ToSlash(aiData.Folder), prefixAiListFlag) {
+			return false, nil
+		}
 		var persons []string
 		for _, person := range aiData.Persons {
 			persons = append(persons, person.String())
@@ -97,16 +103,16 @@ func doaiList(cmd *cobra.Command, args []string) {
 			aiData.Description,
 			aiData.Place,
 			aiData.Date,
-			strings.Join(aiData.Tags, "; "),
-			strings.Join(persons, "; "),
-			strings.Join(aiData.Institutions, "; "),
+			aiData.Tags,
+			persons,
+			aiData.Institutions,
 		},
 			aiData); err != nil {
 			return false, errors.Wrapf(err, "cannot write output")
 		}
 		return false, nil
 	}); err != nil {
-		logger.Error().Err(err).Msg("cannot iterate badger")
+		logger.Error().Err(err).Msg("cannot iterate database")
 	}
 	return
 }
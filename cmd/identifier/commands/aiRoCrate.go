@@ -9,9 +9,6 @@ import (
 	"strings"
 
 	"emperror.dev/errors"
-	"github.com/dgraph-io/badger/v4"
-	badgerOptions "github.com/dgraph-io/badger/v4/options"
-	"github.com/je4/utils/v2/pkg/zLogger"
 	"github.com/ocfl-archive/identifier/identifier"
 	"github.com/spf13/cobra"
 	"golang.org/x/exp/slices"
@@ -49,11 +46,15 @@ var aiRoCrateCmd = &cobra.Command{
 var dbFolderAIRoCrateFlag string
 var prefixAIRoCrateFlag string
 var modelAIRoCrateFlag string
+var sourceAIRoCrateFlag string
+var aiRoCrateOutputFlags = &outputFlags{}
 
 func aiRoCrateInit() {
-	aiRoCrateCmd.Flags().StringVar(&dbFolderAIRoCrateFlag, "database", "", "folder for database (must already exist)")
+	aiRoCrateCmd.Flags().StringVar(&dbFolderAIRoCrateFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
 	aiRoCrateCmd.Flags().StringVar(&prefixAIRoCrateFlag, "prefix", "", "folder path prefix")
 	aiRoCrateCmd.Flags().StringVar(&modelAIRoCrateFlag, "model", "google-gemini-2.0-pro-exp-02-05", "model for aiRoCrate")
+	aiRoCrateCmd.Flags().StringVar(&sourceAIRoCrateFlag, "source", "", "source of the descriptions (default: source located at path to data)")
+	addOutputFlags(aiRoCrateCmd, aiRoCrateOutputFlags, "ai descriptions")
 	aiRoCrateCmd.MarkFlagDirname("database")
 	aiRoCrateCmd.MarkFlagRequired("database")
 	aiRoCrateCmd.MarkFlagDirname("prefix")
@@ -74,16 +75,12 @@ func doAIRoCrate(cmd *cobra.Command, args []string) {
 	var dataPath string
 	var err error
 	if len(args) > 0 {
-		dataPath, err = identifier.Fullpath(args[0])
-		cobra.CheckErr(err)
-		if fi, err := os.Stat(dataPath); err != nil || !fi.IsDir() {
-			cobra.CheckErr(errors.Errorf("'%s' is not a directory", dataPath))
-		}
+		dataPath = dataLocation(args[0])
 	}
 
-	var badgerDB *badger.DB
+	var store identifier.Store
 
-	output, err := identifier.NewOutput(consoleIndexListFlag || (csvIndexListFlag == "" && jsonlIndexListFlag == "" && xlsxIndexListFlag == ""), csvIndexListFlag, jsonlIndexListFlag, xlsxIndexListFlag, "aiRoCrate", fieldsAIRoCrate, logger)
+	output, err := aiRoCrateOutputFlags.output("aiRoCrate", fieldsAIRoCrate, nil)
 	if err != nil {
 		logger.Error().Err(err).Msg("cannot create output")
 		defer os.Exit(1)
@@ -95,13 +92,31 @@ func doAIRoCrate(cmd *cobra.Command, args []string) {
 		}
 	}()
 
-	if badgerDB, err = badger.Open(badger.DefaultOptions(dbFolderAIRoCrateFlag).WithCompression(badgerOptions.Snappy).WithLogger(zLogger.NewZWrapper(logger))); err != nil {
-		logger.Error().Err(err).Msgf("cannot open badger database in '%s'", dbFolderFlag)
+	if store, err = identifier.OpenStore(dbFolderAIRoCrateFlag, false, logger); err != nil {
+		logger.Error().Err(err).Msgf("cannot open database '%s'", dbFolderAIRoCrateFlag)
+		defer os.Exit(1)
+		return
+	}
+	defer store.Close()
+
+	sources, err := identifier.LoadSources(store)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load sources")
+		defer os.Exit(1)
+		return
+	}
+	source, err := singleSource(sources, sourceAIRoCrateFlag, dataPath)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot select source")
 		defer os.Exit(1)
 		return
 	}
-	defer badgerDB.Close()
 
+	if identifier.IsRemoteLocation(dataPath) {
+		logger.Error().Msgf("cannot write ro-crate to remote location '%s'", dataPath)
+		defer os.Exit(1)
+		return
+	}
 	roCratePath := filepath.Join(dataPath, prefixAIRoCrateFlag, "ro-crate-metadata.json")
 	fi, err := os.Stat(roCratePath)
 	if err != nil {
@@ -136,40 +151,31 @@ func doAIRoCrate(cmd *cobra.Command, args []string) {
 		return
 	}
 	fp.Close()
-	var prefix = fmt.Sprintf("ai:%s:%s", modelAIRoCrateFlag, prefixAIRoCrateFlag)
+	var prefix = fmt.Sprintf("ai:%s:%s:%s", source.ID, modelAIRoCrateFlag, prefixAIRoCrateFlag)
 	//var result = []*aiResultStruct{}
-	if err := badgerDB.View(func(txn *badger.Txn) error {
-		options := badger.DefaultIteratorOptions
-		options.PrefetchValues = true
-		options.Prefix = []byte(prefix)
-		it := txn.NewIterator(options)
-		defer it.Close()
+	if err := store.View(func(txn identifier.Txn) error {
 		var folderList = map[string]*identifier.RoCrateGraphElement{}
-		for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
-			item := it.Item()
-			k := item.Key()
-			if err := item.Value(func(val []byte) error {
-				data := &identifier.AIResultStruct{}
-				if err := json.Unmarshal(val, data); err != nil {
-					return errors.Wrapf(err, "cannot unmarshal file data from key '%s'", k)
-				}
-				data.Folder = filepath.ToSlash(data.Folder)
-				logger.Info().Msgf("processing %s", data.Folder)
-				id := strings.Replace(url.PathEscape(strings.TrimSuffix(data.Folder, "/")), "%2F", "/", -1)
-				if elem := roCrate.Get(id); elem != nil {
-					folderList[id] = elem
-				} else {
-					folderList[id] = &identifier.RoCrateGraphElement{
-						ID:          id,
-						Type:        identifier.StringOrList{"Dataset"},
-						Name:        data.Title,
-						Description: data.Description,
-					}
+		if err := txn.Iterate([]byte(prefix), func(k, val []byte) error {
+			data := &identifier.AIResultStruct{}
+			if err := json.Unmarshal(val, data); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal file data from key '%s'", k)
+			}
+			data.Folder = filepath.ToSlash(data.Folder)
+			logger.Info().Msgf("processing %s", data.Folder)
+			id := strings.Replace(url.PathEscape(strings.TrimSuffix(data.Folder, "/")), "%2F", "/", -1)
+			if elem := roCrate.Get(id); elem != nil {
+				folderList[id] = elem
+			} else {
+				folderList[id] = &identifier.RoCrateGraphElement{
+					ID:          id,
+					Type:        identifier.StringOrList{"Dataset"},
+					Name:        data.Title,
+					Description: data.Description,
 				}
-				return nil
-			}); err != nil {
-				return errors.WithStack(err)
 			}
+			return nil
+		}); err != nil {
+			return errors.WithStack(err)
 		}
 		var ids = []string{}
 		for id, _ := range folderList {
@@ -246,7 +252,7 @@ func doAIRoCrate(cmd *cobra.Command, args []string) {
 		}
 		return nil
 	}); err != nil {
-		logger.Error().Err(err).Msgf("cannot iterate over badger database with prefix '%s'", prefixAIRoCrateFlag)
+		logger.Error().Err(err).Msgf("cannot iterate over database with prefix '%s'", prefixAIRoCrateFlag)
 		defer os.Exit(1)
 		return
 	}
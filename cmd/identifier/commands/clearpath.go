@@ -3,7 +3,6 @@ package commands
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"regexp"
 
 	"emperror.dev/errors"
@@ -15,6 +14,7 @@ var clearPathRenameFlag bool
 var clearPathAutoFlag bool
 var clearPathRegexpFlag string
 var clearPathRegexpReplaceFlag string
+var clearPathWalkFilterFlags = &walkFilterFlags{}
 
 var clearPathRegexp *regexp.Regexp
 
@@ -37,6 +37,7 @@ var clearpathCmd = &cobra.Command{
 This function uses the deep-first search algorithm to rename files 
 and folders in the given path to make sure, that there are no conflicts. 
 
+` + walkFilterHelp + locationHelp + `
 
 Caveat: dry-run (no --rename flag) is always recommended before renaming files on filesystem.
 `,
@@ -65,6 +66,7 @@ func clearpathInit() {
 	clearpathCmd.Flags().StringVar(&clearPathRegexpReplaceFlag, "replace", "", "replace characters for regexp")
 	clearpathCmd.MarkFlagsRequiredTogether("regexp", "replace")
 	clearpathCmd.MarkFlagsOneRequired("auto", "regexp")
+	addWalkFilterFlags(clearpathCmd, clearPathWalkFilterFlags)
 }
 
 func doClearpath(cmd *cobra.Command, args []string) {
@@ -79,23 +81,22 @@ func doClearpath(cmd *cobra.Command, args []string) {
 		fmt.Printf("#including regexp \"%s\"\n", clearPathRegexpFlag)
 	}
 
-	dataPath, err := identifier.Fullpath(args[0])
+	dataFS, dataPath, err := openDataLocation(args[0])
 	if err != nil {
-		logger.Error().Err(err).Msgf("cannot get full path for '%s'", args[0])
+		logger.Error().Err(err).Msgf("cannot open '%s'", args[0])
 		defer os.Exit(1)
 		return
 	}
+	defer dataFS.Close()
 	logger.Info().Msgf("data path: '%s'", dataPath)
-	if fi, err := os.Stat(dataPath); err != nil || !fi.IsDir() {
-		cobra.CheckErr(errors.Errorf("'%s' is not a directory", dataPath))
-	}
 
 	if !clearPathRenameFlag {
 		logger.Info().Msg("dry-run: no files will be renamed")
 	}
 	logger.Info().Msgf("working on folder '%s'", dataPath)
-	dirFS := os.DirFS(dataPath)
-	pathElements, err := identifier.BuildPath(dirFS, logger)
+	filter, err := clearPathWalkFilterFlags.walkFilter(dataFS)
+	cobra.CheckErr(err)
+	pathElements, err := identifier.BuildPath(dataFS, filter, logger)
 	cobra.CheckErr(errors.Wrapf(err, "cannot build path '%s'", dataPath))
 
 	for name, newName := range pathElements.ClearIterator(clearPathAutoFlag, clearPathRegexp, clearPathRegexpReplaceFlag) {
@@ -104,11 +105,9 @@ func doClearpath(cmd *cobra.Command, args []string) {
 		}
 		fmt.Printf("    %s\n--> %s\n\n", name, newName)
 		if clearPathRenameFlag {
-			fullpath := filepath.Join(dataPath, name)
-			newpath := filepath.Join(dataPath, newName)
-			logger.Info().Msgf("renaming '%s' to '%s'", fullpath, newpath)
-			if err := os.Rename(fullpath, newpath); err != nil {
-				logger.Error().Err(err).Msgf("cannot rename '%s' to '%s'", fullpath, newpath)
+			logger.Info().Msgf("renaming '%s/%s' to '%s/%s'", dataPath, name, dataPath, newName)
+			if err := dataFS.Rename(name, newName); err != nil {
+				logger.Error().Err(err).Msgf("cannot rename '%s/%s' to '%s/%s'", dataPath, name, dataPath, newName)
 			}
 		}
 	}
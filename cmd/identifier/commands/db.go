@@ -0,0 +1,24 @@
+package commands
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var dbCmd = &cobra.Command{
+	Use:     "db",
+	Aliases: []string{},
+	Short:   "maintenance of index databases",
+	Long: `maintenance of index databases
+The database location is a badger database folder or an sqlite database file (sqlite:///path/to/index.db).
+`,
+	Example: ``,
+	Args:    cobra.NoArgs,
+}
+
+func dbInit() {
+	dbMigrateInit()
+	dbDumpInit()
+	dbRestoreInit()
+	dbMergeInit()
+	dbCmd.AddCommand(dbMigrateCmd, dbDumpCmd, dbRestoreCmd, dbMergeCmd)
+}
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+var dbFolderDbDumpFlag string
+
+var dbDumpCmd = &cobra.Command{
+	Use:     "dump [dump file]",
+	Aliases: []string{},
+	Short:   "write all records of the database to a compressed dump file",
+	Long: `write all records of the database to a compressed dump file
+The dump is a gzip compressed json lines file. The first line is a header with the schema version, the host,
+the database and its sources, every other line contains the key and the value of a record.
+All key spaces are dumped except the secondary indexes, which are created again by 'db restore'.
+Use '-' as dump file to write to stdout.
+`,
+	Example: `dump the database
+
+` + appname + ` db dump c:\temp\index.jsonl.gz --database c:\temp\indexerbadger`,
+	Args: cobra.ExactArgs(1),
+	Run:  dodbDump,
+}
+
+func dbDumpInit() {
+	dbDumpCmd.Flags().StringVar(&dbFolderDbDumpFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	dbDumpCmd.MarkFlagDirname("database")
+	dbDumpCmd.MarkFlagRequired("database")
+}
+
+func dodbDump(cmd *cobra.Command, args []string) {
+	store, err := identifier.OpenStore(dbFolderDbDumpFlag, true, logger)
+	if err != nil {
+		logger.Error().Err(err).Msgf("cannot open database '%s'", dbFolderDbDumpFlag)
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
+		}
+	}()
+
+	var w io.Writer = os.Stdout
+	if args[0] != "-" {
+		fp, err := os.Create(args[0])
+		if err != nil {
+			logger.Error().Err(err).Msgf("cannot create dump file '%s'", args[0])
+			defer os.Exit(1)
+			return
+		}
+		defer fp.Close()
+		w = fp
+	}
+	count, err := identifier.Dump(store, dbFolderDbDumpFlag, w)
+	if err != nil {
+		logger.Error().Err(err).Msgf("cannot dump database '%s'", dbFolderDbDumpFlag)
+		defer os.Exit(1)
+		return
+	}
+	if args[0] != "-" {
+		fmt.Printf("#%d records written to '%s'\n", count, args[0])
+	}
+	return
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/je4/utils/v2/pkg/checksum"
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+)
+
+var dbFolderDbMergeFlag string
+var conflictDbMergeFlag string
+var preferDbMergeFlag string
+var duplicateDigestDbMergeFlag string
+
+var dbMergeCmd = &cobra.Command{
+	Use:     "merge [database]...",
+	Aliases: []string{},
+	Short:   "merge databases into the database",
+	Long: `merge databases into the database
+All records of the given databases are copied into the database (--database), which is created if necessary.
+Records with the same key and different values are conflicts, which are resolved by the conflict rule (--conflict):
+  newest: the record seen last wins (file records by lastseen, errors and fixity checks by time, index runs by update)
+  prefer: the records of the database given by --prefer win, otherwise the record merged first is kept
+  report: the existing record is kept and the conflict is listed
+File records, which differ only in lastseen, are no conflicts, the later one is kept.
+Sources with the same id and location are no conflicts, the earlier creation time is kept.
+Sources with the same id and different locations are refused, because their files would be mixed.
+Index one of the locations with another source id (--source) before merging.
+Afterwards the secondary indexes are rebuilt and the duplicate flags are recomputed.
+`,
+	Example: `merge the databases of two workstations, the newest records win
+
+` + appname + ` db merge sqlite:///c:/temp/ws1.db sqlite:///c:/temp/ws2.db --database sqlite:///c:/temp/index.db
+
+list the conflicts without replacing records
+
+` + appname + ` db merge sqlite:///c:/temp/ws2.db --database sqlite:///c:/temp/index.db --conflict report`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  dodbMerge,
+}
+
+func dbMergeInit() {
+	dbMergeCmd.Flags().StringVar(&dbFolderDbMergeFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	dbMergeCmd.Flags().StringVar(&conflictDbMergeFlag, "conflict", string(identifier.ConflictNewest), "conflict rule (newest, prefer or report)")
+	dbMergeCmd.Flags().StringVar(&preferDbMergeFlag, "prefer", "", "database, which wins conflicts with --conflict prefer (one of the merged databases or --database)")
+	dbMergeCmd.Flags().StringVar(&duplicateDigestDbMergeFlag, "duplicate-digest", "", "checksum algorithm for duplicate detection (default from config)")
+	dbMergeCmd.MarkFlagDirname("database")
+	dbMergeCmd.MarkFlagRequired("database")
+}
+
+func dodbMerge(cmd *cobra.Command, args []string) {
+	rule := identifier.ConflictRule(strings.ToLower(conflictDbMergeFlag))
+	switch rule {
+	case identifier.ConflictNewest, identifier.ConflictReport:
+	case identifier.ConflictPrefer:
+		if preferDbMergeFlag != dbFolderDbMergeFlag && !slices.Contains(args, preferDbMergeFlag) {
+			logger.Error().Msgf("preferred database '%s' is not merged - use one of %v or '%s'", preferDbMergeFlag, args, dbFolderDbMergeFlag)
+			defer os.Exit(1)
+			return
+		}
+	default:
+		logger.Error().Msgf("unknown conflict rule '%s' - use one of %v", conflictDbMergeFlag, identifier.ConflictRules)
+		defer os.Exit(1)
+		return
+	}
+	dupDigest := conf.DuplicateDigest
+	if duplicateDigestDbMergeFlag != "" {
+		dupDigest = checksum.DigestAlgorithm(strings.ToLower(duplicateDigestDbMergeFlag))
+	}
+	if !checksum.HashExists(dupDigest) {
+		logger.Error().Msgf("unknown duplicate digest algorithm '%s' - use one of %v", dupDigest, checksum.DigestNames)
+		defer os.Exit(1)
+		return
+	}
+
+	store, err := identifier.OpenStore(dbFolderDbMergeFlag, false, logger)
+	if err != nil {
+		logger.Error().Err(err).Msgf("cannot open database '%s'", dbFolderDbMergeFlag)
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
+		}
+	}()
+
+	for _, location := range args {
+		from, err := identifier.OpenStore(location, true, logger)
+		if err != nil {
+			logger.Error().Err(err).Msgf("cannot open database '%s'", location)
+			defer os.Exit(1)
+			return
+		}
+		result, err := identifier.MergeStore(store, from, rule, location == preferDbMergeFlag, logger, func(key string, replaced bool) {
+			if rule == identifier.ConflictReport {
+				fmt.Printf("conflict: %s // database: %s\n", key, location)
+			}
+		})
+		if err := from.Close(); err != nil {
+			logger.Error().Err(err).Msgf("cannot close database '%s'", location)
+		}
+		if err != nil {
+			logger.Error().Err(err).Msgf("cannot merge database '%s'", location)
+			defer os.Exit(1)
+			return
+		}
+		fmt.Printf("#%s: %d records, %d added, %d replaced, %d conflicts\n", location, result.Records, result.Added, result.Replaced, result.Conflicts)
+	}
+
+	count, err := identifier.RebuildSecondary(store, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot rebuild secondary indexes")
+		defer os.Exit(1)
+		return
+	}
+	changed, err := identifier.UpdateDuplicates(store, dupDigest, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot update duplicate flags")
+		defer os.Exit(1)
+		return
+	}
+	fmt.Printf("#%d files indexed, duplicate flags of %d files changed\n", count, changed)
+	return
+}
@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+var dbFolderDbMigrateFlag string
+var dryRunDbMigrateFlag bool
+
+var dbMigrateCmd = &cobra.Command{
+	Use:     "migrate",
+	Aliases: []string{},
+	Short:   "upgrade the database to the current schema version",
+	Long: `upgrade the database to the current schema version
+Every database contains a schema record (meta:schema) with its version, which is checked whenever the database is opened.
+Databases of older versions must be migrated before they can be used. The migrations are applied step by step
+and the schema record is updated after every step, so an interrupted migration can be continued.
+The version of databases created before the schema record has been introduced is detected from their content.
+
+Caveat: dry-run (--dry-run) is recommended before migrating large databases, it reports how many records every migration touches.
+`,
+	Example: `show the pending migrations
+
+` + appname + ` db migrate --database c:\temp\indexerbadger --dry-run`,
+	Args: cobra.NoArgs,
+	Run:  dodbMigrate,
+}
+
+func dbMigrateInit() {
+	dbMigrateCmd.Flags().StringVar(&dbFolderDbMigrateFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	dbMigrateCmd.Flags().BoolVar(&dryRunDbMigrateFlag, "dry-run", false, "report the pending migrations without changing the database")
+	dbMigrateCmd.MarkFlagDirname("database")
+	dbMigrateCmd.MarkFlagRequired("database")
+}
+
+func dodbMigrate(cmd *cobra.Command, args []string) {
+	if dryRunDbMigrateFlag {
+		fmt.Println("#dry run")
+	}
+	var steps int
+	schema, err := identifier.MigrateStore(dbFolderDbMigrateFlag, !dryRunDbMigrateFlag, logger, func(schema *identifier.Schema, m *identifier.Migration, count int64) {
+		steps++
+		fmt.Printf("schema version %d -> %d: %s (%d records)\n", m.From, m.To, m.Description, count)
+	})
+	if err != nil {
+		logger.Error().Err(err).Msgf("cannot migrate database '%s'", dbFolderDbMigrateFlag)
+		defer os.Exit(1)
+		return
+	}
+	switch {
+	case steps == 0:
+		fmt.Printf("#database has the current schema version %d\n", schema.Version)
+	case dryRunDbMigrateFlag:
+		fmt.Printf("#%d migrations pending to schema version %d\n", steps, identifier.SchemaVersion)
+	default:
+		fmt.Printf("#database migrated to schema version %d\n", schema.Version)
+	}
+	return
+}
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+var dbFolderDbRestoreFlag string
+
+var dbRestoreCmd = &cobra.Command{
+	Use:     "restore [dump file]",
+	Aliases: []string{},
+	Short:   "restore a dump file into an empty database",
+	Long: `restore a dump file into an empty database
+The records of a dump written by 'db dump' are restored and the secondary indexes are created.
+The database must be empty, use 'db merge' to combine databases.
+Dumps of older schema versions keep their version and must be upgraded with 'db migrate'.
+Use '-' as dump file to read from stdin.
+`,
+	Example: `restore a dump into a new sqlite database
+
+` + appname + ` db restore c:\temp\index.jsonl.gz --database sqlite:///c:/temp/index.db`,
+	Args: cobra.ExactArgs(1),
+	Run:  dodbRestore,
+}
+
+func dbRestoreInit() {
+	dbRestoreCmd.Flags().StringVar(&dbFolderDbRestoreFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	dbRestoreCmd.MarkFlagDirname("database")
+	dbRestoreCmd.MarkFlagRequired("database")
+}
+
+func dodbRestore(cmd *cobra.Command, args []string) {
+	var r io.Reader = os.Stdin
+	if args[0] != "-" {
+		fp, err := os.Open(args[0])
+		if err != nil {
+			logger.Error().Err(err).Msgf("cannot open dump file '%s'", args[0])
+			defer os.Exit(1)
+			return
+		}
+		defer fp.Close()
+		r = fp
+	}
+
+	store, err := identifier.OpenStore(dbFolderDbRestoreFlag, false, logger)
+	if err != nil {
+		logger.Error().Err(err).Msgf("cannot open database '%s'", dbFolderDbRestoreFlag)
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
+		}
+	}()
+
+	header, count, err := identifier.Restore(store, r, logger)
+	if err != nil {
+		logger.Error().Err(err).Msgf("cannot restore '%s'", args[0])
+		defer os.Exit(1)
+		return
+	}
+	fmt.Printf("#%d records of database '%s' (host %s, schema version %d) restored\n", count, header.Database, header.Host, header.Schema)
+	return
+}
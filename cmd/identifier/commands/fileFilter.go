@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/identifier/identifier"
+)
+
+const whereHelp = `Files can be selected with a filter expression (--where), i.e.
+  size > 10MB && pronom in ("fmt/43","fmt/44") && lastmod < 2010-01-01 && path ~ "^payload/"
+Fields: source, path, folder, basename, size, lastmod, lastseen, duplicate, container, etag, mimetype, pronom,
+type, subtype, width, height, duration, fixity, checksum.<digest> and metadata.<path> (i.e. metadata.exif.Make).
+Operators: == != < <= > >= ~ (regular expression) !~ in (...), && || ! and parentheses.
+Values are "strings", numbers with optional unit (10MB, 1.5GiB), dates (2010-01-01, RFC3339) and true/false.
+`
+
+// fileFilter selects file records by the flags --empty, --duplicates, --regexp and --where, which are shared by the index commands
+type fileFilter struct {
+	empty      bool
+	duplicates bool
+	regex      *regexp.Regexp
+	where      *identifier.Where
+}
+
+func newFileFilter(empty, duplicates bool, regexpStr, where string) (*fileFilter, error) {
+	filter := &fileFilter{empty: empty, duplicates: duplicates}
+	var err error
+	if regexpStr != "" {
+		if filter.regex, err = regexp.Compile(regexpStr); err != nil {
+			return nil, errors.Wrapf(err, "cannot compile regular expression '%s'", regexpStr)
+		}
+	}
+	if filter.where, err = identifier.ParseWhere(where); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return filter, nil
+}
+
+// print writes the selection to the console
+func (f *fileFilter) print(w io.Writer) {
+	if f.regex != nil {
+		fmt.Fprintf(w, "#including regexp \"%s\"\n", f.regex.String())
+	}
+	if f.empty {
+		fmt.Fprintln(w, "#including empty files")
+	}
+	if f.duplicates {
+		fmt.Fprintln(w, "#including duplicate files")
+	}
+	if !f.empty && !f.duplicates && f.regex == nil {
+		fmt.Fprintln(w, "#including all files")
+	}
+	if !f.where.Empty() {
+		fmt.Fprintf(w, "#where %s\n", f.where.String())
+	}
+}
+
+// selective checks, whether the filter does not include all files
+func (f *fileFilter) selective() bool {
+	return f.empty || f.duplicates || f.regex != nil || !f.where.Empty()
+}
+
+// match checks, whether the record is selected by the filter
+func (f *fileFilter) match(fData *identifier.FileData) bool {
+	return f.matchFile(fData.Basename, fData.Size, fData.Duplicate) && f.where.Match(fData)
+}
+
+// matchFile checks the flags --empty, --duplicates and --regexp only
+func (f *fileFilter) matchFile(basename string, size int64, duplicate bool) bool {
+	return (f.empty && size == 0) ||
+		(f.duplicates && duplicate) ||
+		(f.regex != nil && f.regex.MatchString(basename)) ||
+		(!f.empty && !f.duplicates && f.regex == nil)
+}
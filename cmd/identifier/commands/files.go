@@ -2,8 +2,6 @@ package commands
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"regexp"
 
 	"emperror.dev/errors"
@@ -13,6 +11,7 @@ import (
 
 var filesRemoveFlag bool
 var filesRegexpFlag string
+var filesWalkFilterFlags = &walkFilterFlags{}
 
 var filesCmd = &cobra.Command{
 	Use:     "files [path to data]",
@@ -21,6 +20,7 @@ var filesCmd = &cobra.Command{
 	Long: `list files based on go regular expression (https://pkg.go.dev/regexp/syntax)
 There is an option to remove the files from filesystem.
 
+` + walkFilterHelp + locationHelp + `
 Caveat: dry-run (no --remove flag) is always recommended before removing files from filesystem.
 `,
 	Example: `find all files with extension '.jpg' and '.gif' and remove them
@@ -48,14 +48,13 @@ func filesInit() {
 	filesCmd.Flags().StringVar(&filesRegexpFlag, "regexp", "", "[required] regular expression to match files")
 	filesCmd.MarkFlagRequired("regexp")
 	filesCmd.Flags().BoolVar(&filesRemoveFlag, "remove", false, "removes (deletes) the files from filesystem (if not set it's just a dry run)")
+	addWalkFilterFlags(filesCmd, filesWalkFilterFlags)
 }
 
 func dofiles(cmd *cobra.Command, args []string) {
-	dataPath, err := identifier.Fullpath(args[0])
+	dataFS, dataPath, err := openDataLocation(args[0])
 	cobra.CheckErr(err)
-	if fi, err := os.Stat(dataPath); err != nil || !fi.IsDir() {
-		cobra.CheckErr(errors.Errorf("'%s' is not a directory", dataPath))
-	}
+	defer dataFS.Close()
 
 	fileRegexp, err := regexp.Compile(filesRegexpFlag)
 	cobra.CheckErr(errors.Wrapf(err, "cannot compile '%s'", filesRegexpFlag))
@@ -64,17 +63,17 @@ func dofiles(cmd *cobra.Command, args []string) {
 		logger.Info().Msg("dry-run: no files will be removed")
 	}
 	logger.Info().Msgf("working on folder '%s'", dataPath)
-	dirFS := os.DirFS(dataPath)
-	pathElements, err := identifier.BuildPath(dirFS, logger)
+	filter, err := filesWalkFilterFlags.walkFilter(dataFS)
+	cobra.CheckErr(err)
+	pathElements, err := identifier.BuildPath(dataFS, filter, logger)
 	cobra.CheckErr(errors.Wrapf(err, "cannot build paths from '%s'", dataPath))
 
 	for name := range pathElements.FindBasename(fileRegexp) {
 		fmt.Printf("%s\n", name)
 		if filesRemoveFlag {
-			fullpath := filepath.Join(dataPath, name)
-			logger.Info().Msgf("removing '%s'", fullpath)
-			if err := os.Remove(fullpath); err != nil {
-				logger.Fatal().Err(err).Msgf("cannot remove '%s'", fullpath)
+			logger.Info().Msgf("removing '%s/%s'", dataPath, name)
+			if err := dataFS.Remove(name); err != nil {
+				logger.Fatal().Err(err).Msgf("cannot remove '%s/%s'", dataPath, name)
 			}
 		}
 	}
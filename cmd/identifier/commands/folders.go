@@ -2,8 +2,6 @@ package commands
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"regexp"
 
 	"emperror.dev/errors"
@@ -13,6 +11,7 @@ import (
 
 var foldersRemoveFlag bool
 var foldersRegexpFlag string
+var foldersWalkFilterFlags = &walkFilterFlags{}
 
 var foldersCmd = &cobra.Command{
 	Use:     "folders [path to data]",
@@ -20,7 +19,7 @@ var foldersCmd = &cobra.Command{
 	Short:   "list folders including files and subfolders based on go regular expression (with remove option)",
 	Long: `list folders including files and subfolders based on go regular expression (https://pkg.go.dev/regexp/syntax)
 If there are multiple folders in one hierarchy matching the regular expression, only the first one with lowest depth will be listed, which inherently includes the rest.
-There is an option to remove the folders including files and subfolders from filesystem.
+` + walkFilterHelp + locationHelp + `There is an option to remove the folders including files and subfolders from filesystem.
 
 Caveat: dry-run (no --remove flag) is always recommended before removing files from filesystem.
 `,
@@ -48,14 +47,13 @@ func foldersInit() {
 	foldersCmd.Flags().StringVar(&foldersRegexpFlag, "regexp", "", "[required] regular expression to match files")
 	foldersCmd.MarkFlagRequired("regexp")
 	foldersCmd.Flags().BoolVar(&foldersRemoveFlag, "remove", false, "removes (deletes) the folders including files and subfolders from filesystem (if not set it's just a dry run)")
+	addWalkFilterFlags(foldersCmd, foldersWalkFilterFlags)
 }
 
 func dofolders(cmd *cobra.Command, args []string) {
-	dataPath, err := identifier.Fullpath(args[0])
+	dataFS, dataPath, err := openDataLocation(args[0])
 	cobra.CheckErr(err)
-	if fi, err := os.Stat(dataPath); err != nil || !fi.IsDir() {
-		cobra.CheckErr(errors.Errorf("'%s' is not a directory", dataPath))
-	}
+	defer dataFS.Close()
 
 	folderRegexp, err := regexp.Compile(foldersRegexpFlag)
 	cobra.CheckErr(errors.Wrapf(err, "cannot compile '%s'", foldersRegexpFlag))
@@ -65,17 +63,17 @@ func dofolders(cmd *cobra.Command, args []string) {
 	}
 	logger.Info().Msgf("working on folder '%s'", dataPath)
 	logger.Info().Msgf("using regexp \"%s\"", foldersRegexpFlag)
-	dirFS := os.DirFS(dataPath)
-	pathElements, err := identifier.BuildPath(dirFS, logger)
+	filter, err := foldersWalkFilterFlags.walkFilter(dataFS)
+	cobra.CheckErr(err)
+	pathElements, err := identifier.BuildPath(dataFS, filter, logger)
 	cobra.CheckErr(errors.Wrapf(err, "cannot build paths from '%s'", dataPath))
 
 	for name := range pathElements.FindDirname(folderRegexp) {
 		fmt.Printf("%s\n", name)
 		if foldersRemoveFlag {
-			fullpath := filepath.Join(dataPath, name)
-			logger.Info().Msgf("removing '%s'", fullpath)
-			if err := os.RemoveAll(fullpath); err != nil {
-				logger.Fatal().Err(err).Msgf("cannot remove '%s'", fullpath)
+			logger.Info().Msgf("removing '%s/%s'", dataPath, name)
+			if err := dataFS.RemoveAll(name); err != nil {
+				logger.Fatal().Err(err).Msgf("cannot remove '%s/%s'", dataPath, name)
 			}
 		}
 	}
@@ -1,68 +1,147 @@
 package commands
 
 import (
-	"encoding/csv"
 	"fmt"
 	"io/fs"
 	"os"
+	"os/signal"
 	"regexp"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"emperror.dev/errors"
-	"github.com/dgraph-io/badger/v4"
-	badgerOptions "github.com/dgraph-io/badger/v4/options"
-	"github.com/je4/utils/v2/pkg/zLogger"
+	human "github.com/dustin/go-humanize"
+	"github.com/je4/utils/v2/pkg/checksum"
 	"github.com/ocfl-archive/identifier/identifier"
 	"github.com/ocfl-archive/indexer/v3/pkg/util"
 	"github.com/spf13/cobra"
-	"github.com/tealeg/xlsx/v3"
 	"golang.org/x/exp/slices"
 )
 
 var dbFolderFlag string
-var csvFlag string
-var jsonlFlag string
-var xlsxFlag string
-var consoleFlag bool
+var indexOutputFlags = &outputFlags{}
 var concurrentFlag uint
 var actionsFlag []string
+var containersFlag uint
+var digestFlag []string
+var duplicateDigestFlag string
+var sourceFlag string
+var indexWalkFilterFlags = &walkFilterFlags{}
+var noProgressFlag bool
+var noCountFlag bool
+var progressIntervalFlag time.Duration
+var resumeFlag bool
+var historyFlag bool
 
-var fields = []string{"path", "folder", "basename", "size", "lastmod", "duplicate", "mimetype", "pronom", "type", "subtype", "checksum", "width", "height", "duration"}
+func parseDigests(names []string) ([]checksum.DigestAlgorithm, error) {
+	var digests = []checksum.DigestAlgorithm{}
+	for _, name := range names {
+		digest := checksum.DigestAlgorithm(strings.ToLower(strings.TrimSpace(name)))
+		if !checksum.HashExists(digest) {
+			return nil, errors.Errorf("unknown digest algorithm '%s' - use one of %v", name, checksum.DigestNames)
+		}
+		if !slices.Contains(digests, digest) {
+			digests = append(digests, digest)
+		}
+	}
+	return digests, nil
+}
 
 var indexCmd = &cobra.Command{
 	Use:     "index [path to data]",
 	Aliases: []string{},
 	Short:   "retrieves technical metadata from files",
 	Long: `retrieves technical metadata from files
-Persistent output can be written to a badger database, which will allow additional operations without reindexing the files.
-`,
+Persistent output can be written to a badger or sqlite database (--database sqlite:///path/to/index.db), which will allow additional operations without reindexing the files.
+Every data root is registered as source in the database. Use --source to name it, otherwise the source is
+identified by its location or named '` + identifier.DefaultSource + `'.
+With --containers the content of zip and tar containers is indexed as virtual folder (i.e. 'a/b.zip/inner/file.pdf').
+Files, which cannot be indexed, are recorded in the database (see 'index errors' and 'index retry').
+An index run can be interrupted with Ctrl-C (SIGINT) or SIGTERM. Files in progress are finished and a checkpoint
+is stored in the database. Use --resume to continue the run.
+With --history the former record of a file, whose size or modification time has changed, is archived before it is replaced (see 'index history').
+The progress is shown on the terminal. If stdout is not a terminal, progress summaries are logged (log level INFO).
+Percentage and eta are based on a count of the files before indexing, which is skipped for remote data roots and with --no-count.
+` + walkFilterHelp + `Filters apply to the content of containers as well.
+` + locationHelp,
 	Example: ``,
 	Args:    cobra.ExactArgs(1),
 	Run:     doIndex,
 }
 
 func indexInit() {
-	indexCmd.Flags().StringVar(&dbFolderFlag, "database", "", "folder for database (must already exist)")
-	indexCmd.Flags().StringVar(&csvFlag, "csv", "", "write index to csv file")
-	indexCmd.Flags().StringVar(&jsonlFlag, "jsonl", "", "write index to jsonl file")
-	indexCmd.Flags().StringVar(&xlsxFlag, "xlsx", "", "write index to xlsx file (needs memory)")
+	indexCmd.Flags().StringVar(&dbFolderFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
 	indexCmd.Flags().UintVarP(&concurrentFlag, "concurrent", "n", 1, "number of concurrent workers")
 	indexCmd.Flags().StringSliceVar(&actionsFlag, "actions", []string{"siegfried", "xml", "ffprobe", "identify", "json", "tika"}, "actions to be performed")
-	indexCmd.Flags().BoolVar(&consoleFlag, "console", false, "write index to console")
+	addOutputFlags(indexCmd, indexOutputFlags, "index")
+	indexCmd.Flags().StringSliceVar(&digestFlag, "digest", nil, "checksum algorithms to be calculated (default from config)")
+	indexCmd.Flags().StringVar(&duplicateDigestFlag, "duplicate-digest", "", "checksum algorithm for duplicate detection (default from config)")
+	indexCmd.Flags().UintVar(&containersFlag, "containers", 0, "index files inside of zip and tar containers up to this nesting depth (0: containers are not opened)")
+	indexCmd.Flags().StringVar(&sourceFlag, "source", "", "id of the data root within the database (default: source with same location or '"+identifier.DefaultSource+"')")
+	addWalkFilterFlags(indexCmd, indexWalkFilterFlags)
+	indexCmd.Flags().BoolVar(&noProgressFlag, "no-progress", false, "do not show the progress")
+	indexCmd.Flags().BoolVar(&noCountFlag, "no-count", false, "do not count the files for the progress before indexing (remote data roots are never counted)")
+	indexCmd.Flags().BoolVar(&historyFlag, "history", false, "archive the former record of changed files (see 'index history', needs database)")
+	indexCmd.Flags().BoolVar(&resumeFlag, "resume", false, "continue an interrupted run and skip the files already indexed by it (needs database)")
+	indexCmd.Flags().DurationVar(&progressIntervalFlag, "progress-interval", 10*time.Second, "interval of progress log entries, if stdout is not a terminal")
 	indexCmd.MarkFlagDirname("database")
-	indexCmd.MarkFlagFilename("jsonl", "jsonl", "json")
-	indexCmd.MarkFlagFilename("csv", "csv")
-	indexCmd.MarkFlagFilename("xlsx", "xlsx")
 
 	indexListInit()
 	indexFoldersInit()
 	indexPronomInit()
 	indexMimeInit()
-	indexCmd.AddCommand(indexListCmd, indexFoldersCmd, indexPronomCmd, indexMimeCmd)
+	indexPruneInit()
+	indexVerifyInit()
+	indexDuplicatesInit()
+	indexSourcesInit()
+	indexErrorsInit()
+	indexRetryInit()
+	indexReindexSecondaryInit()
+	indexDiffInit()
+	indexHistoryInit()
+	indexReportInit()
+	indexCmd.AddCommand(indexListCmd, indexFoldersCmd, indexPronomCmd, indexMimeCmd, indexPruneCmd, indexVerifyCmd, indexDuplicatesCmd, indexSourcesCmd, indexErrorsCmd, indexRetryCmd, indexReindexSecondaryCmd, indexDiffCmd, indexHistoryCmd, indexReportCmd)
 
 }
 
+// indexSource returns the source located at dataPath and registers it, if it is new
+func indexSource(store identifier.Store, id string, dataPath string) (*identifier.Source, error) {
+	sources, err := identifier.LoadSources(store)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if id == "" {
+		for _, source := range sources {
+			if source.Location == dataPath {
+				return source, nil
+			}
+		}
+		id = identifier.DefaultSource
+	}
+	if err := identifier.ValidSourceID(id); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, source := range sources {
+		if source.ID != id {
+			continue
+		}
+		switch source.Location {
+		case dataPath:
+			return source, nil
+		case "":
+			// the location of migrated records is unknown
+			source.Location = dataPath
+			return source, errors.WithStack(identifier.StoreSource(store, source))
+		default:
+			return nil, errors.Errorf("source '%s' is located at '%s' - use --source to index another data root", id, source.Location)
+		}
+	}
+	source := &identifier.Source{ID: id, Location: dataPath, Created: time.Now().Unix()}
+	return source, errors.WithStack(identifier.StoreSource(store, source))
+}
+
 func doIndex(cmd *cobra.Command, args []string) {
 	if len(args) == 0 && dbFolderFlag == "" {
 		logger.Error().Msg("either data path or database folder must be set")
@@ -72,13 +151,12 @@ func doIndex(cmd *cobra.Command, args []string) {
 		return
 	}
 	var dataPath string
+	var dataFS identifier.DataFS
 	var err error
 	if len(args) > 0 {
-		dataPath, err = identifier.Fullpath(args[0])
+		dataFS, dataPath, err = openDataLocation(args[0])
 		cobra.CheckErr(err)
-		if fi, err := os.Stat(dataPath); err != nil || !fi.IsDir() {
-			cobra.CheckErr(errors.Errorf("'%s' is not a directory", dataPath))
-		}
+		defer dataFS.Close()
 	}
 	if removeIndexListFlag && !(emptyIndexListFlag || duplicatesIndexListFlag || regexpIndexListFlag != "") {
 		logger.Error().Msg("remove flag requires at least one of empty, duplicate or regexp flag")
@@ -109,11 +187,29 @@ func doIndex(cmd *cobra.Command, args []string) {
 	}
 	actionsFlag = newActions
 
-	var badgerDB *badger.DB
-	var csvFile *os.File
-	var csvWriter *csv.Writer
-	var jsonlFile *os.File
-	var sheet *xlsx.Sheet
+	digests := conf.Digest
+	if len(digestFlag) > 0 {
+		if digests, err = parseDigests(digestFlag); err != nil {
+			logger.Error().Err(err).Msg("invalid --digest flag")
+			defer os.Exit(1)
+			return
+		}
+	}
+	dupDigest := conf.DuplicateDigest
+	if duplicateDigestFlag != "" {
+		dupDigest = checksum.DigestAlgorithm(strings.ToLower(duplicateDigestFlag))
+	}
+	if !checksum.HashExists(dupDigest) {
+		logger.Error().Msgf("unknown duplicate digest algorithm '%s' - use one of %v", dupDigest, checksum.DigestNames)
+		defer os.Exit(1)
+		return
+	}
+	if !slices.Contains(digests, dupDigest) {
+		digests = append(digests, dupDigest)
+	}
+	fields := identifier.FileFields(digests)
+
+	var store identifier.Store
 	var regex *regexp.Regexp
 	if regexpIndexListFlag != "" {
 		regex, err = regexp.Compile(regexpIndexListFlag)
@@ -124,139 +220,240 @@ func doIndex(cmd *cobra.Command, args []string) {
 		}
 	}
 	if dbFolderFlag != "" {
-		if badgerDB, err = badger.Open(badger.DefaultOptions(dbFolderFlag).WithCompression(badgerOptions.Snappy).WithLogger(zLogger.NewZWrapper(logger))); err != nil {
-			logger.Error().Err(err).Msgf("cannot open badger database in '%s'", dbFolderFlag)
+		if store, err = identifier.OpenStore(dbFolderFlag, false, logger); err != nil {
+			logger.Error().Err(err).Msgf("cannot open database '%s'", dbFolderFlag)
 			defer os.Exit(1)
 			return
 		}
-		defer func(badgerDB *badger.DB) {
-			err := badgerDB.Close()
+		defer func(store identifier.Store) {
+			err := store.Close()
 			if err != nil {
-				logger.Error().Err(err).Msg("error closing badger database")
+				logger.Error().Err(err).Msg("error closing database")
 			}
-		}(badgerDB)
-	}
-	if csvFlag != "" {
-		if csvFile, err = os.Create(csvFlag); err != nil {
-			logger.Error().Err(err).Msgf("cannot create csv file '%s'", csvFlag)
+		}(store)
+		if err := identifier.AddDigests(store, digests); err != nil {
+			logger.Error().Err(err).Msg("cannot store digest algorithms")
 			defer os.Exit(1)
 			return
 		}
-		defer func(csvFile *os.File) {
-			err := csvFile.Close()
-			if err != nil {
-				logger.Error().Err(err).Msg("error closing csv file")
-			}
-		}(csvFile)
-		csvWriter = csv.NewWriter(csvFile)
-		defer csvWriter.Flush()
-		err := csvWriter.Write(fields)
-		if err != nil {
-			logger.Error().Err(err).Msgf("cannot write csv file '%s'", csvFlag)
-		}
 	}
-	if jsonlFlag != "" {
-		if jsonlFile, err = os.Create(jsonlFlag); err != nil {
-			logger.Error().Err(err).Msgf("cannot create jsonl file '%s'", jsonlFlag)
+	var source = &identifier.Source{ID: sourceFlag}
+	if source.ID == "" {
+		source.ID = identifier.DefaultSource
+	}
+	if store != nil && dataPath != "" {
+		if source, err = indexSource(store, sourceFlag, dataPath); err != nil {
+			logger.Error().Err(err).Msg("cannot determine source")
 			defer os.Exit(1)
 			return
 		}
-		defer func(jsonlFile *os.File) {
-			err := jsonlFile.Close()
-			if err != nil {
-				logger.Error().Err(err).Msg("error closing jsonl file")
-			}
-		}(jsonlFile)
+		logger.Info().Msgf("indexing '%s' as source '%s'", dataPath, source.ID)
 	}
-	if xlsxFlag != "" {
-		// check, whether a file can be created
-		xlsxFile, err := os.Create(xlsxFlag)
-		if err != nil {
-			logger.Error().Err(err).Msgf("cannot create xlsx file '%s'", xlsxFlag)
+	specs := indexOutputFlags.specs()
+	if err := indexOutputFlags.check(specs); err != nil {
+		logger.Error().Err(err).Msg("invalid output")
+		defer os.Exit(1)
+		return
+	}
+	output, err := identifier.NewOutput(specs, "index", fields, identifier.FileFieldTypes, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot create output")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := output.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close output")
+		}
+	}()
+	console := indexOutputFlags.console || len(specs) == 0
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// a second signal terminates immediately
+		stop()
+	}()
+
+	startTime := time.Now().Unix()
+	var completed = map[string]int64{}
+	if resumeFlag {
+		if store == nil || dataPath == "" {
+			logger.Error().Msg("resume flag requires data path and database")
 			defer os.Exit(1)
 			return
 		}
-		if err := xlsxFile.Close(); err != nil {
-			logger.Error().Err(err).Msgf("cannot close xlsx file '%s'", xlsxFlag)
+		run, err := identifier.LoadRun(store, source.ID)
+		if err != nil {
+			logger.Error().Err(err).Msg("cannot load checkpoint")
 			defer os.Exit(1)
 			return
 		}
-		if err := os.Remove(xlsxFlag); err != nil {
-			logger.Error().Err(err).Msgf("cannot remove xlsx file '%s'", xlsxFlag)
+		if run == nil || run.Finished {
+			logger.Warn().Msgf("no interrupted run of source '%s' - starting new run", source.ID)
+		} else {
+			startTime = run.Started
+			if completed, err = identifier.CompletedPaths(store, source.ID, startTime); err != nil {
+				logger.Error().Err(err).Msg("cannot load completed files")
+				defer os.Exit(1)
+				return
+			}
+			logger.Info().Msgf("resuming run of %s with %d completed files", time.Unix(startTime, 0).Format(time.RFC3339), len(completed))
+		}
+	}
+	var run = &identifier.Run{Source: source.ID, Started: startTime, Updated: time.Now().Unix()}
+	if store != nil && dataPath != "" {
+		if err := identifier.StoreRun(store, run); err != nil {
+			logger.Error().Err(err).Msg("cannot store checkpoint")
 			defer os.Exit(1)
 			return
 		}
-		xlsxWriter := xlsx.NewFile()
-		sheet, err = xlsxWriter.AddSheet("index")
-		defer func() {
-			if err := xlsxWriter.Save(xlsxFlag); err != nil {
-				logger.Error().Err(err).Msgf("cannot save xlsx file '%s'", xlsxFlag)
-			}
-		}()
-		row, err := sheet.AddRowAtIndex(0)
+	}
+	if dataPath != "" {
+		var dirFS fs.FS = dataFS
+		filter, err := indexWalkFilterFlags.walkFilter(dirFS)
 		if err != nil {
-			logger.Error().Err(err).Msgf("cannot add header row to xlsx file '%s'", xlsxFlag)
+			logger.Error().Err(err).Msg("cannot create filter")
 			defer os.Exit(1)
 			return
 		}
-		for _, field := range fields {
-			cell := row.AddCell()
-			cell.SetString(field)
-			style := xlsx.NewStyle()
-			style.Alignment.Horizontal = "center"
-			style.Fill.BgColor = "0A0A0A00"
-			style.Border = *xlsx.NewBorder("thin", "thin", "thin", "thick")
-			cell.SetStyle(style)
+		var fsys = dirFS
+		var containerFS *identifier.ContainerFS
+		if containersFlag > 0 {
+			containerFS = identifier.NewContainerFS(dirFS, containersFlag, logger)
+			defer func() {
+				if err := containerFS.Close(); err != nil {
+					logger.Error().Err(err).Msg("error closing containers")
+				}
+			}()
+			fsys = containerFS
 		}
-	}
-
-	if sheet == nil && csvWriter == nil && jsonlFile == nil {
-		consoleFlag = true
-	}
-
-	startTime := time.Now().Unix()
-	if dataPath != "" {
-		dirFS := os.DirFS(dataPath)
 		jobs := make(chan string, 100)
-		results := make(chan string, 100)
+		results := make(chan *identifier.WorkerResult, 100)
 
 		var waiter = &sync.WaitGroup{}
 
 		for w := uint(1); w <= concurrentFlag; w++ {
 			go identifier.Worker(
+				ctx,
 				w,
-				dirFS,
+				fsys,
+				source.ID,
 				actionsFlag,
+				digests,
+				dupDigest,
 				idx,
 				logger,
 				jobs,
 				results,
-				badgerDB,
+				store,
 				startTime,
+				historyFlag,
 				waiter,
 			)
 		}
 
+		var progress *indexProgress
+		if !noProgressFlag {
+			// without database the files are written to stdout
+			interval := progressIntervalFlag
+			info := indexOutputFlags.info()
+			terminal := store != nil && isTerminal(info)
+			if terminal {
+				interval = 500 * time.Millisecond
+			}
+			progress = newIndexProgress(info, terminal, max(interval, 100*time.Millisecond))
+			// counting walks the data root twice, which is too expensive for remote data roots
+			if noCountFlag || identifier.IsRemoteLocation(dataPath) {
+				logger.Info().Msg("files are not counted, the progress shows no percentage and eta")
+			} else {
+				progress.startCount(dirFS, filter)
+			}
+			go progress.run()
+		}
+		var resultWaiter = &sync.WaitGroup{}
+		resultWaiter.Add(1)
 		go func() {
-			for n := range results {
-				logger.Debug().Msgf("result: %s", n)
+			defer resultWaiter.Done()
+			for result := range results {
+				if result.Done {
+					logger.Debug().Msgf("result: #%03d: %s done", result.Worker, result.Path)
+					if !result.Failed {
+						run.Files++
+					}
+				}
+				if progress != nil {
+					progress.add(result)
+				}
 			}
 		}()
 
+		// files completed by the resumed run are skipped
+		var skipped int64
+		skipCompleted := func(path string) bool {
+			size, ok := completed[path]
+			if ok {
+				skipped++
+				if progress != nil {
+					progress.skip(size)
+				}
+			}
+			return ok
+		}
 		if err := fs.WalkDir(dirFS, ".", func(path string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return fs.SkipAll
+			}
 			if err != nil {
 				return errors.Wrapf(err, "cannot walk %s/%s", dirFS, path)
 			}
 			if d.IsDir() {
+				if filter.SkipDir(path) {
+					logger.Debug().Msgf("skipping folder %s/%s", dirFS, path)
+					return fs.SkipDir
+				}
 				logger.Debug().Msgf("folder %s/%s\n", dirFS, path)
 				return nil
 			}
 			//			logger.Info().Msgf("[f] %s/%s\n", dirFS, path)
+			var size int64
+			if fi, err := d.Info(); err == nil {
+				size = fi.Size()
+			}
+			if filter.SkipFile(path, size) {
+				logger.Debug().Msgf("skipping %s/%s", dirFS, path)
+			} else if !skipCompleted(path) {
+				waiter.Add(1)
+				logger.Debug().Msgf("adding %s", path)
+				jobs <- path
+			}
 
-			waiter.Add(1)
-			logger.Debug().Msgf("adding %s", path)
-			jobs <- path
-
+			// the content of a container is filtered like a folder, size and include patterns apply to its files only
+			if containerFS != nil && identifier.IsContainer(path) && !filter.SkipDir(path) {
+				if err := containerFS.WalkContainer(path, func(path string) error {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					var size int64
+					if fi, err := fs.Stat(containerFS, path); err == nil {
+						size = fi.Size()
+					}
+					if filter.SkipFile(path, size) {
+						logger.Debug().Msgf("skipping %s", path)
+						return nil
+					}
+					if skipCompleted(path) {
+						return nil
+					}
+					waiter.Add(1)
+					logger.Debug().Msgf("adding %s", path)
+					jobs <- path
+					return nil
+				}); err != nil && ctx.Err() == nil {
+					logger.Error().Err(err).Msgf("cannot walk container %s/%s", dirFS, path)
+				}
+			}
 			return nil
 		}); err != nil {
 			panic(fmt.Errorf("cannot walkd folder %v: %v", dirFS, err))
@@ -264,12 +461,43 @@ func doIndex(cmd *cobra.Command, args []string) {
 
 		waiter.Wait()
 		close(jobs)
+		close(results)
+		resultWaiter.Wait()
+		if progress != nil {
+			progress.stop()
+		}
+
+		if store != nil {
+			run.Files += skipped
+			run.Updated = time.Now().Unix()
+			run.Interrupted = ctx.Err() != nil
+			run.Finished = !run.Interrupted
+			if err := identifier.StoreRun(store, run); err != nil {
+				logger.Error().Err(err).Msg("cannot store checkpoint")
+			}
+		}
+		if ctx.Err() != nil {
+			logger.Warn().Msgf("index run interrupted after %d files - use --resume to continue", run.Files)
+		} else if store != nil {
+			var staleCount, staleSize int64
+			if err := identifier.IterateStale(store, source.ID, startTime, func(key string, fData *identifier.FileData) error {
+				logger.Info().Str("key", key).Time("lastseen", time.Unix(fData.LastSeen, 0)).Msgf("not seen in this run: %s", fData.Path)
+				staleCount++
+				staleSize += fData.Size
+				return nil
+			}); err != nil {
+				logger.Error().Err(err).Msg("cannot check for stale records")
+			}
+			if staleCount > 0 {
+				logger.Warn().Msgf("%d records (%s) have not been seen in this run - use 'index prune' to remove them", staleCount, human.Bytes(uint64(staleSize)))
+			}
+		}
 	}
-	if badgerDB != nil {
-		if err := identifier.IterateBadger(logger, emptyIndexListFlag, duplicatesIndexListFlag, removeIndexListFlag, regex, jsonlFile, csvWriter, sheet, consoleFlag, badgerDB, func(fData *identifier.FileData) bool {
+	if store != nil {
+		if err := identifier.IterateStore(logger, emptyIndexListFlag, duplicatesIndexListFlag, removeIndexListFlag, regex, output, console, store, digests, func(fData *identifier.FileData) bool {
 			return true
 		}); err != nil {
-			logger.Error().Err(err).Msg("cannot iterate badger")
+			logger.Error().Err(err).Msg("cannot iterate database")
 		}
 	}
 	return
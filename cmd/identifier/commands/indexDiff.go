@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"emperror.dev/errors"
+	human "github.com/dustin/go-humanize"
+	"github.com/je4/utils/v2/pkg/checksum"
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+var dbFolderIndexDiffFlag string
+var sourceIndexDiffFlag string
+var prefixIndexDiffFlag string
+var toDbFolderIndexDiffFlag string
+var toSourceIndexDiffFlag string
+var toPrefixIndexDiffFlag string
+var digestIndexDiffFlag string
+var indexDiffOutputFlags = &outputFlags{}
+
+var fieldsIndexDiff = []string{"change", "path", "oldpath", "size", "oldsize", "lastmod", "oldlastmod", "checksum", "oldchecksum"}
+var typesIndexDiff = identifier.FieldTypes{"size": identifier.FieldInt, "oldsize": identifier.FieldInt, "lastmod": identifier.FieldTime, "oldlastmod": identifier.FieldTime}
+
+var indexDiffCmd = &cobra.Command{
+	Use:     "diff",
+	Aliases: []string{},
+	Short:   "compare two databases, sources or folders",
+	Long: `compare two databases, sources or folders
+The files of the old snapshot (--database, --source, --prefix) are compared with the files of the new snapshot
+(--to-database, --to-source, --to-prefix) by their path relative to the prefix and their checksum (--digest).
+Every option of the new snapshot defaults to the old one, so at least one of them must be given.
+The source of a database with more than one source must be selected by --source or --to-source.
+The changes are
+  added:    file exists only in the new snapshot
+  removed:  file exists only in the old snapshot
+  modified: content has changed
+  touched:  only the modification time has changed
+  moved:    removed and added file with the same checksum
+`,
+	Example: `compare two index runs of a delivery
+
+` + appname + ` index diff --database c:\temp\delivery1 --to-database c:\temp\delivery2
+
+compare two folders of a source
+
+` + appname + ` index diff --database c:\temp\indexerbadger --prefix v1/ --to-prefix v2/ --out xlsx:c:\temp\diff.xlsx`,
+	Args: cobra.NoArgs,
+	Run:  doindexDiff,
+}
+
+func indexDiffInit() {
+	indexDiffCmd.Flags().StringVar(&dbFolderIndexDiffFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	indexDiffCmd.Flags().StringVar(&sourceIndexDiffFlag, "source", "", "source of the old snapshot")
+	indexDiffCmd.Flags().StringVar(&prefixIndexDiffFlag, "prefix", "", "folder path prefix of the old snapshot")
+	indexDiffCmd.Flags().StringVar(&toDbFolderIndexDiffFlag, "to-database", "", "database of the new snapshot (default: --database)")
+	indexDiffCmd.Flags().StringVar(&toSourceIndexDiffFlag, "to-source", "", "source of the new snapshot (default: --source)")
+	indexDiffCmd.Flags().StringVar(&toPrefixIndexDiffFlag, "to-prefix", "", "folder path prefix of the new snapshot (default: --prefix)")
+	indexDiffCmd.Flags().StringVar(&digestIndexDiffFlag, "digest", string(checksum.DigestSHA512), "checksum algorithm for the comparison")
+	addOutputFlags(indexDiffCmd, indexDiffOutputFlags, "changes")
+	indexDiffCmd.MarkFlagDirname("database")
+	indexDiffCmd.MarkFlagRequired("database")
+}
+
+// diffSide opens the database of a snapshot, if it is not the database of the other snapshot, and selects its source
+func diffSide(location, id, prefix string, other *identifier.DiffSide) (*identifier.DiffSide, func() error, error) {
+	side := &identifier.DiffSide{Prefix: prefix}
+	closer := func() error { return nil }
+	if other != nil {
+		side.Store = other.Store
+	} else {
+		store, err := identifier.OpenStore(location, true, logger)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "cannot open database '%s'", location)
+		}
+		side.Store = store
+		closer = store.Close
+	}
+	sources, err := identifier.LoadSources(side.Store)
+	if err != nil {
+		closer()
+		return nil, nil, errors.Wrapf(err, "cannot load sources of '%s'", location)
+	}
+	source, err := singleSource(sources, id, "")
+	if err != nil {
+		closer()
+		return nil, nil, errors.Wrapf(err, "cannot select source of '%s'", location)
+	}
+	side.Source = source.ID
+	return side, closer, nil
+}
+
+// diffTime formats the modification time of a file, which may not exist in a snapshot
+func diffTime(t int64) any {
+	if t == 0 {
+		return ""
+	}
+	return time.Unix(t, 0)
+}
+
+func doindexDiff(cmd *cobra.Command, args []string) {
+	toDbFolder, toSource, toPrefix := toDbFolderIndexDiffFlag, toSourceIndexDiffFlag, toPrefixIndexDiffFlag
+	if toDbFolder == "" {
+		toDbFolder = dbFolderIndexDiffFlag
+	}
+	if toSource == "" {
+		toSource = sourceIndexDiffFlag
+	}
+	if !cmd.Flags().Changed("to-prefix") {
+		toPrefix = prefixIndexDiffFlag
+	}
+	if toDbFolder == dbFolderIndexDiffFlag && toSource == sourceIndexDiffFlag && toPrefix == prefixIndexDiffFlag {
+		logger.Error().Msg("old and new snapshot are the same - use --to-database, --to-source or --to-prefix")
+		defer os.Exit(1)
+		return
+	}
+	digests, err := parseDigests([]string{digestIndexDiffFlag})
+	if err != nil {
+		logger.Error().Err(err).Msg("invalid --digest flag")
+		defer os.Exit(1)
+		return
+	}
+	digest := digests[0]
+
+	oldSide, oldCloser, err := diffSide(dbFolderIndexDiffFlag, sourceIndexDiffFlag, prefixIndexDiffFlag, nil)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot open old snapshot")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := oldCloser(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
+		}
+	}()
+	var sameDatabase *identifier.DiffSide
+	if toDbFolder == dbFolderIndexDiffFlag {
+		sameDatabase = oldSide
+	}
+	newSide, newCloser, err := diffSide(toDbFolder, toSource, toPrefix, sameDatabase)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot open new snapshot")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := newCloser(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
+		}
+	}()
+
+	output, err := indexDiffOutputFlags.output("diff", fieldsIndexDiff, typesIndexDiff)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot create output")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := output.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close output")
+		}
+	}()
+
+	fmt.Fprintf(indexDiffOutputFlags.info(), "#comparing %s:%s (%s) with %s:%s (%s) by %s\n", oldSide.Source, prefixIndexDiffFlag, dbFolderIndexDiffFlag, newSide.Source, toPrefix, toDbFolder, digest)
+	summary, err := identifier.Diff(oldSide, newSide, digest, func(entry *identifier.DiffEntry) error {
+		return errors.Wrap(output.Write([]any{
+			string(entry.Kind),
+			entry.Path,
+			entry.OldPath,
+			entry.Size,
+			entry.OldSize,
+			diffTime(entry.LastMod),
+			diffTime(entry.OldLastMod),
+			entry.Checksum,
+			entry.OldChecksum,
+		}, entry), "cannot write output")
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot compare snapshots")
+		defer os.Exit(1)
+		return
+	}
+	for _, kind := range identifier.DiffKinds {
+		fmt.Fprintf(indexDiffOutputFlags.info(), "#%s: %d files, %s\n", kind, summary.Files[kind], human.Bytes(uint64(summary.Bytes[kind])))
+	}
+	return
+}
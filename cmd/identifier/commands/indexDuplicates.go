@@ -0,0 +1,427 @@
+package commands
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	human "github.com/dustin/go-humanize"
+	"github.com/je4/utils/v2/pkg/checksum"
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+var indexDuplicatesOutputFlags = &outputFlags{}
+var dbFolderIndexDuplicatesFlag string
+var digestIndexDuplicatesFlag string
+var policyIndexDuplicatesFlag string
+var keepPrefixIndexDuplicatesFlag string
+var removeIndexDuplicatesFlag bool
+var linkIndexDuplicatesFlag string
+var journalIndexDuplicatesFlag string
+var sourceIndexDuplicatesFlag string
+var whereIndexDuplicatesFlag string
+
+var fieldsIndexDuplicates = []string{"checksum", "size", "count", "wasted", "source", "path", "lastmod", "keep"}
+var typesIndexDuplicates = identifier.FieldTypes{"size": identifier.FieldInt, "count": identifier.FieldInt, "wasted": identifier.FieldInt, "lastmod": identifier.FieldTime, "keep": identifier.FieldBool}
+
+var indexDuplicatesCmd = &cobra.Command{
+	Use:     "duplicates [path to data]",
+	Aliases: []string{},
+	Short:   "list groups of duplicate files and remove redundant copies",
+	Long: `list groups of duplicate files and remove redundant copies
+Duplicate groups are taken from the checksum index, which is maintained by every index run.
+Groups may span several sources, unless a source is selected by --source or by its location.
+Databases created with older versions need 'db migrate' to build the checksum index.
+
+Within every group one file is kept according to the policy:
+  shortest: shortest path
+  oldest:   oldest modification time
+  prefix:   path starting with --keep-prefix (shortest path otherwise)
+With --remove all other copies are deleted. The file to be kept must exist unchanged since the last index run (size and
+modification time) and its checksum is computed again, so the last intact copy is never deleted.
+The checksums of the copies are computed again before they are deleted.
+Copies, which have changed since the last index run, are neither deleted nor replaced.
+With --link all other copies are replaced by hard links (hardlink) or copy-on-write clones (reflink) of the file to be kept,
+so no path is lost. Before replacing a copy, its content is compared byte by byte with the file to be kept.
+Every replacement is written to the journal (--journal) and the records are marked as linked in the database.
+Files inside of containers are never deleted or replaced.
+With --where only matching files are considered, so a group needs at least two matching files.
+
+Caveat: dry-run (no --remove or --link flag) is always recommended before removing or replacing files.
+` + whereHelp,
+	Example: `list all duplicate groups
+
+` + appname + ` index duplicates --database c:\temp\indexerbadger
+
+replace all duplicates by hard links to the copy with the shortest path
+
+` + appname + ` index duplicates C:/daten/aiptest --database c:\temp\indexerbadger --link hardlink --journal c:\temp\dedupe.jsonl
+
+remove all duplicates, but keep the copies in the folder 'master'
+
+` + appname + ` index duplicates C:/daten/aiptest --database c:\temp\indexerbadger --policy prefix --keep-prefix master/ --remove`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  doindexDuplicates,
+}
+
+func indexDuplicatesInit() {
+	indexDuplicatesCmd.Flags().StringVar(&dbFolderIndexDuplicatesFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	addOutputFlags(indexDuplicatesCmd, indexDuplicatesOutputFlags, "duplicates")
+	indexDuplicatesCmd.Flags().StringVar(&digestIndexDuplicatesFlag, "digest", "", "checksum algorithm for duplicate detection (default from config)")
+	indexDuplicatesCmd.Flags().StringVar(&policyIndexDuplicatesFlag, "policy", string(identifier.KeepShortest), "policy for the file to be kept (shortest, oldest, prefix)")
+	indexDuplicatesCmd.Flags().StringVar(&keepPrefixIndexDuplicatesFlag, "keep-prefix", "", "preferred path prefix for policy prefix")
+	indexDuplicatesCmd.Flags().BoolVar(&removeIndexDuplicatesFlag, "remove", false, "removes all copies except the one to be kept (if not set it's just a dry run)")
+	indexDuplicatesCmd.Flags().StringVar(&linkIndexDuplicatesFlag, "link", "", "replaces all copies except the one to be kept by links (hardlink, reflink)")
+	indexDuplicatesCmd.Flags().StringVar(&journalIndexDuplicatesFlag, "journal", "", "jsonl journal of all replacements (required for --link)")
+	indexDuplicatesCmd.Flags().StringVar(&sourceIndexDuplicatesFlag, "source", "", "consider only files of this source")
+	indexDuplicatesCmd.Flags().StringVar(&whereIndexDuplicatesFlag, "where", "", "consider only files matching the filter expression")
+	indexDuplicatesCmd.MarkFlagDirname("database")
+	indexDuplicatesCmd.MarkFlagRequired("database")
+	indexDuplicatesCmd.MarkFlagFilename("journal", "jsonl", "json")
+	indexDuplicatesCmd.MarkFlagsMutuallyExclusive("remove", "link")
+}
+
+// existingFile checks, whether the file exists as regular file of the given size and the modification time of its record
+func existingFile(sourceFSs *sourceFS, fData *identifier.DuplicateFile, size int64) bool {
+	fsys, err := sourceFSs.get(fData.Source)
+	if err != nil {
+		return false
+	}
+	fi, err := fs.Stat(fsys, fData.Path)
+	if err != nil {
+		return false
+	}
+	return fi.Mode().IsRegular() && fi.Size() == size && fi.ModTime().Unix() == fData.LastMod
+}
+
+// intactFile checks, whether the file exists unchanged and its content still has the checksum of the group
+func intactFile(sourceFSs *sourceFS, fData *identifier.DuplicateFile, group *identifier.DuplicateGroup) bool {
+	if !existingFile(sourceFSs, fData, group.Size) {
+		return false
+	}
+	fsys, err := sourceFSs.get(fData.Source)
+	if err != nil {
+		return false
+	}
+	fp, err := fsys.Open(fData.Path)
+	if err != nil {
+		logger.Warn().Err(err).Msgf("cannot open '%s'", fData.Path)
+		return false
+	}
+	defer fp.Close()
+	sums, err := checksum.Copy([]checksum.DigestAlgorithm{group.Digest}, fp)
+	if err != nil {
+		logger.Warn().Err(err).Msgf("cannot read '%s'", fData.Path)
+		return false
+	}
+	if !strings.EqualFold(sums[group.Digest], group.Checksum) {
+		logger.Warn().Msgf("checksum of '%s' has changed since last index run", fData.Path)
+		return false
+	}
+	return true
+}
+
+// matchingDuplicates returns the files of a duplicate group, whose records match the filter expression
+func matchingDuplicates(store identifier.Store, where *identifier.Where, files []*identifier.DuplicateFile) ([]*identifier.DuplicateFile, error) {
+	var result = []*identifier.DuplicateFile{}
+	for _, file := range files {
+		fData, err := identifier.LoadFileData(store, file.Source, file.Path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot load record of '%s'", file.Path)
+		}
+		if fData != nil && where.Match(fData) {
+			result = append(result, file)
+		}
+	}
+	return result, nil
+}
+
+func doindexDuplicates(cmd *cobra.Command, args []string) {
+	var dataPath string
+	var err error
+	if len(args) > 0 {
+		dataPath = dataLocation(args[0])
+	}
+	where, err := identifier.ParseWhere(whereIndexDuplicatesFlag)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot parse filter expression")
+		defer os.Exit(1)
+		return
+	}
+	linkMode := identifier.LinkMode(linkIndexDuplicatesFlag)
+	switch linkMode {
+	case "", identifier.LinkHard, identifier.LinkReflink:
+	default:
+		logger.Error().Msgf("unknown link mode '%s' - use one of hardlink, reflink", linkIndexDuplicatesFlag)
+		defer os.Exit(1)
+		return
+	}
+	if linkMode != "" && journalIndexDuplicatesFlag == "" {
+		logger.Error().Msg("link flag requires --journal")
+		defer os.Exit(1)
+		return
+	}
+	policy := identifier.KeepPolicy(policyIndexDuplicatesFlag)
+	switch policy {
+	case identifier.KeepShortest, identifier.KeepOldest:
+	case identifier.KeepPrefix:
+		if keepPrefixIndexDuplicatesFlag == "" {
+			logger.Error().Msg("policy prefix requires --keep-prefix")
+			defer os.Exit(1)
+			return
+		}
+	default:
+		logger.Error().Msgf("unknown policy '%s' - use one of shortest, oldest, prefix", policyIndexDuplicatesFlag)
+		defer os.Exit(1)
+		return
+	}
+	digest := conf.DuplicateDigest
+	if digestIndexDuplicatesFlag != "" {
+		digests, err := parseDigests([]string{digestIndexDuplicatesFlag})
+		if err != nil {
+			logger.Error().Err(err).Msg("invalid --digest flag")
+			defer os.Exit(1)
+			return
+		}
+		digest = digests[0]
+	}
+	fmt.Fprintf(indexDuplicatesOutputFlags.info(), "#duplicates by %s, keeping %s\n", digest, policy)
+	if removeIndexDuplicatesFlag {
+		fmt.Fprintln(indexDuplicatesOutputFlags.info(), "#removing files")
+	}
+	if linkMode != "" {
+		fmt.Fprintf(indexDuplicatesOutputFlags.info(), "#replacing files by %s\n", linkMode)
+	}
+
+	output, err := indexDuplicatesOutputFlags.output("duplicates", fieldsIndexDuplicates, typesIndexDuplicates)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot create output")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := output.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close output")
+		}
+	}()
+
+	var journal *identifier.LinkJournal
+	if linkMode != "" {
+		journal, err = identifier.NewLinkJournal(journalIndexDuplicatesFlag)
+		if err != nil {
+			logger.Error().Err(err).Msg("cannot open journal")
+			defer os.Exit(1)
+			return
+		}
+		defer func() {
+			if err := journal.Close(); err != nil {
+				logger.Error().Err(err).Msg("cannot close journal")
+			}
+		}()
+	}
+
+	storeIterator, err := identifier.NewStoreIterator(dbFolderIndexDuplicatesFlag, !removeIndexDuplicatesFlag && linkMode == "", logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot open database")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := storeIterator.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
+		}
+	}()
+
+	sources, err := storeIterator.Sources()
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load sources")
+		defer os.Exit(1)
+		return
+	}
+	source, err := selectSource(sources, sourceIndexDuplicatesFlag, dataPath)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot select source")
+		defer os.Exit(1)
+		return
+	}
+	locations := sourceLocations(sources)
+	sourceFSs := newSourceFS(sources)
+	defer sourceFSs.Close()
+
+	var groups, files, wasted, removed, linked, freed int64
+	var selectedGroups = []*identifier.DuplicateGroup{}
+	if err := storeIterator.IterateDuplicates(digest, sourceID(source), func(group *identifier.DuplicateGroup) error {
+		if !where.Empty() {
+			var err error
+			if group.Files, err = matchingDuplicates(storeIterator.Store(), where, group.Files); err != nil {
+				return err
+			}
+			if len(group.Files) < 2 {
+				return nil
+			}
+		}
+		group.Sort(policy, keepPrefixIndexDuplicatesFlag)
+		groups++
+		files += int64(len(group.Files))
+		wasted += group.Wasted()
+		for i, file := range group.Files {
+			if err := output.Write([]any{
+				fmt.Sprintf("%s:%s", digest, group.Checksum),
+				group.Size,
+				len(group.Files),
+				group.Wasted(),
+				file.Source,
+				file.Path,
+				time.Unix(file.LastMod, 0),
+				i == 0,
+			}, struct {
+				*identifier.DuplicateFile
+				Digest   checksum.DigestAlgorithm `json:"digest"`
+				Checksum string                   `json:"checksum"`
+				Size     int64                    `json:"size"`
+				Keep     bool                     `json:"keep"`
+			}{DuplicateFile: file, Digest: digest, Checksum: group.Checksum, Size: group.Size, Keep: i == 0}); err != nil {
+				return errors.Wrap(err, "cannot write output")
+			}
+		}
+		if removeIndexDuplicatesFlag || linkMode != "" {
+			selectedGroups = append(selectedGroups, group)
+		}
+		return nil
+	}); err != nil {
+		logger.Error().Err(err).Msg("cannot iterate duplicates")
+		defer os.Exit(1)
+		return
+	}
+
+	for _, group := range selectedGroups {
+		// the first intact copy in policy order is kept
+		var keep *identifier.DuplicateFile
+		for _, file := range group.Files {
+			if file.Container != "" {
+				continue
+			}
+			if intactFile(sourceFSs, file, group) {
+				keep = file
+				break
+			}
+		}
+		if keep == nil {
+			logger.Warn().Msgf("no intact copy of %s:%s found - skipping group", digest, group.Checksum)
+			continue
+		}
+		for _, file := range group.Files {
+			if file == keep {
+				continue
+			}
+			if file.Container != "" {
+				logger.Warn().Msgf("cannot remove '%s' inside of container '%s'", file.Path, file.Container)
+				continue
+			}
+			fsys, err := sourceFSs.get(file.Source)
+			if err != nil {
+				logger.Warn().Err(err).Msgf("'%s' not processed", file.Path)
+				continue
+			}
+			fullpath := joinLocation(locations[file.Source], file.Path)
+			if linkMode != "" {
+				if identifier.IsRemoteLocation(locations[file.Source]) || identifier.IsRemoteLocation(locations[keep.Source]) {
+					logger.Warn().Msgf("cannot link '%s' - links are supported for local folders only", fullpath)
+					continue
+				}
+				if linkDuplicate(journal, storeIterator, linkMode, locations, sourceFSs, keep, file, group) {
+					linked++
+					freed += group.Size
+				}
+				continue
+			}
+			if intactFile(sourceFSs, file, group) {
+				logger.Info().Msgf("removing file '%s' (keeping '%s')", fullpath, keep.Path)
+				if err := fsys.Remove(file.Path); err != nil {
+					logger.Error().Err(err).Msgf("cannot remove file '%s'", fullpath)
+					continue
+				}
+				removed++
+				freed += group.Size
+			} else if _, err := fs.Stat(fsys, file.Path); !errors.Is(err, fs.ErrNotExist) {
+				logger.Warn().Msgf("'%s' has changed since last index run - not removed", fullpath)
+				continue
+			}
+			if err := storeIterator.RemoveFileData(file.Source, file.Path); err != nil {
+				logger.Error().Err(err).Msgf("cannot remove record of '%s'", file.Path)
+			}
+		}
+	}
+
+	fmt.Fprintf(indexDuplicatesOutputFlags.info(), "#%d duplicate groups with %d files, %s wasted\n", groups, files, human.Bytes(uint64(wasted)))
+	if removeIndexDuplicatesFlag {
+		fmt.Fprintf(indexDuplicatesOutputFlags.info(), "#%d files removed, %s freed\n", removed, human.Bytes(uint64(freed)))
+	}
+	if linkMode != "" {
+		fmt.Fprintf(indexDuplicatesOutputFlags.info(), "#%d files replaced by %s, %s freed\n", linked, linkMode, human.Bytes(uint64(freed)))
+	}
+	return
+}
+
+// linkDuplicate replaces file by a link to keep and documents the replacement in journal and database
+func linkDuplicate(journal *identifier.LinkJournal, storeIterator *identifier.StoreIterator, linkMode identifier.LinkMode, locations map[string]string, sourceFSs *sourceFS, keep, file *identifier.DuplicateFile, group *identifier.DuplicateGroup) bool {
+	keepPath := filepath.Join(locations[keep.Source], keep.Path)
+	fullpath := filepath.Join(locations[file.Source], file.Path)
+	entry := &identifier.LinkJournalEntry{
+		Time:       time.Now().Unix(),
+		Mode:       linkMode,
+		KeepSource: keep.Source,
+		Keep:       keep.Path,
+		Source:     file.Source,
+		Path:       file.Path,
+		Checksum:   fmt.Sprintf("%s:%s", group.Digest, group.Checksum),
+		Size:       group.Size,
+	}
+	defer func() {
+		if err := journal.Write(entry); err != nil {
+			logger.Error().Err(err).Msgf("cannot write journal entry for '%s'", fullpath)
+		}
+	}()
+	if !existingFile(sourceFSs, file, group.Size) {
+		entry.Outcome = "skipped"
+		entry.Message = "file does not exist or has changed since last index run"
+		logger.Warn().Msgf("'%s' does not exist or has changed since last index run - not replaced", fullpath)
+		return false
+	}
+	if linkMode == identifier.LinkHard {
+		keepInfo, err1 := os.Stat(keepPath)
+		fileInfo, err2 := os.Stat(fullpath)
+		if err1 == nil && err2 == nil && os.SameFile(keepInfo, fileInfo) {
+			entry.Outcome = "skipped"
+			entry.Message = "already linked"
+			return false
+		}
+	}
+	logger.Info().Msgf("replacing file '%s' by %s to '%s'", fullpath, linkMode, keep.Path)
+	if err := identifier.ReplaceWithLink(keepPath, fullpath, linkMode); err != nil {
+		entry.Outcome = "failed"
+		entry.Message = err.Error()
+		logger.Error().Err(err).Msgf("cannot replace file '%s'", fullpath)
+		return false
+	}
+	entry.Outcome = "linked"
+	fi, err := os.Stat(fullpath)
+	if err != nil {
+		logger.Error().Err(err).Msgf("cannot stat '%s'", fullpath)
+		return true
+	}
+	if err := storeIterator.SetLink(file.Source, file.Path, &identifier.LinkInfo{
+		Source: keep.Source,
+		Target: keep.Path,
+		Mode:   linkMode,
+		Time:   entry.Time,
+	}, fi.ModTime().Unix()); err != nil {
+		logger.Error().Err(err).Msgf("cannot mark record of '%s' as linked", file.Path)
+	}
+	return true
+}
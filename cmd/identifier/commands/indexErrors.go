@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+var dbFolderIndexErrorsFlag string
+var indexErrorsOutputFlags = &outputFlags{}
+var prefixIndexErrorsFlag string
+var sourceIndexErrorsFlag string
+
+var fieldsIndexErrors = []string{"source", "path", "action", "attempts", "first", "last", "message"}
+var typesIndexErrors = identifier.FieldTypes{"attempts": identifier.FieldInt, "first": identifier.FieldTime, "last": identifier.FieldTime}
+
+var indexErrorsCmd = &cobra.Command{
+	Use:     "errors [path to data]",
+	Aliases: []string{},
+	Short:   "list the files, which could not be indexed",
+	Long: `list the files, which could not be indexed
+Every failure of the index run is recorded in the database with the failing action, the error message,
+the number of attempts and the time of the first and the last attempt.
+The record is removed as soon as the file has been indexed successfully (i.e. with 'index retry').
+A source can be selected by --source or by its location.
+`,
+	Example: `list the failures of the last index run
+
+` + appname + ` index errors C:/daten/aiptest --database c:\temp\indexerbadger`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  doindexErrors,
+}
+
+func indexErrorsInit() {
+	indexErrorsCmd.Flags().StringVar(&dbFolderIndexErrorsFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	addOutputFlags(indexErrorsCmd, indexErrorsOutputFlags, "errors")
+	indexErrorsCmd.Flags().StringVar(&prefixIndexErrorsFlag, "prefix", "", "folder path prefix")
+	indexErrorsCmd.Flags().StringVar(&sourceIndexErrorsFlag, "source", "", "list only errors of this source")
+	indexErrorsCmd.MarkFlagDirname("database")
+	indexErrorsCmd.MarkFlagRequired("database")
+}
+
+func doindexErrors(cmd *cobra.Command, args []string) {
+	var dataPath string
+	var err error
+	if len(args) > 0 {
+		dataPath = dataLocation(args[0])
+	}
+
+	output, err := indexErrorsOutputFlags.output("errors", fieldsIndexErrors, typesIndexErrors)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot create output")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := output.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close output")
+		}
+	}()
+
+	storeIterator, err := identifier.NewStoreIterator(dbFolderIndexErrorsFlag, true, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot open database")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := storeIterator.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
+		}
+	}()
+
+	sources, err := storeIterator.Sources()
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load sources")
+		defer os.Exit(1)
+		return
+	}
+	source, err := selectSource(sources, sourceIndexErrorsFlag, dataPath)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot select source")
+		defer os.Exit(1)
+		return
+	}
+	indexErrors, err := storeIterator.IndexErrors(sourceID(source))
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load error records")
+		defer os.Exit(1)
+		return
+	}
+	var count int64
+	for _, indexError := range indexErrors {
+		if !strings.HasPrefix(indexError.Path, prefixIndexErrorsFlag) {
+			continue
+		}
+		count++
+		if err := output.Write([]any{
+			indexError.Source,
+			indexError.Path,
+			indexError.Action,
+			indexError.Attempts,
+			time.Unix(indexError.First, 0),
+			time.Unix(indexError.Time, 0),
+			indexError.Message,
+		}, indexError); err != nil {
+			logger.Error().Err(err).Msg("cannot write output")
+		}
+	}
+	fmt.Fprintf(indexErrorsOutputFlags.info(), "#%d files could not be indexed\n", count)
+	return
+}
@@ -14,21 +14,22 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var csvIndexFolderFlag string
-var jsonlIndexFolderFlag string
-var xlsxIndexFolderFlag string
-var consoleIndexFolderFlag bool
+var indexFoldersOutputFlags = &outputFlags{}
 var prefixIndexFolderFlag string
 var dbIndexFolderFlag string
+var sourceIndexFolderFlag string
+var whereIndexFolderFlag string
 
 // var fields = []string{"path", "folder", "basename", "size", "lastmod", "duplicate", "mimetype", "pronom", "type", "subtype", "checksum", "width", "height", "duration"}
 var folderFields = []string{"Files", "Folders", "Bytes", "Size", "Path"}
+var folderTypes = identifier.FieldTypes{"Files": identifier.FieldInt, "Folders": identifier.FieldInt, "Bytes": identifier.FieldInt}
 var indexFoldersCmd = &cobra.Command{
 	Use:     "folders",
 	Aliases: []string{},
 	Short:   "get folder statistics from database",
 	Long: `get folder statistics from database
-`,
+If the database contains several sources and none is selected by --source, every source is a top level folder.
+` + whereHelp,
 	Example: `Show folder and type statistics
 Show logging entries up to WARN level.
 
@@ -49,7 +50,7 @@ Show logging entries up to WARN level.
 List duplicatres metadata to csv and jsonl file and show them on console.
 Show logging entries up to INFO level.
 
-` + appname + ` --log-level INFO index list --database c:\temp\indexerbadger --jsonl c:/temp/identify.jsonl --csv c:/temp/identify.csv --console --duplicates
+` + appname + ` --log-level INFO index list --database c:\temp\indexerbadger --out jsonl:c:/temp/identify.jsonl --out csv:c:/temp/identify.csv --console --duplicates
 #including duplicate files
 2025-03-13T18:08:39+01:00 INF All 4 tables opened in 1ms
  timestamp="2025-03-13 18:08:39.2911666 +0100 CET m=+0.111345601"
@@ -70,21 +71,28 @@ Level 0 [ ]: NumTables: 03. Size: 68 KiB of 0 B. Score: 0.00->0.00 StaleData: 0
 }
 
 func indexFoldersInit() {
-	indexFoldersCmd.Flags().StringVar(&csvIndexFolderFlag, "csv", "", "write folder statistics to csv file")
-	indexFoldersCmd.Flags().StringVar(&jsonlIndexFolderFlag, "jsonl", "", "write folder statistics to jsonl file")
-	indexFoldersCmd.Flags().StringVar(&xlsxIndexFolderFlag, "xlsx", "", "write folder statistics to xlsx file (needs memory)")
-	indexFoldersCmd.Flags().BoolVar(&consoleIndexFolderFlag, "console", false, "write folder statistics to console")
+	addOutputFlags(indexFoldersCmd, indexFoldersOutputFlags, "folder statistics")
 	indexFoldersCmd.Flags().StringVar(&prefixIndexFolderFlag, "prefix", "", "folder path prefix")
-	indexFoldersCmd.Flags().StringVar(&dbIndexFolderFlag, "database", "", "folder for database (must already exist)")
+	indexFoldersCmd.Flags().StringVar(&dbIndexFolderFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	indexFoldersCmd.Flags().StringVar(&sourceIndexFolderFlag, "source", "", "folder statistics of this source only")
+	indexFoldersCmd.Flags().StringVar(&whereIndexFolderFlag, "where", "", "filter expression (i.e. 'size > 10MB && lastmod < 2010-01-01')")
 	indexFoldersCmd.MarkFlagDirname("database")
 	indexFoldersCmd.MarkFlagRequired("database")
-	indexFoldersCmd.MarkFlagFilename("jsonl", "jsonl", "json")
-	indexFoldersCmd.MarkFlagFilename("csv", "csv")
-	indexFoldersCmd.MarkFlagFilename("xlsx", "xlsx")
 }
 
 func doindexFolders(cmd *cobra.Command, args []string) {
-	output, err := identifier.NewOutput(false, csvIndexFolderFlag, jsonlIndexFolderFlag, xlsxIndexFolderFlag, "folders", folderFields, logger)
+	where, err := identifier.ParseWhere(whereIndexFolderFlag)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot parse filter expression")
+		defer os.Exit(1)
+		return
+	}
+	if err := indexFoldersOutputFlags.check(indexFoldersOutputFlags.specs()); err != nil {
+		logger.Error().Err(err).Msg("invalid output")
+		defer os.Exit(1)
+		return
+	}
+	output, err := identifier.NewOutput(indexFoldersOutputFlags.specs(), "folders", folderFields, folderTypes, logger)
 	if err != nil {
 		logger.Error().Err(err).Msg("cannot create output")
 		defer os.Exit(1)
@@ -96,24 +104,40 @@ func doindexFolders(cmd *cobra.Command, args []string) {
 		}
 	}()
 
-	badgerIterator, err := identifier.NewBadgerIterator(dbIndexFolderFlag, true, logger)
+	storeIterator, err := identifier.NewStoreIterator(dbIndexFolderFlag, true, logger)
 	if err != nil {
-		logger.Error().Err(err).Msg("cannot create badger reader")
+		logger.Error().Err(err).Msg("cannot open database")
 		defer os.Exit(1)
 		return
 	}
 	defer func() {
-		if err := badgerIterator.Close(); err != nil {
-			logger.Error().Err(err).Msg("cannot close badger reader")
+		if err := storeIterator.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
 		}
 	}()
 
+	sources, err := storeIterator.Sources()
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load sources")
+		defer os.Exit(1)
+		return
+	}
+	source, err := selectSource(sources, sourceIndexFolderFlag, "")
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot select source")
+		defer os.Exit(1)
+		return
+	}
+
 	var folders = identifier.NewPathElement("", true, 0, nil)
-	if err := badgerIterator.IterateIndex(prefixIndexFolderFlag, func(fData *identifier.FileData) (remove bool, err error) {
-		if fData.Basename == "" || fData.Indexer == nil {
+	if err := storeIterator.IterateFiles(sourceID(source), prefixIndexFolderFlag, func(fData *identifier.FileData) (remove bool, err error) {
+		if fData.Basename == "" || fData.Indexer == nil || !where.Match(fData) {
 			return false, nil
 		}
 		pathStr := path.Clean(filepath.ToSlash(fData.Path))
+		if source == nil && len(sources) > 1 {
+			pathStr = path.Join(fData.Source, pathStr)
+		}
 		pathParts := strings.Split(pathStr, "/")
 		curr := folders
 		for _, pathPart := range pathParts {
@@ -131,7 +155,7 @@ func doindexFolders(cmd *cobra.Command, args []string) {
 		}
 		return false, nil
 	}); err != nil {
-		logger.Error().Err(err).Msg("cannot iterate badger")
+		logger.Error().Err(err).Msg("cannot iterate database")
 	}
 	tw := table.NewWriter()
 	header := table.Row{}
@@ -162,7 +186,7 @@ func doindexFolders(cmd *cobra.Command, args []string) {
 	tw.SetIndexColumn(5)
 	tw.SetColumnConfigs([]table.ColumnConfig{{Number: 4, Align: text.AlignRight, AlignHeader: text.AlignRight}})
 	tw.SetTitle("Folder statistics")
-	if consoleIndexFolderFlag {
+	if indexFoldersOutputFlags.console {
 		fmt.Println(tw.Render())
 	}
 	return
@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+var dbFolderIndexHistoryFlag string
+var indexHistoryOutputFlags = &outputFlags{}
+var sourceIndexHistoryFlag string
+
+var typesIndexHistory = identifier.FieldTypes{"version": identifier.FieldInt, "archived": identifier.FieldTime, "lastseen": identifier.FieldTime, "size": identifier.FieldInt, "lastmod": identifier.FieldTime}
+
+var indexHistoryCmd = &cobra.Command{
+	Use:     "history [path of file]",
+	Aliases: []string{},
+	Short:   "show the timeline of checksums, formats and sizes of a file",
+	Long: `show the timeline of checksums, formats and sizes of a file
+Index runs with --history archive the former record of a file, whose size or modification time has changed,
+before it is replaced. This command lists the archived records, oldest first, followed by the current record, which has no archived time.
+The path is relative to the data root of the source, which can be selected by --source.
+`,
+	Example: `show the history of a file
+
+` + appname + ` index history aip/data/report.pdf --database c:\temp\indexerbadger`,
+	Args: cobra.ExactArgs(1),
+	Run:  doindexHistory,
+}
+
+func indexHistoryInit() {
+	indexHistoryCmd.Flags().StringVar(&dbFolderIndexHistoryFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	addOutputFlags(indexHistoryCmd, indexHistoryOutputFlags, "history")
+	indexHistoryCmd.Flags().StringVar(&sourceIndexHistoryFlag, "source", "", "source of the file")
+	indexHistoryCmd.MarkFlagDirname("database")
+	indexHistoryCmd.MarkFlagRequired("database")
+}
+
+func doindexHistory(cmd *cobra.Command, args []string) {
+	store, err := identifier.OpenStore(dbFolderIndexHistoryFlag, true, logger)
+	if err != nil {
+		logger.Error().Err(err).Msgf("cannot open database '%s'", dbFolderIndexHistoryFlag)
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
+		}
+	}()
+
+	sources, err := identifier.LoadSources(store)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load sources")
+		defer os.Exit(1)
+		return
+	}
+	source, err := singleSource(sources, sourceIndexHistoryFlag, "")
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot select source")
+		defer os.Exit(1)
+		return
+	}
+	digests, err := identifier.LoadDigests(store)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load digest algorithms")
+		defer os.Exit(1)
+		return
+	}
+
+	path := args[0]
+	entries, err := identifier.LoadHistory(store, source.ID, path)
+	if err != nil {
+		logger.Error().Err(err).Msgf("cannot load history of '%s'", path)
+		defer os.Exit(1)
+		return
+	}
+	current, err := identifier.LoadFileData(store, source.ID, path)
+	if err != nil {
+		logger.Error().Err(err).Msgf("cannot load record of '%s'", path)
+		defer os.Exit(1)
+		return
+	}
+	if current != nil {
+		entries = append(entries, &identifier.HistoryEntry{FileData: current})
+	}
+	if len(entries) == 0 {
+		logger.Error().Msgf("no record of '%s' in source '%s'", path, source.ID)
+		defer os.Exit(1)
+		return
+	}
+
+	fields := []string{"version", "archived", "lastseen", "size", "lastmod", "mimetype", "pronom"}
+	for _, digest := range digests {
+		fields = append(fields, string(digest))
+	}
+	output, err := indexHistoryOutputFlags.output("history", fields, typesIndexHistory)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot create output")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := output.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close output")
+		}
+	}()
+
+	fmt.Fprintf(indexHistoryOutputFlags.info(), "#history of %s:%s\n", source.ID, path)
+	for i, entry := range entries {
+		// the current record is not archived
+		var archived any
+		if entry.Archived != 0 {
+			archived = time.Unix(entry.Archived, 0)
+		}
+		var mimetype, pronom string
+		var checksums = map[string]string{}
+		if entry.Indexer != nil {
+			mimetype, pronom, checksums = entry.Indexer.Mimetype, entry.Indexer.Pronom, entry.Indexer.Checksum
+		}
+		record := []any{i + 1, archived, time.Unix(entry.LastSeen, 0), entry.Size, time.Unix(entry.LastMod, 0), mimetype, pronom}
+		for _, digest := range digests {
+			record = append(record, checksums[string(digest)])
+		}
+		if err := output.Write(record, entry); err != nil {
+			logger.Error().Err(err).Msg("cannot write output")
+		}
+	}
+	fmt.Fprintf(indexHistoryOutputFlags.info(), "#%d versions\n", len(entries))
+	return
+}
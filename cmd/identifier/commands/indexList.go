@@ -3,8 +3,6 @@ package commands
 import (
 	"fmt"
 	"os"
-	"path/filepath"
-	"regexp"
 
 	"emperror.dev/errors"
 	"github.com/je4/utils/v2/pkg/checksum"
@@ -12,41 +10,45 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var csvIndexListFlag string
-var jsonlIndexListFlag string
-var xlsxIndexListFlag string
+var indexListOutputFlags = &outputFlags{}
 var dbFolderIndexListFlag string
 var emptyIndexListFlag bool
 var regexpIndexListFlag string
 var duplicatesIndexListFlag bool
 var prefixIndexListFlag string
 var removeIndexListFlag bool
-var consoleIndexListFlag bool
-
-var fieldsIndexList = []string{"path", "folder", "basename", "size", "lastmod", "duplicate", "mimetype", "pronom", "type", "subtype", "checksum", "width", "height", "duration"}
+var digestIndexListFlag []string
+var sourceIndexListFlag string
+var pronomIndexListFlag string
+var mimeIndexListFlag string
+var whereIndexListFlag string
 
 var indexListCmd = &cobra.Command{
 	Use:     "list [path to data]",
 	Aliases: []string{},
 	Short:   "get technical metadata from database",
 	Long: `get technical metadata from database
-`,
+A single source can be selected by --source or by its location (path to data).
+With --pronom or --mime only the matching files are read from the database (secondary index).
+` + whereHelp + outputHelp,
 	Example: ``,
 	Args:    cobra.MaximumNArgs(1),
 	Run:     doindexList,
 }
 
 func indexListInit() {
-	indexListCmd.Flags().StringVar(&dbFolderIndexListFlag, "database", "", "folder for database (must already exist)")
-	indexListCmd.Flags().StringVar(&csvIndexListFlag, "csv", "", "write indexList to csv file")
-	indexListCmd.Flags().StringVar(&jsonlIndexListFlag, "jsonl", "", "write indexList to jsonl file")
-	indexListCmd.Flags().StringVar(&xlsxIndexListFlag, "xlsx", "", "write indexList to xlsx file (needs memory)")
+	indexListCmd.Flags().StringVar(&dbFolderIndexListFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	addOutputFlags(indexListCmd, indexListOutputFlags, "records")
 	indexListCmd.Flags().BoolVar(&emptyIndexListFlag, "empty", false, "include empty files")
 	indexListCmd.Flags().StringVar(&regexpIndexListFlag, "regexp", "", "include files matching regular expression")
 	indexListCmd.Flags().BoolVar(&duplicatesIndexListFlag, "duplicates", false, "include duplicate files")
 	indexListCmd.Flags().StringVar(&prefixIndexListFlag, "prefix", "", "folder path prefix")
-	indexListCmd.Flags().BoolVar(&removeIndexListFlag, "remove", false, "remove included files - requires at least one of empty, duplicate or regexp flag")
-	indexListCmd.Flags().BoolVar(&consoleIndexListFlag, "console", false, "write index to console")
+	indexListCmd.Flags().BoolVar(&removeIndexListFlag, "remove", false, "remove included files - requires at least one of empty or regexp flag")
+	indexListCmd.Flags().StringSliceVar(&digestIndexListFlag, "digest", nil, "checksum columns to be written (default: all algorithms stored in database)")
+	indexListCmd.Flags().StringVar(&sourceIndexListFlag, "source", "", "list only files of this source")
+	indexListCmd.Flags().StringVar(&pronomIndexListFlag, "pronom", "", "include files with this pronom id (i.e. fmt/43)")
+	indexListCmd.Flags().StringVar(&mimeIndexListFlag, "mime", "", "include files with this mime type (i.e. application/pdf)")
+	indexListCmd.Flags().StringVar(&whereIndexListFlag, "where", "", "filter expression (i.e. 'size > 10MB && lastmod < 2010-01-01')")
 	indexListCmd.MarkFlagRequired("database")
 }
 
@@ -54,106 +56,136 @@ func doindexList(cmd *cobra.Command, args []string) {
 	var dataPath string
 	var err error
 	if len(args) > 0 {
-		dataPath, err = identifier.Fullpath(args[0])
-		cobra.CheckErr(err)
-		if fi, err := os.Stat(dataPath); err != nil || !fi.IsDir() {
-			cobra.CheckErr(errors.Errorf("'%s' is not a directory", dataPath))
-		}
+		dataPath = dataLocation(args[0])
 	}
-	if removeIndexListFlag && dataPath == "" {
-		logger.Error().Msg("remove flag requires path to data")
+	if removeIndexListFlag && duplicatesIndexListFlag {
+		logger.Error().Msg("remove flag cannot be combined with duplicates flag - use 'index duplicates --remove' to keep one copy of every duplicate")
 		defer os.Exit(1)
 		return
 	}
-	if removeIndexListFlag && !(emptyIndexListFlag || duplicatesIndexListFlag || regexpIndexListFlag != "") {
-		logger.Error().Msg("remove flag requires at least one of empty, duplicate or regexp flag")
+	filter, err := newFileFilter(emptyIndexListFlag, duplicatesIndexListFlag, regexpIndexListFlag, whereIndexListFlag)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot create filter")
 		defer os.Exit(1)
 		return
 	}
-
-	var regex *regexp.Regexp
-	if regexpIndexListFlag != "" {
-		regex, err = regexp.Compile(regexpIndexListFlag)
-		if err != nil {
-			logger.Error().Err(err).Msgf("cannot compile regular expression '%s'", regexpIndexListFlag)
-			defer os.Exit(1)
-			return
-		}
-		fmt.Printf("#including regexp \"%s\"\n", regexpIndexListFlag)
-	}
-	if emptyIndexListFlag {
-		fmt.Println("#including empty files")
+	// removing by duplicate flag would delete every copy of a group
+	if removeIndexListFlag && filter.where.Uses("duplicate") {
+		logger.Error().Msg("remove flag cannot be combined with a filter on 'duplicate' - use 'index duplicates --remove' to keep one copy of every duplicate")
+		defer os.Exit(1)
+		return
 	}
-	if duplicatesIndexListFlag {
-		fmt.Println("#including duplicate files")
+	if removeIndexListFlag && !(filter.selective() || pronomIndexListFlag != "" || mimeIndexListFlag != "") {
+		logger.Error().Msg("remove flag requires at least one of empty, duplicate, regexp, where, pronom or mime flag")
+		defer os.Exit(1)
+		return
 	}
+
+	filter.print(indexListOutputFlags.info())
 	if prefixIndexListFlag != "" {
-		fmt.Printf("#including prefix \"%s\"\n", prefixIndexListFlag)
+		fmt.Fprintf(indexListOutputFlags.info(), "#including prefix \"%s\"\n", prefixIndexListFlag)
 	}
-	if !emptyIndexListFlag && !duplicatesIndexListFlag && regexpIndexListFlag == "" {
-		fmt.Println("#including all files")
+	if pronomIndexListFlag != "" {
+		fmt.Fprintf(indexListOutputFlags.info(), "#including pronom \"%s\"\n", pronomIndexListFlag)
+	}
+	if mimeIndexListFlag != "" {
+		fmt.Fprintf(indexListOutputFlags.info(), "#including mime type \"%s\"\n", mimeIndexListFlag)
 	}
 	if removeIndexListFlag {
-		fmt.Println("#removing files")
+		fmt.Fprintln(indexListOutputFlags.info(), "#removing files")
 	}
-	output, err := identifier.NewOutput(consoleIndexListFlag || (csvIndexListFlag == "" && jsonlIndexListFlag == "" && xlsxIndexListFlag == ""), csvIndexListFlag, jsonlIndexListFlag, xlsxIndexListFlag, "list", fieldsIndexList, logger)
+
+	storeIterator, err := identifier.NewStoreIterator(dbFolderIndexListFlag, !removeIndexListFlag, logger)
 	if err != nil {
-		logger.Error().Err(err).Msg("cannot create output")
+		logger.Error().Err(err).Msg("cannot open database")
 		defer os.Exit(1)
 		return
 	}
 	defer func() {
-		if err := output.Close(); err != nil {
-			logger.Error().Err(err).Msg("cannot close output")
+		if err := storeIterator.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
 		}
 	}()
 
-	badgerIterator, err := identifier.NewBadgerIterator(dbFolderIndexListFlag, !removeIndexListFlag, logger)
+	var digests []checksum.DigestAlgorithm
+	if len(digestIndexListFlag) > 0 {
+		digests, err = parseDigests(digestIndexListFlag)
+	} else {
+		digests, err = storeIterator.Digests()
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot determine checksum algorithms")
+		defer os.Exit(1)
+		return
+	}
+
+	sources, err := storeIterator.Sources()
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load sources")
+		defer os.Exit(1)
+		return
+	}
+	source, err := selectSource(sources, sourceIndexListFlag, dataPath)
 	if err != nil {
-		logger.Error().Err(err).Msg("cannot create badger reader")
+		logger.Error().Err(err).Msg("cannot select source")
+		defer os.Exit(1)
+		return
+	}
+	sourceFSs := newSourceFS(sources)
+	defer sourceFSs.Close()
+
+	output, err := indexListOutputFlags.output("list", append([]string{"source"}, identifier.FileFields(digests)...), identifier.FileFieldTypes)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot create output")
 		defer os.Exit(1)
 		return
 	}
 	defer func() {
-		if err := badgerIterator.Close(); err != nil {
-			logger.Error().Err(err).Msg("cannot close badger reader")
+		if err := output.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close output")
 		}
 	}()
 
-	if err := badgerIterator.IterateIndex(prefixIndexFolderFlag, func(fData *identifier.FileData) (remove bool, err error) {
+	// the secondary indexes select the matching files without reading all records
+	iterate := func(do func(fData *identifier.FileData) (remove bool, err error)) error {
+		return storeIterator.IterateFiles(sourceID(source), prefixIndexListFlag, do)
+	}
+	if pronomIndexListFlag != "" {
+		iterate = func(do func(fData *identifier.FileData) (remove bool, err error)) error {
+			return storeIterator.IterateIndexed(identifier.IndexPronom, pronomIndexListFlag, sourceID(source), prefixIndexListFlag, do)
+		}
+	} else if mimeIndexListFlag != "" {
+		iterate = func(do func(fData *identifier.FileData) (remove bool, err error)) error {
+			return storeIterator.IterateIndexed(identifier.IndexMime, mimeIndexListFlag, sourceID(source), prefixIndexListFlag, do)
+		}
+	}
+	if err := iterate(func(fData *identifier.FileData) (remove bool, err error) {
 		if fData.Basename == "" || fData.Indexer == nil {
 			return false, nil
 		}
+		if (pronomIndexListFlag != "" && fData.Indexer.Pronom != pronomIndexListFlag) ||
+			(mimeIndexListFlag != "" && fData.Indexer.Mimetype != mimeIndexListFlag) {
+			return false, nil
+		}
 
-		var hit bool
-		hit = (emptyIndexListFlag && fData.Size == 0) ||
-			(duplicatesIndexListFlag && fData.Duplicate) ||
-			(regex != nil && regex.MatchString(fData.Basename)) ||
-			(!emptyIndexListFlag && !duplicatesIndexListFlag && regex == nil)
-		if hit {
-			if err := output.Write([]any{
-				fData.Path,
-				fData.Folder,
-				fData.Basename,
-				fData.Size,
-				fData.LastMod,
-				fData.Duplicate,
-				fData.Indexer.Mimetype,
-				fData.Indexer.Pronom,
-				fData.Indexer.Type,
-				fData.Indexer.Subtype,
-				fData.Indexer.Checksum[string(checksum.DigestSHA512)],
-				fData.Indexer.Width,
-				fData.Indexer.Height,
-				fData.Indexer.Duration},
-				fData); err != nil {
+		if filter.match(fData) {
+			record := append([]any{fData.Source}, identifier.FileRecord(fData, digests)...)
+			if err := output.Write(record, fData); err != nil {
 				return false, errors.Wrapf(err, "cannot write output")
 			}
 			if removeIndexListFlag {
-				fullpath := filepath.Join(dataPath, fData.Path)
-				logger.Info().Msgf("removing file '%s'", fullpath)
-				if err := os.Remove(fullpath); err != nil {
-					logger.Error().Err(err).Msgf("cannot remove file '%s'", fullpath)
+				if fData.Container != "" {
+					logger.Warn().Msgf("cannot remove '%s' inside of container '%s'", fData.Path, fData.Container)
+					return false, nil
+				}
+				dataFS, err := sourceFSs.get(fData.Source)
+				if err != nil {
+					logger.Warn().Err(err).Msgf("cannot remove '%s'", fData.Path)
+					return false, nil
+				}
+				logger.Info().Msgf("removing file '%s' of source '%s'", fData.Path, fData.Source)
+				if err := dataFS.Remove(fData.Path); err != nil {
+					logger.Error().Err(err).Msgf("cannot remove file '%s' of source '%s'", fData.Path, fData.Source)
 					// return false, errors.Wrapf(err, "cannot remove file '%s'", fData.Path)
 					return true, nil
 				}
@@ -162,7 +194,7 @@ func doindexList(cmd *cobra.Command, args []string) {
 		}
 		return false, nil
 	}); err != nil {
-		logger.Error().Err(err).Msg("cannot iterate badger")
+		logger.Error().Err(err).Msg("cannot iterate database")
 	}
 	return
 }
@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+var indexPruneOutputFlags = &outputFlags{}
+var dbFolderIndexPruneFlag string
+var prefixIndexPruneFlag string
+var beforeIndexPruneFlag string
+var removeIndexPruneFlag bool
+var sourceIndexPruneFlag string
+var whereIndexPruneFlag string
+
+var fieldsIndexPrune = []string{"key", "source", "path", "size", "lastmod", "lastseen"}
+var typesIndexPrune = identifier.FieldTypes{"size": identifier.FieldInt, "lastmod": identifier.FieldTime, "lastseen": identifier.FieldTime}
+
+var indexPruneCmd = &cobra.Command{
+	Use:     "prune",
+	Aliases: []string{},
+	Short:   "list and remove records of files, which have not been seen in the last index run",
+	Long: `list and remove records of files, which have not been seen in the last index run
+Every index run stamps the records of all files found with its start time. Records with an older timestamp belong to
+files, which have been deleted or moved since.
+By default the start time of the last index run of every source is used as reference. If this run has been interrupted,
+the records are incomplete and --before is required. Sources without index run checkpoint (older databases) need --before.
+
+Caveat: dry-run (no --remove flag) is always recommended before removing records from database.
+` + whereHelp,
+	Example: `list all records, which have not been seen in the last index run
+
+` + appname + ` index prune --database c:\temp\indexerbadger
+
+remove all records, which have not been seen since 2025-03-01
+
+` + appname + ` index prune --database c:\temp\indexerbadger --before 2025-03-01 --remove`,
+	Args: cobra.NoArgs,
+	Run:  doindexPrune,
+}
+
+func indexPruneInit() {
+	indexPruneCmd.Flags().StringVar(&dbFolderIndexPruneFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	addOutputFlags(indexPruneCmd, indexPruneOutputFlags, "stale records")
+	indexPruneCmd.Flags().StringVar(&prefixIndexPruneFlag, "prefix", "", "folder path prefix")
+	indexPruneCmd.Flags().StringVar(&beforeIndexPruneFlag, "before", "", "records not seen since this time are stale (RFC3339 or YYYY-MM-DD, default is start of last index run)")
+	indexPruneCmd.Flags().BoolVar(&removeIndexPruneFlag, "remove", false, "removes the stale records from database (if not set it's just a dry run)")
+	indexPruneCmd.Flags().StringVar(&sourceIndexPruneFlag, "source", "", "prune only records of this source")
+	indexPruneCmd.Flags().StringVar(&whereIndexPruneFlag, "where", "", "prune only stale records matching the filter expression")
+	indexPruneCmd.MarkFlagDirname("database")
+	indexPruneCmd.MarkFlagRequired("database")
+}
+
+func parseTimeFlag(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("cannot parse time '%s'", value)
+}
+
+func doindexPrune(cmd *cobra.Command, args []string) {
+	where, err := identifier.ParseWhere(whereIndexPruneFlag)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot parse filter expression")
+		defer os.Exit(1)
+		return
+	}
+	output, err := indexPruneOutputFlags.output("prune", fieldsIndexPrune, typesIndexPrune)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot create output")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := output.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close output")
+		}
+	}()
+
+	storeIterator, err := identifier.NewStoreIterator(dbFolderIndexPruneFlag, !removeIndexPruneFlag, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot open database")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := storeIterator.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
+		}
+	}()
+
+	sources, err := storeIterator.Sources()
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load sources")
+		defer os.Exit(1)
+		return
+	}
+	source, err := selectSource(sources, sourceIndexPruneFlag, "")
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot select source")
+		defer os.Exit(1)
+		return
+	}
+
+	// reference time per source
+	var before = map[string]int64{}
+	if beforeIndexPruneFlag != "" {
+		t, err := parseTimeFlag(beforeIndexPruneFlag)
+		if err != nil {
+			logger.Error().Err(err).Msg("invalid --before flag")
+			defer os.Exit(1)
+			return
+		}
+		for _, source := range sources {
+			before[source.ID] = t.Unix()
+		}
+		fmt.Fprintf(indexPruneOutputFlags.info(), "#records not seen since %s\n", t.Format(time.RFC3339))
+	} else {
+		// the start time of the last finished index run of every source
+		for _, s := range sources {
+			if source != nil && s.ID != source.ID {
+				continue
+			}
+			t, err := identifier.PruneTime(storeIterator.Store(), s.ID)
+			if err != nil {
+				logger.Error().Err(err).Msg("cannot determine stale records - use --before")
+				defer os.Exit(1)
+				return
+			}
+			if t == 0 {
+				fmt.Fprintf(indexPruneOutputFlags.info(), "#no index run of source '%s' found\n", s.ID)
+				continue
+			}
+			before[s.ID] = t
+			fmt.Fprintf(indexPruneOutputFlags.info(), "#records of source '%s' not seen since %s\n", s.ID, time.Unix(t, 0).Format(time.RFC3339))
+		}
+		if len(before) == 0 {
+			return
+		}
+	}
+	if removeIndexPruneFlag {
+		fmt.Fprintln(indexPruneOutputFlags.info(), "#removing records")
+	}
+
+	var count, size int64
+	if err := storeIterator.IterateFiles(sourceID(source), prefixIndexPruneFlag, func(fData *identifier.FileData) (remove bool, err error) {
+		if fData.LastSeen >= before[fData.Source] || !where.Match(fData) {
+			return false, nil
+		}
+		count++
+		size += fData.Size
+		if err := output.Write([]any{
+			string(identifier.FileKey(fData.Source, fData.Path)),
+			fData.Source,
+			fData.Path,
+			fData.Size,
+			time.Unix(fData.LastMod, 0),
+			time.Unix(fData.LastSeen, 0),
+		}, fData); err != nil {
+			return false, errors.Wrapf(err, "cannot write output")
+		}
+		return removeIndexPruneFlag, nil
+	}); err != nil {
+		logger.Error().Err(err).Msg("cannot iterate database")
+	}
+	logger.Info().Msgf("%d stale records with %d bytes", count, size)
+	return
+}
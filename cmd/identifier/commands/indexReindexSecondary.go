@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+var dbFolderIndexReindexSecondaryFlag string
+
+var indexReindexSecondaryCmd = &cobra.Command{
+	Use:     "reindex-secondary",
+	Aliases: []string{},
+	Short:   "rebuild the secondary indexes of the database",
+	Long: `rebuild the secondary indexes of the database
+The secondary indexes (checksum, pronom and mime type) are maintained together with the file records.
+They allow lookups (i.e. 'index list --pronom fmt/43'), duplicate groups and statistics without reading all records.
+This command removes the secondary indexes and creates them from the file records.
+Databases of older versions get their secondary indexes with 'db migrate'.
+`,
+	Example: `rebuild the secondary indexes
+
+` + appname + ` index reindex-secondary --database c:\temp\indexerbadger`,
+	Args: cobra.NoArgs,
+	Run:  doindexReindexSecondary,
+}
+
+func indexReindexSecondaryInit() {
+	indexReindexSecondaryCmd.Flags().StringVar(&dbFolderIndexReindexSecondaryFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	indexReindexSecondaryCmd.MarkFlagDirname("database")
+	indexReindexSecondaryCmd.MarkFlagRequired("database")
+}
+
+func doindexReindexSecondary(cmd *cobra.Command, args []string) {
+	store, err := identifier.OpenStore(dbFolderIndexReindexSecondaryFlag, false, logger)
+	if err != nil {
+		logger.Error().Err(err).Msgf("cannot open database '%s'", dbFolderIndexReindexSecondaryFlag)
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
+		}
+	}()
+
+	count, err := identifier.RebuildSecondary(store, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot rebuild secondary indexes")
+		defer os.Exit(1)
+		return
+	}
+	fmt.Printf("#secondary indexes of %d files created\n", count)
+	return
+}
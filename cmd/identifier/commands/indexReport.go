@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"emperror.dev/errors"
+	human "github.com/dustin/go-humanize"
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+var dbFolderIndexReportFlag string
+var sourceIndexReportFlag string
+var prefixIndexReportFlag string
+var whereIndexReportFlag string
+var digestIndexReportFlag string
+var xlsxIndexReportFlag string
+var htmlIndexReportFlag string
+var limitIndexReportFlag int
+
+var indexReportCmd = &cobra.Command{
+	Use:     "report [path to data]",
+	Aliases: []string{},
+	Short:   "write a collection report",
+	Long: `write a collection report
+With --xlsx a workbook with the sheets summary, files, folders, pronom, mime, duplicates, empty files and ai
+descriptions is written. The sheets have filters and frozen header rows, sizes are given in bytes and human readable.
+The folders are linked to their first file in the files sheet.
+The workbook is streamed to the file, sheets with more than 1048576 rows are continued on additional sheets.
+With --html a single html file without external resources is written. It contains charts of the pronom and mime
+formats, the collapsible folder tree with the ai titles and descriptions and the tables of the duplicates and
+unidentified files, which are cut after --limit rows.
+A single source can be selected by --source or by its location (path to data).
+` + whereHelp,
+	Example: `write the report of all files in the folder 'payload'
+
+` + appname + ` index report --database c:\temp\indexerbadger --prefix payload/ --xlsx c:\temp\report.xlsx
+
+write the report of source 'archive' as xlsx and html
+
+` + appname + ` index report --database c:\temp\indexerbadger --source archive --xlsx c:\temp\report.xlsx --html c:\temp\report.html`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  doindexReport,
+}
+
+func indexReportInit() {
+	indexReportCmd.Flags().StringVar(&dbFolderIndexReportFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	indexReportCmd.Flags().StringVar(&sourceIndexReportFlag, "source", "", "report only files of this source")
+	indexReportCmd.Flags().StringVar(&prefixIndexReportFlag, "prefix", "", "folder path prefix")
+	indexReportCmd.Flags().StringVar(&whereIndexReportFlag, "where", "", "report only files matching the filter expression")
+	indexReportCmd.Flags().StringVar(&digestIndexReportFlag, "duplicate-digest", "", "checksum algorithm for duplicate detection (default from config)")
+	indexReportCmd.Flags().StringVar(&xlsxIndexReportFlag, "xlsx", "", "write the report to xlsx file")
+	indexReportCmd.Flags().StringVar(&htmlIndexReportFlag, "html", "", "write the report to html file")
+	indexReportCmd.Flags().IntVar(&limitIndexReportFlag, "limit", 1000, "maximum number of rows of the duplicates and unidentified files tables in the html report (0 for no limit)")
+	indexReportCmd.MarkFlagDirname("database")
+	indexReportCmd.MarkFlagRequired("database")
+	indexReportCmd.MarkFlagFilename("xlsx", "xlsx")
+	indexReportCmd.MarkFlagFilename("html", "html", "htm")
+}
+
+func doindexReport(cmd *cobra.Command, args []string) {
+	var dataPath string
+	if len(args) > 0 {
+		dataPath = dataLocation(args[0])
+	}
+	if xlsxIndexReportFlag == "" && htmlIndexReportFlag == "" {
+		logger.Error().Msg("no report format given - use --xlsx or --html")
+		defer os.Exit(1)
+		return
+	}
+	where, err := identifier.ParseWhere(whereIndexReportFlag)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot parse filter expression")
+		defer os.Exit(1)
+		return
+	}
+	digest := conf.DuplicateDigest
+	if digestIndexReportFlag != "" {
+		digests, err := parseDigests([]string{digestIndexReportFlag})
+		if err != nil {
+			logger.Error().Err(err).Msg("invalid --duplicate-digest flag")
+			defer os.Exit(1)
+			return
+		}
+		digest = digests[0]
+	}
+
+	storeIterator, err := identifier.NewStoreIterator(dbFolderIndexReportFlag, true, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot open database")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := storeIterator.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
+		}
+	}()
+
+	sources, err := storeIterator.Sources()
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load sources")
+		defer os.Exit(1)
+		return
+	}
+	source, err := selectSource(sources, sourceIndexReportFlag, dataPath)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot select source")
+		defer os.Exit(1)
+		return
+	}
+
+	report, err := identifier.NewReport(storeIterator, dbFolderIndexReportFlag, sourceID(source), prefixIndexReportFlag, where, digest)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot create report")
+		defer os.Exit(1)
+		return
+	}
+	fmt.Printf("#%d files (%s) in %d folders\n", report.Files, human.Bytes(uint64(report.Size)), len(report.Folders())-1)
+
+	if xlsxIndexReportFlag != "" {
+		if err := writeIndexReport(xlsxIndexReportFlag, report.WriteXLSX); err != nil {
+			logger.Error().Err(err).Msgf("cannot write xlsx file '%s'", xlsxIndexReportFlag)
+			defer os.Exit(1)
+			return
+		}
+		fmt.Printf("#report written to '%s'\n", xlsxIndexReportFlag)
+	}
+	if htmlIndexReportFlag != "" {
+		if err := writeIndexReport(htmlIndexReportFlag, func(w io.Writer) error { return report.WriteHTML(w, limitIndexReportFlag) }); err != nil {
+			logger.Error().Err(err).Msgf("cannot write html file '%s'", htmlIndexReportFlag)
+			defer os.Exit(1)
+			return
+		}
+		fmt.Printf("#report written to '%s'\n", htmlIndexReportFlag)
+	}
+}
+
+// writeIndexReport creates the file and writes the report with write
+func writeIndexReport(filename string, write func(w io.Writer) error) error {
+	fp, err := os.Create(filename)
+	if err != nil {
+		return errors.Wrapf(err, "cannot create file '%s'", filename)
+	}
+	if err := write(fp); err != nil {
+		fp.Close()
+		return err
+	}
+	return errors.Wrapf(fp.Close(), "cannot close file '%s'", filename)
+}
@@ -0,0 +1,221 @@
+package commands
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/checksum"
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/ocfl-archive/indexer/v3/pkg/util"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+)
+
+var dbFolderIndexRetryFlag string
+var concurrentIndexRetryFlag uint
+var actionsIndexRetryFlag []string
+var duplicateDigestIndexRetryFlag string
+var prefixIndexRetryFlag string
+var sourceIndexRetryFlag string
+var historyIndexRetryFlag bool
+
+var indexRetryCmd = &cobra.Command{
+	Use:     "retry [path to data]",
+	Aliases: []string{},
+	Short:   "index the files again, which could not be indexed",
+	Long: `index the files again, which could not be indexed
+Only the files listed by 'index errors' are processed. Files indexed successfully are removed from the error list,
+files failing again keep their record with an increased number of attempts.
+Records of files, which do not exist anymore, are removed.
+The files are read from the locations of their sources. A source can be selected by --source or by its location.
+`,
+	Example: `retry the failures of the last index run
+
+` + appname + ` index retry C:/daten/aiptest --database c:\temp\indexerbadger`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  doindexRetry,
+}
+
+func indexRetryInit() {
+	indexRetryCmd.Flags().StringVar(&dbFolderIndexRetryFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	indexRetryCmd.Flags().UintVarP(&concurrentIndexRetryFlag, "concurrent", "n", 1, "number of concurrent workers")
+	indexRetryCmd.Flags().StringSliceVar(&actionsIndexRetryFlag, "actions", []string{"siegfried", "xml", "ffprobe", "identify", "json", "tika"}, "actions to be performed")
+	indexRetryCmd.Flags().StringVar(&duplicateDigestIndexRetryFlag, "duplicate-digest", "", "checksum algorithm for duplicate detection (default from config)")
+	indexRetryCmd.Flags().StringVar(&prefixIndexRetryFlag, "prefix", "", "folder path prefix")
+	indexRetryCmd.Flags().StringVar(&sourceIndexRetryFlag, "source", "", "retry only files of this source")
+	indexRetryCmd.Flags().BoolVar(&historyIndexRetryFlag, "history", false, "archive the former record of changed files (see 'index history')")
+	indexRetryCmd.MarkFlagDirname("database")
+	indexRetryCmd.MarkFlagRequired("database")
+}
+
+func doindexRetry(cmd *cobra.Command, args []string) {
+	var dataPath string
+	var err error
+	if len(args) > 0 {
+		dataPath = dataLocation(args[0])
+	}
+
+	store, err := identifier.OpenStore(dbFolderIndexRetryFlag, false, logger)
+	if err != nil {
+		logger.Error().Err(err).Msgf("cannot open database '%s'", dbFolderIndexRetryFlag)
+		defer os.Exit(1)
+		return
+	}
+	defer func(store identifier.Store) {
+		if err := store.Close(); err != nil {
+			logger.Error().Err(err).Msg("error closing database")
+		}
+	}(store)
+
+	sources, err := identifier.LoadSources(store)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load sources")
+		defer os.Exit(1)
+		return
+	}
+	source, err := selectSource(sources, sourceIndexRetryFlag, dataPath)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot select source")
+		defer os.Exit(1)
+		return
+	}
+	indexErrors, err := identifier.LoadIndexErrors(store, sourceID(source))
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load error records")
+		defer os.Exit(1)
+		return
+	}
+	var paths = map[string][]string{}
+	var count int
+	for _, indexError := range indexErrors {
+		if strings.HasPrefix(indexError.Path, prefixIndexRetryFlag) {
+			paths[indexError.Source] = append(paths[indexError.Source], indexError.Path)
+			count++
+		}
+	}
+	if count == 0 {
+		fmt.Printf("#no files to retry\n")
+		return
+	}
+
+	digests, err := identifier.LoadDigests(store)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load digest algorithms")
+		defer os.Exit(1)
+		return
+	}
+	dupDigest := conf.DuplicateDigest
+	if duplicateDigestIndexRetryFlag != "" {
+		dupDigest = checksum.DigestAlgorithm(strings.ToLower(duplicateDigestIndexRetryFlag))
+	}
+	if !checksum.HashExists(dupDigest) {
+		logger.Error().Msgf("unknown duplicate digest algorithm '%s' - use one of %v", dupDigest, checksum.DigestNames)
+		defer os.Exit(1)
+		return
+	}
+	if !slices.Contains(digests, dupDigest) {
+		digests = append(digests, dupDigest)
+	}
+
+	idx, indexerActions, indexerCloser, err := util.InitIndexer(conf.Indexer, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot initialize indexer")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := indexerCloser.Close(); err != nil {
+			logger.Error().Err(err).Msg("error closing indexer")
+		}
+	}()
+	var actions = []string{}
+	for _, action := range actionsIndexRetryFlag {
+		if !slices.Contains(indexerActions, action) {
+			logger.Error().Msgf("'%s' is not a configured indexer action", action)
+			continue
+		}
+		actions = append(actions, action)
+	}
+
+	sourceFSs := newSourceFS(sources)
+	defer sourceFSs.Close()
+	startTime := time.Now().Unix()
+	for _, source := range sources {
+		if len(paths[source.ID]) == 0 {
+			continue
+		}
+		dataFS, err := sourceFSs.get(source.ID)
+		if err != nil {
+			logger.Warn().Err(err).Msgf("cannot open source '%s'", source.ID)
+			continue
+		}
+		logger.Info().Msgf("retrying %d files of source '%s'", len(paths[source.ID]), source.ID)
+		containerFS := identifier.NewContainerFS(dataFS, 255, logger)
+		jobs := make(chan string, 100)
+		results := make(chan *identifier.WorkerResult, 100)
+		var waiter = &sync.WaitGroup{}
+		for w := uint(1); w <= max(concurrentIndexRetryFlag, 1); w++ {
+			go identifier.Worker(
+				cmd.Context(),
+				w,
+				containerFS,
+				source.ID,
+				actions,
+				digests,
+				dupDigest,
+				idx,
+				logger,
+				jobs,
+				results,
+				store,
+				startTime,
+				historyIndexRetryFlag,
+				waiter,
+			)
+		}
+		go func() {
+			for result := range results {
+				if result.Done {
+					logger.Debug().Msgf("result: #%03d: %s done", result.Worker, result.Path)
+				}
+			}
+		}()
+		for _, path := range paths[source.ID] {
+			if _, err := fs.Stat(containerFS, path); errors.Is(err, fs.ErrNotExist) {
+				logger.Info().Msgf("'%s' does not exist anymore", path)
+				if err := identifier.ClearIndexError(store, source.ID, path); err != nil {
+					logger.Error().Err(err).Msgf("cannot remove error record of %s", path)
+				}
+				continue
+			}
+			waiter.Add(1)
+			jobs <- path
+		}
+		waiter.Wait()
+		close(jobs)
+		close(results)
+		if err := containerFS.Close(); err != nil {
+			logger.Error().Err(err).Msg("error closing containers")
+		}
+	}
+
+	remaining, err := identifier.LoadIndexErrors(store, sourceID(source))
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load error records")
+		defer os.Exit(1)
+		return
+	}
+	var failed int
+	for _, indexError := range remaining {
+		if strings.HasPrefix(indexError.Path, prefixIndexRetryFlag) {
+			failed++
+		}
+	}
+	fmt.Printf("#%d files retried, %d files could not be indexed\n", count, failed)
+	return
+}
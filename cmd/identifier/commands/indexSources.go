@@ -0,0 +1,160 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"emperror.dev/errors"
+	human "github.com/dustin/go-humanize"
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+var dbFolderIndexSourcesFlag string
+var indexSourcesOutputFlags = &outputFlags{}
+var whereIndexSourcesFlag string
+
+var fieldsIndexSources = []string{"source", "location", "created", "files", "size"}
+var typesIndexSources = identifier.FieldTypes{"created": identifier.FieldTime, "files": identifier.FieldInt}
+
+var indexSourcesCmd = &cobra.Command{
+	Use:     "sources",
+	Aliases: []string{},
+	Short:   "list the sources of the database",
+	Long: `list the sources of the database
+Every data root indexed into a database is registered as source with an id and its absolute location.
+Records of databases created with older versions are assigned to the source '` + identifier.DefaultSource + `' by 'db migrate'.
+The location of this source is set by the next index run.
+With --where only the matching files are counted.
+` + whereHelp,
+	Example: `index two data roots into the same database and list them
+
+` + appname + ` index C:/daten/aiptest --database c:\temp\indexerbadger --source aip
+` + appname + ` index D:/daten/scans --database c:\temp\indexerbadger --source scans
+` + appname + ` index sources --database c:\temp\indexerbadger`,
+	Args: cobra.NoArgs,
+	Run:  doindexSources,
+}
+
+func indexSourcesInit() {
+	indexSourcesCmd.Flags().StringVar(&dbFolderIndexSourcesFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	addOutputFlags(indexSourcesCmd, indexSourcesOutputFlags, "sources")
+	indexSourcesCmd.Flags().StringVar(&whereIndexSourcesFlag, "where", "", "count only files matching the filter expression")
+	indexSourcesCmd.MarkFlagDirname("database")
+	indexSourcesCmd.MarkFlagRequired("database")
+}
+
+// selectSource returns the source with the given id or, if id is empty, the source located at dataPath.
+// Without id and data path nil is returned, which stands for all sources.
+func selectSource(sources []*identifier.Source, id string, dataPath string) (*identifier.Source, error) {
+	for _, source := range sources {
+		if (id != "" && source.ID == id) || (id == "" && dataPath != "" && source.Location == dataPath) {
+			return source, nil
+		}
+	}
+	switch {
+	case id != "":
+		return nil, errors.Errorf("unknown source '%s'", id)
+	case dataPath != "":
+		return nil, errors.Errorf("no source located at '%s' - use --source", dataPath)
+	}
+	return nil, nil
+}
+
+// singleSource works like selectSource, but falls back to the only source of the database
+func singleSource(sources []*identifier.Source, id string, dataPath string) (*identifier.Source, error) {
+	if id != "" {
+		return selectSource(sources, id, "")
+	}
+	if source, err := selectSource(sources, "", dataPath); err == nil && source != nil {
+		return source, nil
+	}
+	if len(sources) != 1 {
+		return nil, errors.Errorf("database contains %d sources - use --source", len(sources))
+	}
+	return sources[0], nil
+}
+
+// sourceID returns the id of the source or an empty string for all sources
+func sourceID(source *identifier.Source) string {
+	if source == nil {
+		return ""
+	}
+	return source.ID
+}
+
+// sourceLocations maps the ids of all sources to their locations
+func sourceLocations(sources []*identifier.Source) map[string]string {
+	var locations = map[string]string{}
+	for _, source := range sources {
+		locations[source.ID] = source.Location
+	}
+	return locations
+}
+
+func doindexSources(cmd *cobra.Command, args []string) {
+	where, err := identifier.ParseWhere(whereIndexSourcesFlag)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot parse filter expression")
+		defer os.Exit(1)
+		return
+	}
+	output, err := indexSourcesOutputFlags.output("sources", fieldsIndexSources, typesIndexSources)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot create output")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := output.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close output")
+		}
+	}()
+
+	storeIterator, err := identifier.NewStoreIterator(dbFolderIndexSourcesFlag, true, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot open database")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := storeIterator.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
+		}
+	}()
+
+	sources, err := storeIterator.Sources()
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load sources")
+		defer os.Exit(1)
+		return
+	}
+	var files = map[string]int64{}
+	var size = map[string]int64{}
+	if err := storeIterator.IterateFiles("", "", func(fData *identifier.FileData) (remove bool, err error) {
+		if !where.Match(fData) {
+			return false, nil
+		}
+		files[fData.Source]++
+		size[fData.Source] += fData.Size
+		return false, nil
+	}); err != nil {
+		logger.Error().Err(err).Msg("cannot iterate database")
+		defer os.Exit(1)
+		return
+	}
+	for _, source := range sources {
+		if err := output.Write([]any{
+			source.ID,
+			source.Location,
+			time.Unix(source.Created, 0),
+			files[source.ID],
+			human.Bytes(uint64(size[source.ID])),
+		}, source); err != nil {
+			logger.Error().Err(err).Msg("cannot write output")
+		}
+	}
+	fmt.Fprintf(indexSourcesOutputFlags.info(), "#%d sources\n", len(sources))
+	return
+}
@@ -0,0 +1,238 @@
+package commands
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+var indexVerifyOutputFlags = &outputFlags{}
+var dbFolderIndexVerifyFlag string
+var prefixIndexVerifyFlag string
+var sampleIndexVerifyFlag float64
+var olderThanIndexVerifyFlag string
+var concurrentIndexVerifyFlag uint
+var allIndexVerifyFlag bool
+var sourceIndexVerifyFlag string
+var whereIndexVerifyFlag string
+
+var fieldsIndexVerify = []string{"source", "path", "outcome", "checked", "message"}
+var typesIndexVerify = identifier.FieldTypes{"checked": identifier.FieldTime}
+
+var indexVerifyCmd = &cobra.Command{
+	Use:     "verify [path to data]",
+	Aliases: []string{},
+	Short:   "verify files against the checksums stored in database",
+	Long: `verify files against the checksums stored in database
+The files are read again and their checksums are compared with all checksums stored in the database.
+Every check is recorded as fixity event with timestamp and outcome (ok, changed, mismatch, missing, unreadable, nochecksum) in the database.
+Files with a different size or modification time than in the database are reported as changed without being read,
+mismatch means the content has changed while size and modification time are the same.
+Files without a stored checksum of a supported algorithm are reported as nochecksum.
+Only problems are reported, unless --all is set.
+The files are read from the locations of their sources. A source can be selected by --source or by its location.
+
+For rolling audits a random sample of files (--sample) or files which have not been checked
+for a given time (--older-than) can be selected.
+` + whereHelp,
+	Example: `verify a random sample of 10% of the files, which have not been checked for 30 days
+
+` + appname + ` index verify C:/daten/aiptest --database c:\temp\indexerbadger --sample 10 --older-than 30d`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  doindexVerify,
+}
+
+func indexVerifyInit() {
+	indexVerifyCmd.Flags().StringVar(&dbFolderIndexVerifyFlag, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	addOutputFlags(indexVerifyCmd, indexVerifyOutputFlags, "verification results")
+	indexVerifyCmd.Flags().StringVar(&prefixIndexVerifyFlag, "prefix", "", "folder path prefix")
+	indexVerifyCmd.Flags().Float64Var(&sampleIndexVerifyFlag, "sample", 100, "percentage of files to be verified")
+	indexVerifyCmd.Flags().StringVar(&olderThanIndexVerifyFlag, "older-than", "", "verify only files, which have not been verified for this duration (i.e. 720h or 30d)")
+	indexVerifyCmd.Flags().UintVarP(&concurrentIndexVerifyFlag, "concurrent", "n", 1, "number of concurrent workers")
+	indexVerifyCmd.Flags().BoolVar(&allIndexVerifyFlag, "all", false, "report successful verifications too")
+	indexVerifyCmd.Flags().StringVar(&sourceIndexVerifyFlag, "source", "", "verify only files of this source")
+	indexVerifyCmd.Flags().StringVar(&whereIndexVerifyFlag, "where", "", "verify only files matching the filter expression")
+	indexVerifyCmd.MarkFlagDirname("database")
+	indexVerifyCmd.MarkFlagRequired("database")
+}
+
+// parseAge parses a duration, which may use 'd' as unit for days
+func parseAge(value string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(value, "d"); found {
+		d, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, errors.Wrapf(err, "cannot parse duration '%s'", value)
+		}
+		return time.Duration(d * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot parse duration '%s'", value)
+	}
+	return d, nil
+}
+
+func doindexVerify(cmd *cobra.Command, args []string) {
+	var dataPath string
+	var err error
+	if len(args) > 0 {
+		dataPath = dataLocation(args[0])
+	}
+	where, err := identifier.ParseWhere(whereIndexVerifyFlag)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot parse filter expression")
+		defer os.Exit(1)
+		return
+	}
+	if sampleIndexVerifyFlag <= 0 || sampleIndexVerifyFlag > 100 {
+		logger.Error().Msgf("sample percentage %v must be within ]0, 100]", sampleIndexVerifyFlag)
+		defer os.Exit(1)
+		return
+	}
+	var checkedBefore int64
+	if olderThanIndexVerifyFlag != "" {
+		age, err := parseAge(olderThanIndexVerifyFlag)
+		if err != nil {
+			logger.Error().Err(err).Msg("invalid --older-than flag")
+			defer os.Exit(1)
+			return
+		}
+		checkedBefore = time.Now().Add(-age).Unix()
+		fmt.Fprintf(indexVerifyOutputFlags.info(), "#including files not verified since %s\n", time.Unix(checkedBefore, 0).Format(time.RFC3339))
+	}
+	if sampleIndexVerifyFlag < 100 {
+		fmt.Fprintf(indexVerifyOutputFlags.info(), "#including random sample of %v%%\n", sampleIndexVerifyFlag)
+	}
+
+	output, err := indexVerifyOutputFlags.output("verify", fieldsIndexVerify, typesIndexVerify)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot create output")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := output.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close output")
+		}
+	}()
+
+	storeIterator, err := identifier.NewStoreIterator(dbFolderIndexVerifyFlag, false, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot open database")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := storeIterator.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
+		}
+	}()
+
+	sources, err := storeIterator.Sources()
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load sources")
+		defer os.Exit(1)
+		return
+	}
+	source, err := selectSource(sources, sourceIndexVerifyFlag, dataPath)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot select source")
+		defer os.Exit(1)
+		return
+	}
+	sourceFSs := newSourceFS(sources)
+	defer sourceFSs.Close()
+	var fsyss = map[string]*identifier.ContainerFS{}
+	for _, source := range sources {
+		dataFS, err := sourceFSs.get(source.ID)
+		if err != nil {
+			logger.Warn().Err(err).Msgf("cannot open source '%s'", source.ID)
+			continue
+		}
+		fsyss[source.ID] = identifier.NewContainerFS(dataFS, 255, logger)
+		defer fsyss[source.ID].Close()
+	}
+
+	var outcomes = map[string]int64{}
+	var lock sync.Mutex
+	jobs := make(chan *identifier.FileData, 100)
+	var waiter = &sync.WaitGroup{}
+	for w := uint(1); w <= max(concurrentIndexVerifyFlag, 1); w++ {
+		waiter.Add(1)
+		go func() {
+			defer waiter.Done()
+			for fData := range jobs {
+				event := identifier.VerifyFile(fsyss[fData.Source], fData)
+				logger.Info().Str("source", fData.Source).Str("path", fData.Path).Str("outcome", event.Outcome).Msg(event.Message)
+				if err := storeIterator.AddFixityEvent(fData.Source, fData.Path, event); err != nil {
+					logger.Error().Err(err).Msgf("cannot store fixity event for '%s'", fData.Path)
+				}
+				lock.Lock()
+				outcomes[event.Outcome]++
+				if allIndexVerifyFlag || event.Outcome != identifier.FixityOK {
+					if err := output.Write([]any{
+						fData.Source,
+						fData.Path,
+						event.Outcome,
+						time.Unix(event.Time, 0),
+						event.Message,
+					}, struct {
+						Source string
+						Path   string
+						*identifier.FixityEvent
+					}{Source: fData.Source, Path: fData.Path, FixityEvent: event}); err != nil {
+						logger.Error().Err(err).Msg("cannot write output")
+					}
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+
+	// the files are verified while iterating, the fixity events are written in separate transactions
+	var files int64
+	err = storeIterator.IterateFiles(sourceID(source), prefixIndexVerifyFlag, func(fData *identifier.FileData) (remove bool, err error) {
+		if fData.Basename == "" || fsyss[fData.Source] == nil || !where.Match(fData) {
+			return false, nil
+		}
+		if checkedBefore > 0 && fData.Fixity != nil && fData.Fixity.Time >= checkedBefore {
+			return false, nil
+		}
+		if sampleIndexVerifyFlag < 100 && rand.Float64()*100 >= sampleIndexVerifyFlag {
+			return false, nil
+		}
+		if fData.Indexer != nil {
+			// metadata is not needed for verification
+			fData.Indexer.Metadata = nil
+		}
+		files++
+		jobs <- fData
+		return false, nil
+	})
+	close(jobs)
+	waiter.Wait()
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot iterate database")
+		defer os.Exit(1)
+		return
+	}
+
+	fmt.Fprintf(indexVerifyOutputFlags.info(), "#%d files verified: %d ok, %d changed, %d mismatch, %d missing, %d unreadable, %d without checksum\n",
+		files,
+		outcomes[identifier.FixityOK],
+		outcomes[identifier.FixityChanged],
+		outcomes[identifier.FixityMismatch],
+		outcomes[identifier.FixityMissing],
+		outcomes[identifier.FixityUnreadable],
+		outcomes[identifier.FixityNoChecksum],
+	)
+	return
+}
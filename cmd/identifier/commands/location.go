@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"path/filepath"
+
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+const locationHelp = `The data root can be a local folder, an sftp://user@host[:port]/path or an s3://bucket/prefix url.
+Credentials for sftp are taken from the [sftp] section of the config file or from the ssh agent (SSH_AUTH_SOCK).
+Endpoint and credentials for s3 are taken from the [s3] section of the config file or from the environment.
+`
+
+func locationConfig() *identifier.LocationConfig {
+	return &identifier.LocationConfig{SFTP: conf.SFTP, S3: conf.S3}
+}
+
+// dataLocation returns the normalized location of the data root given as argument
+func dataLocation(arg string) string {
+	location, err := identifier.NormalizeLocation(arg, locationConfig())
+	cobra.CheckErr(err)
+	return location
+}
+
+// openDataLocation opens the data root given as argument
+func openDataLocation(arg string) (identifier.DataFS, string, error) {
+	return identifier.OpenLocation(arg, locationConfig(), logger)
+}
+
+// newSourceFS creates a cache for the file systems of the sources
+func newSourceFS(sources []*identifier.Source) *sourceFS {
+	return &sourceFS{locations: sourceLocations(sources), fsyss: map[string]identifier.DataFS{}}
+}
+
+// sourceFS opens the locations of sources on demand
+type sourceFS struct {
+	locations map[string]string
+	fsyss     map[string]identifier.DataFS
+}
+
+// get returns the file system of a source
+func (s *sourceFS) get(id string) (identifier.DataFS, error) {
+	if fsys, ok := s.fsyss[id]; ok {
+		return fsys, nil
+	}
+	if s.locations[id] == "" {
+		return nil, errors.Errorf("location of source '%s' is unknown", id)
+	}
+	fsys, _, err := openDataLocation(s.locations[id])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open location of source '%s'", id)
+	}
+	s.fsyss[id] = fsys
+	return fsys, nil
+}
+
+func (s *sourceFS) Close() error {
+	var errs = []error{}
+	for _, fsys := range s.fsyss {
+		if err := fsys.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Combine(errs...)
+}
+
+// joinLocation returns the full path of name within a data root for messages
+func joinLocation(location, name string) string {
+	if identifier.IsRemoteLocation(location) {
+		return location + "/" + name
+	}
+	return filepath.Join(location, filepath.FromSlash(name))
+}
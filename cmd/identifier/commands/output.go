@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"os"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+// outputFlags are the flags for the output of records, which are shared by all commands with tabular output
+type outputFlags struct {
+	out     []string
+	csv     string
+	jsonl   string
+	xlsx    string
+	console bool
+}
+
+func addOutputFlags(cmd *cobra.Command, flags *outputFlags, what string) {
+	cmd.Flags().StringArrayVar(&flags.out, "out", nil, "write "+what+" to format:path[?options] ('-' is stdout, repeatable), formats: "+strings.Join(identifier.WriterFormats(), ", "))
+	cmd.Flags().StringVar(&flags.csv, "csv", "", "write "+what+" to csv file")
+	cmd.Flags().StringVar(&flags.jsonl, "jsonl", "", "write "+what+" to jsonl file")
+	cmd.Flags().StringVar(&flags.xlsx, "xlsx", "", "write "+what+" to xlsx file")
+	cmd.Flags().BoolVar(&flags.console, "console", false, "write "+what+" to console")
+	cmd.Flags().MarkDeprecated("csv", "use --out csv:<path>")
+	cmd.Flags().MarkDeprecated("jsonl", "use --out jsonl:<path>")
+	cmd.Flags().MarkDeprecated("xlsx", "use --out xlsx:<path>")
+}
+
+const outputHelp = `The output is written to the console, unless other outputs are given by --out format:path[?options].
+Only one output can be written to stdout ('-'). If the records are written to stdout, the messages of the command
+(lines starting with '#') are written to stderr.
+  csv:     options delimiter (i.e. 'csv:list.csv?delimiter=;' or delimiter=tab), header=false
+  jsonl:   complete records as json lines
+  xlsx:    options sheet (name of the sheet), rows (rows per sheet, default and maximum 1048576),
+           further rows are written to additional sheets
+  parquet: optional typed columns (int64, timestamp, bool, list, empty values are null), options rowgroup (rows per row group, default 50000),
+           compression (snappy, zstd, gzip or none)
+  console: 'field: value' lines
+`
+
+// specs returns the output specifications of --out and of the deprecated file flags
+func (flags *outputFlags) specs() []string {
+	var specs = append([]string{}, flags.out...)
+	if flags.csv != "" {
+		specs = append(specs, "csv:"+flags.csv)
+	}
+	if flags.jsonl != "" {
+		specs = append(specs, "jsonl:"+flags.jsonl)
+	}
+	if flags.xlsx != "" {
+		specs = append(specs, "xlsx:"+flags.xlsx)
+	}
+	return specs
+}
+
+// stdout checks, whether the records are written to stdout in a format other than console
+func (flags *outputFlags) stdout() bool {
+	for _, spec := range flags.specs() {
+		if config, err := identifier.ParseWriterSpec(spec); err == nil && config.Path == "-" && config.Format != "console" {
+			return true
+		}
+	}
+	return false
+}
+
+// info returns the writer for the messages of the command, which must not be mixed with records written to stdout
+func (flags *outputFlags) info() *os.File {
+	if flags.stdout() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// check rejects several outputs to stdout
+func (flags *outputFlags) check(specs []string) error {
+	if flags.console && flags.stdout() {
+		return errors.New("records written to stdout cannot be combined with --console")
+	}
+	var count int
+	for _, spec := range specs {
+		if config, err := identifier.ParseWriterSpec(spec); err == nil && config.Path == "-" {
+			count++
+		}
+	}
+	if count > 1 {
+		return errors.New("only one output can be written to stdout ('-')")
+	}
+	return nil
+}
+
+// output creates the writers of all outputs. Without outputs the records are written to the console.
+func (flags *outputFlags) output(name string, fields []string, types identifier.FieldTypes) (*identifier.Output, error) {
+	specs := flags.specs()
+	if flags.console || len(specs) == 0 {
+		specs = append(specs, "console")
+	}
+	if err := flags.check(specs); err != nil {
+		return nil, err
+	}
+	return identifier.NewOutput(specs, name, fields, types, logger)
+}
@@ -0,0 +1,248 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	human "github.com/dustin/go-humanize"
+	"github.com/ocfl-archive/identifier/identifier"
+)
+
+// number of recently processed paths shown in the progress view
+const progressRecent = 8
+
+// maximum length of paths in the progress view, longer lines would break the redraw
+const progressWidth = 100
+
+// shortenPath cuts the beginning of long paths
+func shortenPath(path string, width int) string {
+	runes := []rune(path)
+	if len(runes) <= width {
+		return path
+	}
+	return "..." + string(runes[len(runes)-width+3:])
+}
+
+// isTerminal checks, whether f is connected to a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// newIndexProgress creates the progress of an index run.
+// With a terminal the progress is shown on out, otherwise a summary is logged periodically.
+func newIndexProgress(out *os.File, terminal bool, interval time.Duration) *indexProgress {
+	return &indexProgress{
+		out:      out,
+		terminal: terminal,
+		interval: interval,
+		start:    time.Now(),
+		recent:   NewRingBuffer[string](progressRecent),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+}
+
+type indexProgress struct {
+	sync.Mutex
+	out        *os.File
+	terminal   bool
+	interval   time.Duration
+	start      time.Time
+	recent     *RingBuffer[string]
+	counting   bool
+	counted    bool
+	totalFiles int64
+	totalBytes int64
+	// files and bytes outside of containers, which are comparable with the pre-count
+	doneFiles int64
+	doneBytes int64
+	// files completed by a resumed run
+	skippedBytes int64
+	// all processed files including the content of containers
+	files    int64
+	bytes    int64
+	cached   int64
+	failed   int64
+	active   int64
+	lines    int
+	done     chan struct{}
+	finished chan struct{}
+}
+
+// startCount counts the files of the data root in the background
+func (p *indexProgress) startCount(fsys fs.FS, filter *identifier.WalkFilter) {
+	p.Lock()
+	p.counting = true
+	p.Unlock()
+	go p.count(fsys, filter)
+}
+
+// count walks the data root like the index run to determine the number of files and bytes
+func (p *indexProgress) count(fsys fs.FS, filter *identifier.WalkFilter) {
+	var files, size int64
+	if err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if filter.SkipDir(path) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		var fileSize int64
+		if fi, err := d.Info(); err == nil {
+			fileSize = fi.Size()
+		}
+		if filter.SkipFile(path, fileSize) {
+			return nil
+		}
+		files++
+		size += fileSize
+		return nil
+	}); err != nil {
+		logger.Error().Err(err).Msg("cannot count files")
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.totalFiles, p.totalBytes, p.counted = files, size, true
+	logger.Info().Int64("files", files).Int64("bytes", size).Msgf("%d files (%s) to index", files, human.Bytes(uint64(size)))
+}
+
+// add processes a result of a worker
+func (p *indexProgress) add(result *identifier.WorkerResult) {
+	p.Lock()
+	defer p.Unlock()
+	if !result.Done {
+		p.active++
+		return
+	}
+	p.active--
+	p.files++
+	p.bytes += result.Size
+	if result.Container == "" {
+		p.doneFiles++
+		p.doneBytes += result.Size
+	}
+	if result.Cached {
+		p.cached++
+	}
+	state := ""
+	switch {
+	case result.Failed:
+		p.failed++
+		state = " [failed]"
+	case result.Cached:
+		state = " [cached]"
+	}
+	p.recent.Add(result.Path + state)
+}
+
+// skip counts a file, which has been indexed by the resumed run
+func (p *indexProgress) skip(size int64) {
+	p.Lock()
+	defer p.Unlock()
+	p.doneFiles++
+	p.doneBytes += size
+	p.skippedBytes += size
+}
+
+// run shows the progress until stop is called
+func (p *indexProgress) run() {
+	defer close(p.finished)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			p.show()
+			return
+		case <-ticker.C:
+			p.show()
+		}
+	}
+}
+
+// stop shows the final state
+func (p *indexProgress) stop() {
+	close(p.done)
+	<-p.finished
+}
+
+func (p *indexProgress) show() {
+	p.Lock()
+	defer p.Unlock()
+	elapsed := time.Since(p.start).Seconds()
+	if elapsed <= 0 {
+		elapsed = 1
+	}
+	filesPerSecond := float64(p.files) / elapsed
+	bytesPerSecond := float64(p.bytes) / elapsed
+	var cacheRatio float64
+	if p.files > 0 {
+		cacheRatio = float64(p.cached) / float64(p.files) * 100
+	}
+	var eta time.Duration = -1
+	var percent float64
+	if p.counted && p.totalBytes > 0 {
+		percent = min(float64(p.doneBytes)/float64(p.totalBytes)*100, 100)
+		if indexed := p.doneBytes - p.skippedBytes; indexed > 0 {
+			eta = time.Duration(float64(max(p.totalBytes-p.doneBytes, 0)) / (float64(indexed) / elapsed) * float64(time.Second)).Round(time.Second)
+		}
+	}
+	if !p.terminal {
+		event := logger.Info().
+			Int64("files", p.files).
+			Int64("bytes", p.bytes).
+			Float64("files_per_second", filesPerSecond).
+			Float64("bytes_per_second", bytesPerSecond).
+			Float64("cache_ratio", cacheRatio).
+			Int64("failed", p.failed).
+			Int64("active", p.active)
+		if p.counted {
+			event = event.Int64("total_files", p.totalFiles).Int64("total_bytes", p.totalBytes).Float64("percent", percent)
+		}
+		if eta >= 0 {
+			event = event.Dur("eta", eta)
+		}
+		event.Msg("progress")
+		return
+	}
+	var sb strings.Builder
+	if p.counted {
+		fmt.Fprintf(&sb, "files: %d/%d  size: %s/%s  %.1f%%\n", p.doneFiles, p.totalFiles, human.Bytes(uint64(p.doneBytes)), human.Bytes(uint64(p.totalBytes)), percent)
+	} else if p.counting {
+		fmt.Fprintf(&sb, "files: %d  size: %s  (counting...)\n", p.doneFiles, human.Bytes(uint64(p.doneBytes)))
+	} else {
+		fmt.Fprintf(&sb, "files: %d  size: %s\n", p.doneFiles, human.Bytes(uint64(p.doneBytes)))
+	}
+	etaStr := "-"
+	if eta >= 0 {
+		etaStr = eta.String()
+	}
+	fmt.Fprintf(&sb, "%.1f files/s  %.2f MB/s  eta: %s  cached: %.1f%%  failed: %d  active workers: %d\n", filesPerSecond, bytesPerSecond/1000/1000, etaStr, cacheRatio, p.failed, p.active)
+	for _, path := range p.recent.Get() {
+		fmt.Fprintf(&sb, "  %s\n", shortenPath(path, progressWidth))
+	}
+	p.redraw(p.out, sb.String())
+}
+
+// redraw replaces the last output on the terminal
+func (p *indexProgress) redraw(w io.Writer, text string) {
+	if p.lines > 0 {
+		// cursor up and clear to end of screen
+		fmt.Fprintf(w, "\033[%dA\033[J", p.lines)
+	}
+	fmt.Fprint(w, text)
+	p.lines = strings.Count(text, "\n")
+}
@@ -8,7 +8,6 @@ import (
 	"runtime/debug"
 	"strings"
 
-	"github.com/BurntSushi/toml"
 	"github.com/je4/utils/v2/pkg/zLogger"
 	"github.com/ocfl-archive/identifier/config"
 	"github.com/rs/zerolog"
@@ -42,7 +41,9 @@ source code is available at: https://github.com/ocfl-archive/identifier
 by Jürgen Enge (University Library Basel, juergen@info-age.net)`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if showConfig {
-			toml.NewEncoder(os.Stdout).Encode(conf)
+			if err := conf.Encode(os.Stdout); err != nil {
+				logger.Error().Err(err).Msg("cannot show config")
+			}
 		} else {
 			_ = cmd.Help()
 		}
@@ -138,7 +139,8 @@ func init() {
 	foldersInit()
 	indexInit()
 	aiInit()
-	rootCmd.AddCommand(clearpathCmd, filesCmd, foldersCmd, indexCmd, aiCmd)
+	dbInit()
+	rootCmd.AddCommand(clearpathCmd, filesCmd, foldersCmd, indexCmd, aiCmd, dbCmd)
 }
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+// statisticsFlags are the flags of the format statistics (index pronom and index mime)
+type statisticsFlags struct {
+	output     *outputFlags
+	dbFolder   string
+	empty      bool
+	regexp     string
+	duplicates bool
+	prefix     string
+	source     string
+	where      string
+}
+
+// statisticsIndex describes the statistics of a secondary index
+type statisticsIndex struct {
+	index identifier.SecondaryIndex
+	// name of the value column
+	field string
+	// key of the value in json lines
+	key   string
+	title string
+	// value returns the value of a file record, which is used with --where
+	value func(fData *identifier.FileData) string
+}
+
+var statisticsTypes = identifier.FieldTypes{"count": identifier.FieldInt, "size (bytes)": identifier.FieldInt}
+
+const statisticsHelp = `Without --where the statistics are read from the secondary index without reading the file records.
+Unidentified files are counted with an empty value.
+`
+
+func addStatisticsFlags(cmd *cobra.Command, flags *statisticsFlags, name string) {
+	flags.output = &outputFlags{}
+	cmd.Flags().StringVar(&flags.dbFolder, "database", "", "folder for badger database (must already exist) or sqlite:///path/to/index.db")
+	addOutputFlags(cmd, flags.output, name+" statistics")
+	cmd.Flags().BoolVar(&flags.empty, "empty", false, "include empty files")
+	cmd.Flags().StringVar(&flags.regexp, "regexp", "", "include files matching regular expression")
+	cmd.Flags().BoolVar(&flags.duplicates, "duplicates", false, "include duplicate files")
+	cmd.Flags().StringVar(&flags.prefix, "prefix", "", "folder path prefix")
+	cmd.Flags().StringVar(&flags.source, "source", "", "statistics of this source only")
+	cmd.Flags().StringVar(&flags.where, "where", "", "filter expression (i.e. 'size > 10MB && lastmod < 2010-01-01')")
+	cmd.MarkFlagRequired("database")
+}
+
+// statistics writes the number and size of the files per value of the secondary index
+func statistics(flags *statisticsFlags, stat *statisticsIndex) {
+	filter, err := newFileFilter(flags.empty, flags.duplicates, flags.regexp, flags.where)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot create filter")
+		defer os.Exit(1)
+		return
+	}
+	filter.print(flags.output.info())
+	if flags.prefix != "" {
+		fmt.Fprintf(flags.output.info(), "#including prefix \"%s\"\n", flags.prefix)
+	}
+	fields := []string{stat.field, "count", "size (bytes)", "size"}
+	output, err := flags.output.output("list", fields, statisticsTypes)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot create output")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := output.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close output")
+		}
+	}()
+
+	storeIterator, err := identifier.NewStoreIterator(flags.dbFolder, true, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot open database")
+		defer os.Exit(1)
+		return
+	}
+	defer func() {
+		if err := storeIterator.Close(); err != nil {
+			logger.Error().Err(err).Msg("cannot close database")
+		}
+	}()
+
+	sources, err := storeIterator.Sources()
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot load sources")
+		defer os.Exit(1)
+		return
+	}
+	source, err := selectSource(sources, flags.source, "")
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot select source")
+		defer os.Exit(1)
+		return
+	}
+
+	var statSize = map[string]int64{}
+	var statCount = map[string]int64{}
+	add := func(value string, size int64) {
+		statSize[value] += size
+		statCount[value]++
+	}
+	if filter.where.Empty() {
+		// the statistics are read from the index without the file records
+		err = storeIterator.IterateSecondary(stat.index, "", sourceID(source), func(file *identifier.IndexedFile) error {
+			if strings.HasPrefix(file.Path, flags.prefix) && filter.matchFile(filepath.Base(file.Path), file.Entry.Size, file.Entry.Duplicate) {
+				add(file.Value, file.Entry.Size)
+			}
+			return nil
+		})
+	} else {
+		err = storeIterator.IterateFiles(sourceID(source), flags.prefix, func(fData *identifier.FileData) (remove bool, err error) {
+			if fData.Basename != "" && fData.Indexer != nil && filter.match(fData) {
+				add(stat.value(fData), fData.Size)
+			}
+			return false, nil
+		})
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot iterate database")
+	}
+	tw := table.NewWriter()
+	header := table.Row{}
+	for _, field := range fields {
+		header = append(header, field)
+	}
+	tw.AppendHeader(header)
+
+	for val, size := range statSize {
+		if err := output.Write([]any{
+			val,
+			statCount[val],
+			size,
+			humanize.Bytes(uint64(size)),
+		}, map[string]any{stat.key: val, "Size": size, "Count": statCount[val]}); err != nil {
+			logger.Error().Err(err).Msg("cannot write output")
+		}
+		tw.AppendRow(table.Row{val, statCount[val], size, humanize.Bytes(uint64(size))})
+	}
+	tw.SetTitle(stat.title)
+	if flags.output.console {
+		fmt.Println(tw.Render())
+	}
+}
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"io/fs"
+
+	"emperror.dev/errors"
+	human "github.com/dustin/go-humanize"
+	"github.com/ocfl-archive/identifier/identifier"
+	"github.com/spf13/cobra"
+)
+
+// walkFilterFlags are the flags for selecting files and folders of a data root, which are shared by several commands
+type walkFilterFlags struct {
+	exclude  []string
+	include  []string
+	maxDepth int
+	minSize  string
+	maxSize  string
+	noIgnore bool
+}
+
+const walkFilterHelp = `Files and folders can be excluded with gitignore-style patterns (--exclude, '!' re-includes) and the
+file '` + identifier.IgnoreFile + `' in the data root. With --include only matching files are processed.
+The content of containers is filtered like a folder, --include, --min-size and --max-size decide only on the record
+of the container itself.
+`
+
+func addWalkFilterFlags(cmd *cobra.Command, flags *walkFilterFlags) {
+	cmd.Flags().StringArrayVar(&flags.exclude, "exclude", nil, "gitignore-style pattern of files and folders to be skipped (repeatable)")
+	cmd.Flags().StringArrayVar(&flags.include, "include", nil, "gitignore-style pattern of files to be processed, all others are skipped (repeatable)")
+	cmd.Flags().IntVar(&flags.maxDepth, "max-depth", 0, "maximum depth of files below the data root (0: unlimited)")
+	cmd.Flags().StringVar(&flags.minSize, "min-size", "", "minimum file size (i.e. 1KB)")
+	cmd.Flags().StringVar(&flags.maxSize, "max-size", "", "maximum file size (i.e. 2GB)")
+	cmd.Flags().BoolVar(&flags.noIgnore, "no-ignore-file", false, "do not read '"+identifier.IgnoreFile+"' from the data root")
+}
+
+// walkFilter creates the filter for the data root fsys from the flags
+func (flags *walkFilterFlags) walkFilter(fsys fs.FS) (*identifier.WalkFilter, error) {
+	parseSize := func(name, value string) (int64, error) {
+		if value == "" {
+			return 0, nil
+		}
+		size, err := human.ParseBytes(value)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid %s '%s'", name, value)
+		}
+		return int64(size), nil
+	}
+	if flags.maxDepth < 0 {
+		return nil, errors.Errorf("invalid max-depth %d", flags.maxDepth)
+	}
+	minSize, err := parseSize("min-size", flags.minSize)
+	if err != nil {
+		return nil, err
+	}
+	maxSize, err := parseSize("max-size", flags.maxSize)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && minSize > maxSize {
+		return nil, errors.Errorf("min-size %s is larger than max-size %s", flags.minSize, flags.maxSize)
+	}
+	filter, err := identifier.NewWalkFilter(nil, flags.include, flags.maxDepth, minSize, maxSize)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !flags.noIgnore {
+		if err := filter.AddIgnoreFile(fsys); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	// patterns of the command line take precedence over the ignore file
+	if err := filter.AddExcludes(flags.exclude...); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return filter, nil
+}
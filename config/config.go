@@ -1,20 +1,40 @@
 package config
 
 import (
+	"io"
 	"os"
+	"strings"
 
 	"emperror.dev/errors"
 	"github.com/BurntSushi/toml"
+	"github.com/je4/utils/v2/pkg/checksum"
 	"github.com/je4/utils/v2/pkg/stashconfig"
+	"github.com/ocfl-archive/identifier/identifier"
 	"github.com/ocfl-archive/indexer/v3/pkg/indexer"
+	"golang.org/x/exp/slices"
 )
 
 type Config struct {
-	Indexer *indexer.IndexerConfig
-	Log     stashconfig.Config `toml:"log"`
+	Digest          []checksum.DigestAlgorithm `toml:"-"`
+	DuplicateDigest checksum.DigestAlgorithm   `toml:"-"`
+	Indexer         *indexer.IndexerConfig
+	Log             stashconfig.Config     `toml:"log"`
+	SFTP            *identifier.SFTPConfig `toml:"sftp"`
+	S3              *identifier.S3Config   `toml:"s3"`
+}
+
+// digestConfig holds the checksum algorithms as written in the config file,
+// they are normalized by validateDigests (i.e. "SHA512" is "sha512")
+type digestConfig struct {
+	Digest          []string `toml:"digest"`
+	DuplicateDigest string   `toml:"duplicatedigest"`
 }
 
 func LoadConfig(configPath string) (*Config, error) {
+	var digests = &digestConfig{
+		Digest:          []string{string(checksum.DigestSHA512)},
+		DuplicateDigest: string(checksum.DigestSHA512),
+	}
 	var conf = &Config{
 		Indexer: indexer.GetDefaultConfig(),
 		Log: stashconfig.Config{
@@ -24,16 +44,68 @@ func LoadConfig(configPath string) (*Config, error) {
 	if err := toml.Unmarshal(DefaultConfig, conf); err != nil {
 		return nil, errors.Wrap(err, "cannot load default config")
 	}
-	if configPath == "" {
-		return conf, nil
+	if err := toml.Unmarshal(DefaultConfig, digests); err != nil {
+		return nil, errors.Wrap(err, "cannot load default config")
 	}
+	if configPath != "" {
+		if _, err := os.Stat(configPath); os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "config file %s does not exist", configPath)
+		}
 
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return nil, errors.Wrapf(err, "config file %s does not exist", configPath)
+		if _, err := toml.DecodeFile(configPath, conf); err != nil {
+			return nil, errors.Wrapf(err, "Error unmarshalling config")
+		}
+		if _, err := toml.DecodeFile(configPath, digests); err != nil {
+			return nil, errors.Wrapf(err, "Error unmarshalling config")
+		}
 	}
-
-	if _, err := toml.DecodeFile(configPath, conf); err != nil {
-		return nil, errors.Wrapf(err, "Error unmarshalling config")
+	if err := conf.validateDigests(digests); err != nil {
+		return nil, errors.WithStack(err)
 	}
 	return conf, nil
 }
+
+// Encode writes the config as TOML
+func (conf *Config) Encode(w io.Writer) error {
+	var digests = &digestConfig{DuplicateDigest: string(conf.DuplicateDigest)}
+	for _, digest := range conf.Digest {
+		digests.Digest = append(digests.Digest, string(digest))
+	}
+	enc := toml.NewEncoder(w)
+	if err := enc.Encode(digests); err != nil {
+		return errors.Wrap(err, "cannot encode digests")
+	}
+	return errors.Wrap(enc.Encode(conf), "cannot encode config")
+}
+
+// normalizeDigest returns the name of a checksum algorithm as used by checksum.DigestAlgorithm
+func normalizeDigest(name string) checksum.DigestAlgorithm {
+	return checksum.DigestAlgorithm(strings.ToLower(strings.TrimSpace(name)))
+}
+
+// validateDigests normalizes and checks the checksum algorithms and stores them in the config.
+// The duplicate digest must be one of the digests, otherwise the files would be indexed without the checksum
+// used for duplicate detection.
+func (conf *Config) validateDigests(digests *digestConfig) error {
+	conf.Digest = []checksum.DigestAlgorithm{}
+	for _, name := range digests.Digest {
+		digest := normalizeDigest(name)
+		if !checksum.HashExists(digest) {
+			return errors.Errorf("unknown digest '%s' - use one of %v", name, checksum.DigestNames)
+		}
+		if !slices.Contains(conf.Digest, digest) {
+			conf.Digest = append(conf.Digest, digest)
+		}
+	}
+	if len(conf.Digest) == 0 {
+		return errors.Errorf("no digest configured - use some of %v", checksum.DigestNames)
+	}
+	conf.DuplicateDigest = normalizeDigest(digests.DuplicateDigest)
+	if !checksum.HashExists(conf.DuplicateDigest) {
+		return errors.Errorf("unknown duplicatedigest '%s' - use one of %v", digests.DuplicateDigest, checksum.DigestNames)
+	}
+	if !slices.Contains(conf.Digest, conf.DuplicateDigest) {
+		return errors.Errorf("duplicatedigest '%s' is not one of the digests %v", conf.DuplicateDigest, conf.Digest)
+	}
+	return nil
+}
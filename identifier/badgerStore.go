@@ -0,0 +1,101 @@
+package identifier
+
+import (
+	"emperror.dev/errors"
+	"github.com/dgraph-io/badger/v4"
+	badgerOptions "github.com/dgraph-io/badger/v4/options"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+// NewBadgerStore opens the badger database in folder
+func NewBadgerStore(folder string, readOnly bool, logger zLogger.ZLogger) (*BadgerStore, error) {
+	badgerDB, err := badger.Open(badger.DefaultOptions(folder).WithReadOnly(readOnly).WithCompression(badgerOptions.Snappy).WithLogger(zLogger.NewZWrapper(logger)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open badger database in '%s'", folder)
+	}
+	return &BadgerStore{badgerDB: badgerDB}, nil
+}
+
+type BadgerStore struct {
+	badgerDB *badger.DB
+}
+
+func (s *BadgerStore) View(fn func(txn Txn) error) error {
+	return s.badgerDB.View(func(txn *badger.Txn) error {
+		return fn(&badgerTxn{txn: txn})
+	})
+}
+
+func (s *BadgerStore) Update(fn func(txn Txn) error) error {
+	err := s.badgerDB.Update(func(txn *badger.Txn) error {
+		return fn(&badgerTxn{txn: txn})
+	})
+	if errors.Is(err, badger.ErrConflict) {
+		return errors.WithStack(ErrConflict)
+	}
+	if errors.Is(err, badger.ErrTxnTooBig) {
+		return errors.Wrap(ErrTxnTooBig, err.Error())
+	}
+	return err
+}
+
+func (s *BadgerStore) Close() error {
+	return errors.WithStack(s.badgerDB.Close())
+}
+
+type badgerTxn struct {
+	txn *badger.Txn
+}
+
+func (t *badgerTxn) Get(key []byte) ([]byte, error) {
+	item, err := t.txn.Get(key)
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, errors.WithStack(err)
+	}
+	return item.ValueCopy(nil)
+}
+
+func (t *badgerTxn) Set(key, value []byte) error {
+	return t.txn.Set(key, value)
+}
+
+func (t *badgerTxn) Delete(key []byte) error {
+	return t.txn.Delete(key)
+}
+
+func (t *badgerTxn) Iterate(prefix []byte, do func(key, value []byte) error) error {
+	options := badger.DefaultIteratorOptions
+	options.PrefetchValues = true
+	options.Prefix = prefix
+	it := t.txn.NewIterator(options)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		key := item.KeyCopy(nil)
+		if err := item.Value(func(val []byte) error {
+			return do(key, val)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *badgerTxn) IterateKeys(prefix []byte, do func(key []byte) error) error {
+	options := badger.DefaultIteratorOptions
+	options.PrefetchValues = false
+	options.Prefix = prefix
+	it := t.txn.NewIterator(options)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := do(it.Item().KeyCopy(nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ Store = (*BadgerStore)(nil)
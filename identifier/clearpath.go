@@ -118,6 +118,12 @@ type pathElement struct {
 func (p *pathElement) AddSub(name string, dir bool, size int64) *pathElement {
 	for _, sub := range p.subs {
 		if sub.name == name {
+			// a container file is also a virtual folder
+			if dir && !sub.dir {
+				sub.dir = true
+			} else if !dir && sub.dir {
+				sub.size = size
+			}
 			return sub
 		}
 	}
@@ -131,6 +137,10 @@ func (p *pathElement) SubFolderHierarchyAggregation() (size int64, fileCount int
 		return p.size, 1, 0
 	}
 	folderCount = 1
+	if p.size > 0 {
+		// container file
+		size, fileCount = p.size, 1
+	}
 	for _, sub := range p.subs {
 		subSize, subFile, subFolder := sub.SubFolderHierarchyAggregation()
 		size += subSize
@@ -279,23 +289,34 @@ func (p *pathElement) FindDirname(re *regexp.Regexp) func(func(string) bool) {
 	}
 }
 
-func BuildPath(fsys fs.FS, logger zLogger.ZLogger) (*pathElement, error) {
+// BuildPath creates the path hierarchy of fsys. Files and folders rejected by filter are not included.
+func BuildPath(fsys fs.FS, filter *WalkFilter, logger zLogger.ZLogger) (*pathElement, error) {
 	root := NewPathElement("", true, 0, nil)
 	if err := fs.WalkDir(fsys, ".", func(pathStr string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return errors.Wrapf(err, "cannot walk %s/%s", fsys, pathStr)
 		}
 		pathStr = path.Clean(filepath.ToSlash(pathStr))
+		var size int64
+		if d.IsDir() {
+			if filter.SkipDir(pathStr) {
+				logger.Debug().Msgf("skipping dir %v/%s", fsys, pathStr)
+				return fs.SkipDir
+			}
+		} else {
+			if fi, err := d.Info(); err == nil {
+				size = fi.Size()
+			}
+			if filter.SkipFile(pathStr, size) {
+				return nil
+			}
+		}
 		pathParts := strings.Split(pathStr, "/")
 		curr := root
 		for _, pathPart := range pathParts {
 			if pathPart == "." || pathPart == "" {
 				continue
 			}
-			var size int64
-			if fi, err := d.Info(); err != nil {
-				size = fi.Size()
-			}
 			curr = curr.AddSub(pathPart, d.IsDir(), size)
 		}
 		if d.IsDir() {
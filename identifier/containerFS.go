@@ -0,0 +1,340 @@
+package identifier
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+// maximum number of unused containers kept open
+const containerCacheSize = 16
+
+var errNoContainer = errors.New("not a container")
+
+// IsContainer checks, whether the file name denotes a zip or tar container
+func IsContainer(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainerOf returns the path of the innermost container of a file or an empty string
+func ContainerOf(fsys fs.FS, name string) string {
+	if cfs, ok := fsys.(*ContainerFS); ok {
+		return cfs.Container(name)
+	}
+	return ""
+}
+
+type container struct {
+	fsys   fs.FS
+	closer func() error
+	refs   int
+}
+
+func openContainer(fp fs.File, name string) (*container, error) {
+	fi, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		return nil, errors.Wrapf(err, "cannot stat '%s'", name)
+	}
+	if fi.IsDir() {
+		fp.Close()
+		return nil, errors.WithStack(errNoContainer)
+	}
+	lowerName := strings.ToLower(name)
+	compressed := strings.HasSuffix(lowerName, ".gz") || strings.HasSuffix(lowerName, ".tgz")
+
+	var ra io.ReaderAt
+	var size int64
+	var closer func() error
+	if r, ok := fp.(io.ReaderAt); ok && !compressed {
+		ra = r
+		size = fi.Size()
+		closer = fp.Close
+	} else {
+		// containers inside of containers and compressed containers need random access
+		var src io.Reader = fp
+		if compressed {
+			gzReader, err := gzip.NewReader(fp)
+			if err != nil {
+				fp.Close()
+				return nil, errors.Wrapf(err, "cannot open gzip stream of '%s'", name)
+			}
+			defer gzReader.Close()
+			src = gzReader
+		}
+		tmpFile, err := os.CreateTemp("", "identifier-container-*")
+		if err != nil {
+			fp.Close()
+			return nil, errors.Wrap(err, "cannot create temporary file")
+		}
+		size, err = io.Copy(tmpFile, src)
+		fp.Close()
+		if err != nil {
+			tmpFile.Close()
+			os.Remove(tmpFile.Name())
+			return nil, errors.Wrapf(err, "cannot copy '%s' to temporary file", name)
+		}
+		ra = tmpFile
+		closer = func() error {
+			return errors.Combine(tmpFile.Close(), os.Remove(tmpFile.Name()))
+		}
+	}
+
+	var fsys fs.FS
+	if strings.HasSuffix(lowerName, ".zip") {
+		fsys, err = zip.NewReader(ra, size)
+	} else {
+		fsys, err = newTarFS(ra, size)
+	}
+	if err != nil {
+		closer()
+		return nil, errors.Wrapf(err, "cannot open container '%s'", name)
+	}
+	return &container{fsys: fsys, closer: closer}, nil
+}
+
+// NewContainerFS creates a file system, which exposes the content of zip and tar containers as virtual folders.
+// A path like "a/b.zip/inner/file.pdf" addresses the file "inner/file.pdf" inside of the container "a/b.zip".
+// maxDepth limits the nesting depth of containers.
+func NewContainerFS(baseFS fs.FS, maxDepth uint, logger zLogger.ZLogger) *ContainerFS {
+	return &ContainerFS{
+		baseFS:     baseFS,
+		maxDepth:   maxDepth,
+		logger:     logger,
+		containers: map[string]*container{},
+	}
+}
+
+type ContainerFS struct {
+	baseFS     fs.FS
+	maxDepth   uint
+	logger     zLogger.ZLogger
+	lock       sync.Mutex
+	containers map[string]*container
+}
+
+func (c *ContainerFS) String() string {
+	return fmt.Sprintf("%v", c.baseFS)
+}
+
+func (c *ContainerFS) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var errs = []error{}
+	for name, cont := range c.containers {
+		if err := cont.closer(); err != nil {
+			errs = append(errs, errors.Wrapf(err, "cannot close container '%s'", name))
+		}
+		delete(c.containers, name)
+	}
+	return errors.Combine(errs...)
+}
+
+func (c *ContainerFS) acquire(name string) (*container, error) {
+	c.lock.Lock()
+	if cont, ok := c.containers[name]; ok {
+		cont.refs++
+		c.lock.Unlock()
+		return cont, nil
+	}
+	c.lock.Unlock()
+
+	fsys, inner, parent, err := c.resolve(name)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	fp, err := fsys.Open(inner)
+	if err != nil {
+		c.release(parent)
+		return nil, errors.Wrapf(err, "cannot open container '%s'", name)
+	}
+	cont, err := openContainer(fp, name)
+	c.release(parent)
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Debug().Msgf("opened container '%s'", name)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if existing, ok := c.containers[name]; ok {
+		// opened concurrently by another worker
+		existing.refs++
+		if err := cont.closer(); err != nil {
+			c.logger.Error().Err(err).Msgf("cannot close container '%s'", name)
+		}
+		return existing, nil
+	}
+	cont.refs = 1
+	c.containers[name] = cont
+	return cont, nil
+}
+
+func (c *ContainerFS) release(cont *container) {
+	if cont == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cont.refs--
+	if len(c.containers) <= containerCacheSize {
+		return
+	}
+	for name, cont := range c.containers {
+		if cont.refs > 0 {
+			continue
+		}
+		if err := cont.closer(); err != nil {
+			c.logger.Error().Err(err).Msgf("cannot close container '%s'", name)
+		}
+		delete(c.containers, name)
+		if len(c.containers) <= containerCacheSize {
+			return
+		}
+	}
+}
+
+// resolve returns the file system of the innermost container of name and the path inside of it
+func (c *ContainerFS) resolve(name string) (fsys fs.FS, inner string, cont *container, err error) {
+	parts := strings.Split(name, "/")
+	var candidates = []int{}
+	for i := 0; i < len(parts)-1 && uint(len(candidates)) < c.maxDepth; i++ {
+		if IsContainer(parts[i]) {
+			candidates = append(candidates, i)
+		}
+	}
+	for k := len(candidates) - 1; k >= 0; k-- {
+		i := candidates[k]
+		cont, err := c.acquire(strings.Join(parts[:i+1], "/"))
+		if err != nil {
+			if errors.Is(err, errNoContainer) {
+				continue
+			}
+			return nil, "", nil, err
+		}
+		return cont.fsys, strings.Join(parts[i+1:], "/"), cont, nil
+	}
+	return c.baseFS, name, nil, nil
+}
+
+// Container returns the path of the innermost container of name or an empty string
+func (c *ContainerFS) Container(name string) string {
+	parts := strings.Split(name, "/")
+	var result string
+	var depth uint
+	for i := 0; i < len(parts)-1 && depth < c.maxDepth; i++ {
+		if IsContainer(parts[i]) {
+			result = strings.Join(parts[:i+1], "/")
+			depth++
+		}
+	}
+	return result
+}
+
+func (c *ContainerFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	fsys, inner, cont, err := c.resolve(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	fp, err := fsys.Open(inner)
+	if err != nil {
+		c.release(cont)
+		return nil, err
+	}
+	if cont == nil {
+		return fp, nil
+	}
+	return &containerFile{File: fp, release: func() { c.release(cont) }}, nil
+}
+
+func (c *ContainerFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	fsys, inner, cont, err := c.resolve(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	defer c.release(cont)
+	return fs.Stat(fsys, inner)
+}
+
+func (c *ContainerFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	fsys, inner, cont, err := c.resolve(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	defer c.release(cont)
+	return fs.ReadDir(fsys, inner)
+}
+
+// WalkContainer calls do for every file inside of the container name including the content of nested containers
+func (c *ContainerFS) WalkContainer(name string, do func(path string) error) error {
+	// the container must be within the maximum nesting depth
+	if c.Container(name+"/_") != name {
+		return nil
+	}
+	cont, err := c.acquire(name)
+	if err != nil {
+		return errors.Wrapf(err, "cannot open container '%s'", name)
+	}
+	defer c.release(cont)
+	return errors.WithStack(fs.WalkDir(cont.fsys, ".", func(pathStr string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.Wrapf(err, "cannot walk %s/%s", name, pathStr)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fullpath := path.Join(name, pathStr)
+		if err := do(fullpath); err != nil {
+			return err
+		}
+		if IsContainer(pathStr) {
+			if err := c.WalkContainer(fullpath, do); err != nil {
+				c.logger.Error().Err(err).Msgf("cannot walk container '%s'", fullpath)
+			}
+		}
+		return nil
+	}))
+}
+
+type containerFile struct {
+	fs.File
+	release func()
+	once    sync.Once
+}
+
+func (f *containerFile) Close() error {
+	err := f.File.Close()
+	f.once.Do(f.release)
+	return err
+}
+
+func (f *containerFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if dir, ok := f.File.(fs.ReadDirFile); ok {
+		return dir.ReadDir(n)
+	}
+	return nil, &fs.PathError{Op: "readdir", Err: errors.New("not implemented")}
+}
@@ -0,0 +1,210 @@
+package identifier
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+// DataFS is the file system of a data root. Besides reading it allows to remove and rename files.
+type DataFS interface {
+	fs.FS
+	Remove(name string) error
+	RemoveAll(name string) error
+	Rename(oldName, newName string) error
+	Close() error
+}
+
+// LocationConfig contains the credentials for remote data roots
+type LocationConfig struct {
+	SFTP *SFTPConfig `toml:"sftp"`
+	S3   *S3Config   `toml:"s3"`
+}
+
+// IsRemoteLocation checks, whether location is an url of a remote data root
+func IsRemoteLocation(location string) bool {
+	return strings.Contains(location, "://")
+}
+
+// NormalizeLocation returns the location of a data root as stored in the sources of the database.
+// Local folders must exist, remote locations are not checked.
+func NormalizeLocation(location string, conf *LocationConfig) (string, error) {
+	if conf == nil {
+		conf = &LocationConfig{}
+	}
+	if scheme, _, found := strings.Cut(location, "://"); found {
+		switch strings.ToLower(scheme) {
+		case "sftp":
+			u, err := parseSFTPURL(location, conf.SFTP)
+			if err != nil {
+				return "", errors.WithStack(err)
+			}
+			return u.String(), nil
+		case "s3":
+			bucket, prefix, err := parseS3URL(location)
+			if err != nil {
+				return "", errors.WithStack(err)
+			}
+			return s3Location(bucket, prefix), nil
+		default:
+			return "", errors.Errorf("unsupported location '%s'", location)
+		}
+	}
+	dataPath, err := Fullpath(location)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot get full path for '%s'", location)
+	}
+	if fi, err := os.Stat(dataPath); err != nil || !fi.IsDir() {
+		return "", errors.Errorf("'%s' is not a directory", dataPath)
+	}
+	return dataPath, nil
+}
+
+// OpenLocation opens the data root at location and returns its normalized location.
+// Supported are local folders, sftp://user@host[:port]/path and s3://bucket/prefix urls.
+func OpenLocation(location string, conf *LocationConfig, logger zLogger.ZLogger) (DataFS, string, error) {
+	if conf == nil {
+		conf = &LocationConfig{}
+	}
+	location, err := NormalizeLocation(location, conf)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	var fsys DataFS
+	switch {
+	case strings.HasPrefix(location, "sftp://"):
+		fsys, err = NewSFTPFS(location, conf.SFTP, logger)
+	case strings.HasPrefix(location, "s3://"):
+		fsys, err = NewS3FS(location, conf.S3, logger)
+	default:
+		return NewLocalFS(location), location, nil
+	}
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	return fsys, location, nil
+}
+
+// NewLocalFS creates the file system of a local folder
+func NewLocalFS(root string) *LocalFS {
+	return &LocalFS{FS: os.DirFS(root), root: root}
+}
+
+type LocalFS struct {
+	fs.FS
+	root string
+}
+
+func (l *LocalFS) String() string {
+	return l.root
+}
+
+// Root returns the local folder
+func (l *LocalFS) Root() string {
+	return l.root
+}
+
+func (l *LocalFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(l.FS, name)
+}
+
+func (l *LocalFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(l.FS, name)
+}
+
+func (l *LocalFS) fullpath(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(l.root, filepath.FromSlash(name)), nil
+}
+
+func (l *LocalFS) Remove(name string) error {
+	fullpath, err := l.fullpath("remove", name)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(os.Remove(fullpath))
+}
+
+func (l *LocalFS) RemoveAll(name string) error {
+	fullpath, err := l.fullpath("removeall", name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return errors.Errorf("cannot remove root folder '%s'", l.root)
+	}
+	return errors.WithStack(os.RemoveAll(fullpath))
+}
+
+func (l *LocalFS) Rename(oldName, newName string) error {
+	oldPath, err := l.fullpath("rename", oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := l.fullpath("rename", newName)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(os.Rename(oldPath, newPath))
+}
+
+func (l *LocalFS) Close() error {
+	return nil
+}
+
+// dirFile is an opened folder of a remote file system. The entries are read on first use.
+type dirFile struct {
+	name    string
+	info    fs.FileInfo
+	readDir func(name string) ([]fs.DirEntry, error)
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dirFile) Close() error {
+	return nil
+}
+
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.readDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+var (
+	_ DataFS         = (*LocalFS)(nil)
+	_ DataFS         = (*SFTPFS)(nil)
+	_ DataFS         = (*S3FS)(nil)
+	_ fs.ReadDirFile = (*dirFile)(nil)
+)
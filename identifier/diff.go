@@ -0,0 +1,188 @@
+package identifier
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/checksum"
+)
+
+// DiffKind is the change of a file between two snapshots
+type DiffKind string
+
+const (
+	DiffAdded    DiffKind = "added"
+	DiffRemoved  DiffKind = "removed"
+	DiffModified DiffKind = "modified"
+	DiffTouched  DiffKind = "touched"
+	DiffMoved    DiffKind = "moved"
+)
+
+// DiffKinds are all changes in report order
+var DiffKinds = []DiffKind{DiffAdded, DiffRemoved, DiffModified, DiffTouched, DiffMoved}
+
+// DiffSide selects the files of a snapshot: the records of a source with a path prefix.
+// The paths are compared relative to the prefix.
+type DiffSide struct {
+	Store  Store
+	Source string
+	Prefix string
+}
+
+// DiffEntry is a changed file. Old... fields describe the file in the old snapshot.
+type DiffEntry struct {
+	Kind        DiffKind `json:"kind"`
+	Path        string   `json:"path"`
+	OldPath     string   `json:"oldpath,omitempty"`
+	Size        int64    `json:"size"`
+	OldSize     int64    `json:"oldsize"`
+	LastMod     int64    `json:"lastmod,omitempty"`
+	OldLastMod  int64    `json:"oldlastmod,omitempty"`
+	Checksum    string   `json:"checksum,omitempty"`
+	OldChecksum string   `json:"oldchecksum,omitempty"`
+}
+
+// Bytes returns the number of bytes affected by the change
+func (e *DiffEntry) Bytes() int64 {
+	if e.Kind == DiffRemoved {
+		return e.OldSize
+	}
+	return e.Size
+}
+
+// DiffSummary counts the changed files and bytes by kind
+type DiffSummary struct {
+	Files map[DiffKind]int64 `json:"files"`
+	Bytes map[DiffKind]int64 `json:"bytes"`
+}
+
+// diffFile is the part of a file record needed for the comparison
+type diffFile struct {
+	path     string
+	size     int64
+	lastMod  int64
+	checksum string
+}
+
+// loadDiffFiles reads the files of a snapshot by relative path
+func loadDiffFiles(side *DiffSide, digest checksum.DigestAlgorithm) (map[string]*diffFile, error) {
+	var files = map[string]*diffFile{}
+	prefix := []byte("file:")
+	if side.Source != "" {
+		prefix = FileKey(side.Source, side.Prefix)
+	}
+	if err := side.Store.View(func(txn Txn) error {
+		return txn.Iterate(prefix, func(key, value []byte) error {
+			fData := &FileData{}
+			if err := json.Unmarshal(value, fData); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal '%s'", key)
+			}
+			if !strings.HasPrefix(fData.Path, side.Prefix) {
+				return nil
+			}
+			path := strings.TrimPrefix(fData.Path, side.Prefix)
+			if _, ok := files[path]; ok {
+				return errors.Errorf("path '%s' exists in several sources - select a source", path)
+			}
+			file := &diffFile{path: path, size: fData.Size, lastMod: fData.LastMod}
+			if fData.Indexer != nil {
+				file.checksum = fData.Indexer.Checksum[string(digest)]
+			}
+			files[path] = file
+			return nil
+		})
+	}); err != nil {
+		return nil, errors.Wrapf(err, "cannot read files of source '%s' with prefix '%s'", side.Source, side.Prefix)
+	}
+	return files, nil
+}
+
+// Diff compares two snapshots by relative path and checksum and calls do for every changed file in path order.
+// Files with the same checksum are touched, if only the modification time has changed.
+// Removed and added files with the same checksum are reported as moved.
+func Diff(oldSide, newSide *DiffSide, digest checksum.DigestAlgorithm, do func(entry *DiffEntry) error) (*DiffSummary, error) {
+	oldFiles, err := loadDiffFiles(oldSide, digest)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := loadDiffFiles(newSide, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries = []*DiffEntry{}
+	var removed = map[string][]*diffFile{}
+	var added = []*diffFile{}
+	for path, oldFile := range oldFiles {
+		newFile, ok := newFiles[path]
+		if !ok {
+			removed[oldFile.checksum] = append(removed[oldFile.checksum], oldFile)
+			continue
+		}
+		entry := &DiffEntry{
+			Path:        path,
+			Size:        newFile.size,
+			OldSize:     oldFile.size,
+			LastMod:     newFile.lastMod,
+			OldLastMod:  oldFile.lastMod,
+			Checksum:    newFile.checksum,
+			OldChecksum: oldFile.checksum,
+		}
+		switch {
+		case oldFile.size != newFile.size || oldFile.checksum != newFile.checksum:
+			entry.Kind = DiffModified
+		case oldFile.lastMod != newFile.lastMod:
+			// without checksums the content is unknown
+			if oldFile.checksum == "" {
+				entry.Kind = DiffModified
+			} else {
+				entry.Kind = DiffTouched
+			}
+		default:
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	for path, newFile := range newFiles {
+		if _, ok := oldFiles[path]; !ok {
+			added = append(added, newFile)
+		}
+	}
+
+	// moves are assigned in path order, so the result does not depend on the map order
+	sort.Slice(added, func(i, j int) bool { return added[i].path < added[j].path })
+	for _, files := range removed {
+		sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	}
+	for _, newFile := range added {
+		entry := &DiffEntry{Kind: DiffAdded, Path: newFile.path, Size: newFile.size, LastMod: newFile.lastMod, Checksum: newFile.checksum}
+		if candidates := removed[newFile.checksum]; newFile.checksum != "" && newFile.size > 0 && len(candidates) > 0 {
+			oldFile := candidates[0]
+			removed[newFile.checksum] = candidates[1:]
+			entry.Kind = DiffMoved
+			entry.OldPath = oldFile.path
+			entry.OldSize = oldFile.size
+			entry.OldLastMod = oldFile.lastMod
+			entry.OldChecksum = oldFile.checksum
+		}
+		entries = append(entries, entry)
+	}
+	for _, files := range removed {
+		for _, oldFile := range files {
+			entries = append(entries, &DiffEntry{Kind: DiffRemoved, Path: oldFile.path, OldSize: oldFile.size, OldLastMod: oldFile.lastMod, OldChecksum: oldFile.checksum})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	summary := &DiffSummary{Files: map[DiffKind]int64{}, Bytes: map[DiffKind]int64{}}
+	for _, entry := range entries {
+		summary.Files[entry.Kind]++
+		summary.Bytes[entry.Kind] += entry.Bytes()
+		if err := do(entry); err != nil {
+			return summary, errors.WithStack(err)
+		}
+	}
+	return summary, nil
+}
@@ -0,0 +1,200 @@
+package identifier
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/checksum"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+// DumpFormat identifies the header line of database dumps
+const DumpFormat = "identifier-dump"
+
+// DumpHeader is the first line of a dump and describes the dumped database
+type DumpHeader struct {
+	Format   string                     `json:"format"`
+	Schema   int                        `json:"schema"`
+	Created  int64                      `json:"created"`
+	Host     string                     `json:"host,omitempty"`
+	Database string                     `json:"database,omitempty"`
+	Sources  []*Source                  `json:"sources"`
+	Digests  []checksum.DigestAlgorithm `json:"digests"`
+}
+
+// DumpRecord is a line of a dump. Values, which are no json, are stored in Data.
+type DumpRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Data  []byte          `json:"data,omitempty"`
+}
+
+// dumpSkipped checks, whether the record is not part of dumps and merges.
+// Secondary indexes are derived from the file records, the schema is part of the header.
+func dumpSkipped(key []byte) bool {
+	return bytes.HasPrefix(key, []byte(secondaryPrefix)) || string(key) == schemaKey
+}
+
+// Dump writes all records of the database as gzip compressed json lines to w
+func Dump(store Store, location string, w io.Writer) (int64, error) {
+	schema, err := LoadSchema(store)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	header := &DumpHeader{
+		Format:   DumpFormat,
+		Schema:   schema.Version,
+		Created:  time.Now().Unix(),
+		Database: location,
+	}
+	header.Host, _ = os.Hostname()
+	if err := store.View(func(txn Txn) error {
+		if header.Sources, err = loadSources(txn); err != nil {
+			return err
+		}
+		header.Digests, err = loadDigests(txn)
+		return err
+	}); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(header); err != nil {
+		return 0, errors.Wrap(err, "cannot write dump header")
+	}
+	var count int64
+	if err := store.View(func(txn Txn) error {
+		return txn.Iterate([]byte{}, func(key, value []byte) error {
+			if dumpSkipped(key) {
+				return nil
+			}
+			record := &DumpRecord{Key: string(key)}
+			if json.Valid(value) {
+				record.Value = json.RawMessage(value)
+			} else {
+				record.Data = value
+			}
+			if err := enc.Encode(record); err != nil {
+				return errors.Wrapf(err, "cannot write '%s'", key)
+			}
+			count++
+			return nil
+		})
+	}); err != nil {
+		return count, errors.Wrap(err, "cannot dump records")
+	}
+	return count, errors.Wrap(zw.Close(), "cannot close dump")
+}
+
+// ReadDumpHeader reads the header of a dump and returns a reader for the records
+func ReadDumpHeader(r io.Reader) (*DumpHeader, *json.Decoder, error) {
+	zr, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot open dump")
+	}
+	dec := json.NewDecoder(zr)
+	header := &DumpHeader{}
+	if err := dec.Decode(header); err != nil {
+		return nil, nil, errors.Wrap(err, "cannot read dump header")
+	}
+	if header.Format != DumpFormat {
+		return nil, nil, errors.Errorf("no database dump (format '%s')", header.Format)
+	}
+	if header.Schema > SchemaVersion {
+		return nil, nil, errors.Wrapf(ErrSchemaUnsupported, "schema version %d of dump, supported version %d", header.Schema, SchemaVersion)
+	}
+	return header, dec, nil
+}
+
+// Restore writes the records of a dump into an empty database.
+// Dumps of older schema versions are restored with their version and must be migrated with 'db migrate'.
+func Restore(store Store, r io.Reader, logger zLogger.ZLogger) (*DumpHeader, int64, error) {
+	var empty = true
+	if err := store.View(func(txn Txn) error {
+		return txn.IterateKeys([]byte{}, func(key []byte) error {
+			if string(key) != schemaKey {
+				empty = false
+				return errStopIteration
+			}
+			return nil
+		})
+	}); err != nil && !errors.Is(err, errStopIteration) {
+		return nil, 0, errors.Wrap(err, "cannot read database")
+	}
+	if !empty {
+		return nil, 0, errors.New("database is not empty - use 'db merge'")
+	}
+	header, dec, err := ReadDumpHeader(r)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	var count int64
+	var batch = []*DumpRecord{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := store.Update(func(txn Txn) error {
+			for _, record := range batch {
+				if err := txn.Set([]byte(record.Key), record.value()); err != nil {
+					return errors.Wrapf(err, "cannot write '%s'", record.Key)
+				}
+			}
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "cannot write records")
+		}
+		count += int64(len(batch))
+		logger.Info().Msgf("%d records restored", count)
+		batch = []*DumpRecord{}
+		return nil
+	}
+	for {
+		record := &DumpRecord{}
+		if err := dec.Decode(record); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return header, count, errors.Wrapf(err, "cannot read record %d of dump", count+int64(len(batch))+1)
+		}
+		if dumpSkipped([]byte(record.Key)) {
+			continue
+		}
+		batch = append(batch, record)
+		if len(batch) >= migrationBatch {
+			if err := flush(); err != nil {
+				return header, count, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return header, count, err
+	}
+	if err := storeSchema(store, &Schema{Version: header.Schema, Created: time.Now().Unix()}); err != nil {
+		return header, count, errors.WithStack(err)
+	}
+	if header.Schema < SchemaVersion {
+		logger.Warn().Msgf("dump has schema version %d - use 'db migrate'", header.Schema)
+		return header, count, nil
+	}
+	if _, err := RebuildSecondary(store, logger); err != nil {
+		return header, count, errors.WithStack(err)
+	}
+	return header, count, nil
+}
+
+func (r *DumpRecord) value() []byte {
+	if r.Value != nil {
+		return r.Value
+	}
+	return r.Data
+}
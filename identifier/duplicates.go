@@ -0,0 +1,291 @@
+package identifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/checksum"
+)
+
+// number of retries for transactions with conflicts
+const txnRetries = 10
+
+// serializes updates of duplicate groups
+var sumLock sync.Mutex
+
+// fileRef addresses a file record
+type fileRef struct {
+	source string
+	path   string
+}
+
+func updateWithRetry(store Store, fn func(txn Txn) error) error {
+	var err error
+	for i := 0; i < txnRetries; i++ {
+		if err = store.Update(fn); !errors.Is(err, ErrConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+func getFileData(txn Txn, source, path string) (*FileData, error) {
+	key := FileKey(source, path)
+	value, err := getValue(txn, key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	fData := &FileData{}
+	if err := json.Unmarshal(value, fData); err != nil {
+		return nil, errors.Wrapf(err, "cannot unmarshal '%s'", key)
+	}
+	return fData, nil
+}
+
+func setFileData(txn Txn, fData *FileData) error {
+	key := FileKey(fData.Source, fData.Path)
+	value, err := json.Marshal(fData)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal '%s'", key)
+	}
+	if err := txn.Set(key, value); err != nil {
+		return errors.Wrapf(err, "cannot write '%s'", key)
+	}
+	return setSecondaryKeys(txn, fData)
+}
+
+// groupFiles returns all files with the checksum
+func groupFiles(txn Txn, digest checksum.DigestAlgorithm, sum string) ([]fileRef, error) {
+	var files = []fileRef{}
+	prefix := sumPrefix(digest, sum)
+	if err := txn.IterateKeys(prefix, func(key []byte) error {
+		source, path, _ := strings.Cut(string(bytes.TrimPrefix(key, prefix)), ":")
+		files = append(files, fileRef{source: source, path: path})
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "cannot read '%s'", prefix)
+	}
+	return files, nil
+}
+
+// LoadFileData reads the record of a file from the database and returns nil, if it does not exist
+func LoadFileData(store Store, source, path string) (*FileData, error) {
+	var fData *FileData
+	if err := store.View(func(txn Txn) error {
+		var err error
+		fData, err = getFileData(txn, source, path)
+		return err
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return fData, nil
+}
+
+// StoreFileData writes the record of a file and maintains its duplicate group.
+// All files of a group with more than one member are marked as duplicate.
+func StoreFileData(store Store, fData *FileData, dupDigest checksum.DigestAlgorithm) error {
+	sumLock.Lock()
+	defer sumLock.Unlock()
+	return errors.WithStack(updateWithRetry(store, func(txn Txn) error {
+		old, err := getFileData(txn, fData.Source, fData.Path)
+		if err != nil {
+			return err
+		}
+		if old != nil {
+			if err := deleteSecondaryKeys(txn, old); err != nil {
+				return err
+			}
+			// the file left the group of its former checksum
+			if old.Indexer != nil {
+				if oldSum := old.Indexer.Checksum[string(dupDigest)]; oldSum != "" && oldSum != fData.Indexer.Checksum[string(dupDigest)] {
+					if err := releaseLastCopy(txn, dupDigest, oldSum); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		fData.Duplicate = false
+		if sum := fData.Indexer.Checksum[string(dupDigest)]; sum != "" && fData.Size > 0 {
+			refs, err := groupFiles(txn, dupDigest, sum)
+			if err != nil {
+				return err
+			}
+			for _, ref := range refs {
+				if ref.source == fData.Source && ref.path == fData.Path {
+					continue
+				}
+				fData.Duplicate = true
+				other, err := getFileData(txn, ref.source, ref.path)
+				if err != nil {
+					return err
+				}
+				if other != nil && !other.Duplicate {
+					other.Duplicate = true
+					if err := setFileData(txn, other); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return setFileData(txn, fData)
+	}))
+}
+
+type KeepPolicy string
+
+const (
+	KeepShortest KeepPolicy = "shortest"
+	KeepOldest   KeepPolicy = "oldest"
+	KeepPrefix   KeepPolicy = "prefix"
+)
+
+type DuplicateFile struct {
+	Source    string `json:"source"`
+	Path      string `json:"path"`
+	LastMod   int64  `json:"lastmod"`
+	Container string `json:"container,omitempty"`
+}
+
+type DuplicateGroup struct {
+	Digest   checksum.DigestAlgorithm `json:"digest"`
+	Checksum string                   `json:"checksum"`
+	Size     int64                    `json:"size"`
+	Files    []*DuplicateFile         `json:"files"`
+}
+
+// Wasted returns the number of bytes used by redundant copies
+func (g *DuplicateGroup) Wasted() int64 {
+	return g.Size * int64(len(g.Files)-1)
+}
+
+// Sort orders the files of the group by keeper policy, the file to be kept first
+func (g *DuplicateGroup) Sort(policy KeepPolicy, prefix string) {
+	shorter := func(a, b *DuplicateFile) bool {
+		if len(a.Path) != len(b.Path) {
+			return len(a.Path) < len(b.Path)
+		}
+		return a.Path < b.Path
+	}
+	sort.SliceStable(g.Files, func(i, j int) bool {
+		a, b := g.Files[i], g.Files[j]
+		// files inside of containers cannot be kept alone
+		if (a.Container == "") != (b.Container == "") {
+			return a.Container == ""
+		}
+		switch policy {
+		case KeepOldest:
+			if a.LastMod != b.LastMod {
+				return a.LastMod < b.LastMod
+			}
+		case KeepPrefix:
+			aPrefix, bPrefix := strings.HasPrefix(a.Path, prefix), strings.HasPrefix(b.Path, prefix)
+			if aPrefix != bPrefix {
+				return aPrefix
+			}
+		}
+		return shorter(a, b)
+	})
+}
+
+// IterateDuplicates calls do for every group of files sharing the same checksum.
+// If source is not empty, only files of this source are considered.
+func (r *StoreIterator) IterateDuplicates(digest checksum.DigestAlgorithm, source string, do func(group *DuplicateGroup) error) error {
+	prefix := []byte(fmt.Sprintf("%s%s:%s:", secondaryPrefix, IndexSum, digest))
+	var group *DuplicateGroup
+	flush := func() error {
+		if group == nil || len(group.Files) < 2 {
+			return nil
+		}
+		return do(group)
+	}
+	if err := r.store.View(func(txn Txn) error {
+		if err := txn.Iterate(prefix, func(key, value []byte) error {
+			parts := strings.SplitN(string(bytes.TrimPrefix(key, prefix)), ":", 3)
+			if len(parts) != 3 {
+				return nil
+			}
+			sum, fileSource, path := parts[0], parts[1], parts[2]
+			if source != "" && fileSource != source {
+				return nil
+			}
+			entry := &IndexEntry{}
+			if err := json.Unmarshal(value, entry); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal '%s'", key)
+			}
+			if entry.Size == 0 {
+				return nil
+			}
+			if group == nil || group.Checksum != sum {
+				if err := flush(); err != nil {
+					return err
+				}
+				group = &DuplicateGroup{Digest: digest, Checksum: sum, Size: entry.Size}
+			}
+			group.Files = append(group.Files, &DuplicateFile{Source: fileSource, Path: path, LastMod: entry.LastMod, Container: entry.Container})
+			return nil
+		}); err != nil {
+			return err
+		}
+		return flush()
+	}); err != nil {
+		return errors.Wrapf(err, "cannot iterate duplicates of '%s'", digest)
+	}
+	return nil
+}
+
+// RemoveFileData deletes the record and the fixity events of a file and updates its duplicate groups
+func (r *StoreIterator) RemoveFileData(source, path string) error {
+	if r.readOnly {
+		return errors.New("cannot remove record from read only database")
+	}
+	sumLock.Lock()
+	defer sumLock.Unlock()
+	return errors.WithStack(updateWithRetry(r.store, func(txn Txn) error {
+		fData, err := getFileData(txn, source, path)
+		if err != nil || fData == nil {
+			return err
+		}
+		if err := deleteSecondaryKeys(txn, fData); err != nil {
+			return err
+		}
+		if err := txn.Delete(FileKey(source, path)); err != nil {
+			return errors.Wrapf(err, "cannot delete '%s'", FileKey(source, path))
+		}
+		if err := deleteFixityEvents(txn, source, path); err != nil {
+			return err
+		}
+		if fData.Indexer == nil {
+			return nil
+		}
+		for alg, sum := range fData.Indexer.Checksum {
+			if err := releaseLastCopy(txn, checksum.DigestAlgorithm(alg), sum); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// releaseLastCopy clears the duplicate flag of the file with the checksum, if it is the last remaining copy
+func releaseLastCopy(txn Txn, digest checksum.DigestAlgorithm, sum string) error {
+	others, err := groupFiles(txn, digest, sum)
+	if err != nil || len(others) != 1 {
+		return err
+	}
+	other, err := getFileData(txn, others[0].source, others[0].path)
+	if err != nil {
+		return err
+	}
+	if other != nil && other.Duplicate {
+		other.Duplicate = false
+		if err := setFileData(txn, other); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package identifier
+
+import (
+	"bufio"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// IgnoreFile is read from the root of a walk and contains gitignore-style exclude patterns
+const IgnoreFile = ".identifierignore"
+
+type ignoreRule struct {
+	pattern string
+	regex   *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// globToRegexp converts a gitignore glob to a regular expression
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			sb.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
+
+// newIgnoreRule parses a line of gitignore syntax and returns nil for empty lines and comments
+func newIgnoreRule(line string) (*ignoreRule, error) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+	rule := &ignoreRule{pattern: line}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil, nil
+	}
+	// patterns with a slash are relative to the root, all others match on every level
+	var prefix = "^(?:.*/)?"
+	if strings.Contains(line, "/") {
+		prefix = "^"
+		line = strings.TrimPrefix(line, "/")
+	}
+	regex, err := regexp.Compile(prefix + globToRegexp(line) + "$")
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid pattern '%s'", rule.pattern)
+	}
+	rule.regex = regex
+	return rule, nil
+}
+
+// NewWalkFilter creates a filter for walking a data root.
+// excludes are gitignore-style patterns (including negation with '!'). If includes are given,
+// only files matching at least one of them are accepted.
+// maxDepth limits the depth of files below the root (0: unlimited), maxSize 0 means no upper limit.
+func NewWalkFilter(excludes, includes []string, maxDepth int, minSize, maxSize int64) (*WalkFilter, error) {
+	f := &WalkFilter{maxDepth: maxDepth, minSize: minSize, maxSize: maxSize}
+	if err := f.AddExcludes(excludes...); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, include := range includes {
+		rule, err := newIgnoreRule(include)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if rule != nil {
+			f.includes = append(f.includes, rule)
+		}
+	}
+	return f, nil
+}
+
+// WalkFilter decides, which files and folders of a data root are processed.
+// A nil filter accepts everything.
+type WalkFilter struct {
+	excludes []*ignoreRule
+	includes []*ignoreRule
+	maxDepth int
+	minSize  int64
+	maxSize  int64
+}
+
+// AddExcludes appends gitignore-style patterns, later patterns take precedence
+func (f *WalkFilter) AddExcludes(patterns ...string) error {
+	for _, pattern := range patterns {
+		rule, err := newIgnoreRule(pattern)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if rule != nil {
+			f.excludes = append(f.excludes, rule)
+		}
+	}
+	return nil
+}
+
+// AddIgnoreFile reads the exclude patterns of the ignore file in the root of fsys, if it exists.
+// The patterns of the ignore file take precedence over the patterns given before.
+func (f *WalkFilter) AddIgnoreFile(fsys fs.FS) error {
+	fp, err := fsys.Open(IgnoreFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return errors.Wrapf(err, "cannot open '%s'", IgnoreFile)
+	}
+	defer fp.Close()
+	var patterns = []string{}
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrapf(err, "cannot read '%s'", IgnoreFile)
+	}
+	return errors.Wrapf(f.AddExcludes(patterns...), "invalid pattern in '%s'", IgnoreFile)
+}
+
+func (f *WalkFilter) excluded(pathStr string, isDir bool) bool {
+	var result bool
+	for _, rule := range f.excludes {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.regex.MatchString(pathStr) {
+			result = !rule.negate
+		}
+	}
+	return result
+}
+
+// SkipDir checks, whether the folder and its content must be skipped
+func (f *WalkFilter) SkipDir(pathStr string) bool {
+	if f == nil || pathStr == "." || pathStr == "" {
+		return false
+	}
+	if f.maxDepth > 0 && strings.Count(pathStr, "/")+1 >= f.maxDepth {
+		return true
+	}
+	return f.excluded(pathStr, true)
+}
+
+// SkipFile checks, whether the file must be skipped.
+// Parent folders are checked too, so that files inside of containers are filtered like files on disk.
+func (f *WalkFilter) SkipFile(pathStr string, size int64) bool {
+	if f == nil {
+		return false
+	}
+	if f.maxDepth > 0 && strings.Count(pathStr, "/")+1 > f.maxDepth {
+		return true
+	}
+	if size < f.minSize || (f.maxSize > 0 && size > f.maxSize) {
+		return true
+	}
+	for dir := path.Dir(pathStr); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if f.excluded(dir, true) {
+			return true
+		}
+	}
+	if f.excluded(pathStr, false) {
+		return true
+	}
+	if len(f.includes) == 0 {
+		return false
+	}
+	for _, rule := range f.includes {
+		if !rule.dirOnly && rule.regex.MatchString(pathStr) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+package identifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/checksum"
+)
+
+const (
+	FixityOK         = "ok"
+	FixityMismatch   = "mismatch"
+	FixityMissing    = "missing"
+	FixityUnreadable = "unreadable"
+	// FixityNoChecksum is the outcome for files without a stored checksum of a supported algorithm
+	FixityNoChecksum = "nochecksum"
+	// FixityChanged is the outcome for files, which have been modified since they have been indexed (size or modification time)
+	FixityChanged = "changed"
+)
+
+type FixityEvent struct {
+	Time    int64  `json:"time"`
+	Outcome string `json:"outcome"`
+	Message string `json:"message,omitempty"`
+}
+
+// VerifyFile re-hashes a file and compares the result with the stored checksums.
+// Files with different size or modification time are reported as changed without reading them,
+// a mismatch is a change of the content, which left size and modification time untouched.
+func VerifyFile(fsys fs.FS, fData *FileData) *FixityEvent {
+	event := &FixityEvent{Time: time.Now().Unix()}
+	if fData.Indexer == nil || len(fData.Indexer.Checksum) == 0 {
+		event.Outcome = FixityNoChecksum
+		event.Message = "no checksums stored"
+		return event
+	}
+	var digests = []checksum.DigestAlgorithm{}
+	for alg := range fData.Indexer.Checksum {
+		digest := checksum.DigestAlgorithm(alg)
+		if checksum.HashExists(digest) {
+			digests = append(digests, digest)
+		}
+	}
+	if len(digests) == 0 {
+		event.Outcome = FixityNoChecksum
+		event.Message = "no checksums of supported algorithms stored"
+		return event
+	}
+	sort.Slice(digests, func(i, j int) bool { return digests[i] < digests[j] })
+
+	fp, err := fsys.Open(fData.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			event.Outcome = FixityMissing
+		} else {
+			event.Outcome = FixityUnreadable
+		}
+		event.Message = err.Error()
+		return event
+	}
+	defer fp.Close()
+	finfo, err := fp.Stat()
+	if err != nil {
+		event.Outcome = FixityUnreadable
+		event.Message = err.Error()
+		return event
+	}
+	if finfo.Size() != fData.Size {
+		event.Outcome = FixityChanged
+		event.Message = fmt.Sprintf("size: expected %d, got %d", fData.Size, finfo.Size())
+		return event
+	}
+	if !unchanged(fData, finfo) {
+		event.Outcome = FixityChanged
+		if etag := ETagOf(finfo); etag != "" {
+			event.Message = fmt.Sprintf("etag: expected %s, got %s", fData.ETag, etag)
+		} else {
+			event.Message = fmt.Sprintf("lastmod: expected %s, got %s", time.Unix(fData.LastMod, 0).Format(time.RFC3339), finfo.ModTime().Format(time.RFC3339))
+		}
+		return event
+	}
+	sums, err := checksum.Copy(digests, fp)
+	if err != nil {
+		event.Outcome = FixityUnreadable
+		event.Message = err.Error()
+		return event
+	}
+	var mismatches = []string{}
+	for _, digest := range digests {
+		if expected := fData.Indexer.Checksum[string(digest)]; !strings.EqualFold(expected, sums[digest]) {
+			mismatches = append(mismatches, fmt.Sprintf("%s: expected %s, got %s", digest, expected, sums[digest]))
+		}
+	}
+	if len(mismatches) > 0 {
+		event.Outcome = FixityMismatch
+		event.Message = strings.Join(mismatches, "; ")
+		return event
+	}
+	event.Outcome = FixityOK
+	return event
+}
+
+func fixityPrefix(source, path string) []byte {
+	return []byte("fixity:" + source + ":" + path + ":")
+}
+
+func fixityKey(source, path string, t int64) []byte {
+	return []byte(fmt.Sprintf("fixity:%s:%s:%d", source, path, t))
+}
+
+// deleteFixityEvents removes the fixity events of a file
+func deleteFixityEvents(txn Txn, source, path string) error {
+	prefix := fixityPrefix(source, path)
+	var keys = [][]byte{}
+	if err := txn.IterateKeys(prefix, func(key []byte) error {
+		// the prefix matches paths continuing with ':' as well
+		if _, err := strconv.ParseInt(string(bytes.TrimPrefix(key, prefix)), 10, 64); err == nil {
+			keys = append(keys, bytes.Clone(key))
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "cannot read fixity events of '%s'", FileKey(source, path))
+	}
+	for _, key := range keys {
+		if err := txn.Delete(key); err != nil {
+			return errors.Wrapf(err, "cannot delete '%s'", key)
+		}
+	}
+	return nil
+}
+
+// AddFixityEvent stores the event in the history of the file and as last fixity check in the file record
+func (r *StoreIterator) AddFixityEvent(source, path string, event *FixityEvent) error {
+	if r.readOnly {
+		return errors.New("cannot store fixity event in read only database")
+	}
+	eventData, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal fixity event")
+	}
+	return errors.WithStack(updateWithRetry(r.store, func(txn Txn) error {
+		fData, err := getFileData(txn, source, path)
+		if err != nil {
+			return err
+		}
+		if fData == nil {
+			return errors.Errorf("no record for '%s'", FileKey(source, path))
+		}
+		fData.Fixity = event
+		if err := setFileData(txn, fData); err != nil {
+			return err
+		}
+		eventKey := fixityKey(source, path, event.Time)
+		if err := txn.Set(eventKey, eventData); err != nil {
+			return errors.Wrapf(err, "cannot write '%s'", eventKey)
+		}
+		return nil
+	}))
+}
@@ -0,0 +1,33 @@
+package identifier
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ocfl-archive/indexer/v3/pkg/indexer"
+)
+
+func TestVerifyFileChanged(t *testing.T) {
+	lastMod := time.Unix(1000, 0)
+	fsys := fstest.MapFS{
+		"a.txt": &fstest.MapFile{Data: []byte("hello"), ModTime: lastMod},
+	}
+	// sha512 of "world", which has the same size as "hello"
+	const sum = "11853df40f4b2b919d3815f64792e58d08663767a494bcbb38c0b2389d9140bbb170281b4a847be7757bde12c9cd0054ce3652d0ad3a1a0c92babb69798246ee"
+	for _, tc := range []struct {
+		name    string
+		size    int64
+		lastMod int64
+		outcome string
+	}{
+		{"size", 6, lastMod.Unix(), FixityChanged},
+		{"lastmod", 5, lastMod.Unix() + 1, FixityChanged},
+		{"content", 5, lastMod.Unix(), FixityMismatch},
+	} {
+		fData := &FileData{Path: "a.txt", Size: tc.size, LastMod: tc.lastMod, Indexer: &indexer.ResultV2{Checksum: map[string]string{"sha512": sum}}}
+		if event := VerifyFile(fsys, fData); event.Outcome != tc.outcome {
+			t.Errorf("%s: got %s (%s), want %s", tc.name, event.Outcome, event.Message, tc.outcome)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package identifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"emperror.dev/errors"
+)
+
+// HistoryEntry is a former version of a file record, stored as "hist:<source>:<path>:<archived>"
+type HistoryEntry struct {
+	// Archived is the time, the record has been replaced
+	Archived int64 `json:"archived"`
+	*FileData
+}
+
+func historyPrefix(source, path string) []byte {
+	return []byte("hist:" + source + ":" + path + ":")
+}
+
+func historyKey(source, path string, archived int64) []byte {
+	return []byte(fmt.Sprintf("hist:%s:%s:%d", source, path, archived))
+}
+
+// StoreHistory archives the record of a file before it is replaced by a new version
+func StoreHistory(store Store, fData *FileData, archived int64) error {
+	key := historyKey(fData.Source, fData.Path, archived)
+	data, err := json.Marshal(fData)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal '%s'", key)
+	}
+	return errors.WithStack(updateWithRetry(store, func(txn Txn) error {
+		return errors.Wrapf(txn.Set(key, data), "cannot write '%s'", key)
+	}))
+}
+
+// LoadHistory returns the archived records of a file, oldest first
+func LoadHistory(store Store, source, path string) ([]*HistoryEntry, error) {
+	var entries = []*HistoryEntry{}
+	prefix := historyPrefix(source, path)
+	if err := store.View(func(txn Txn) error {
+		return txn.Iterate(prefix, func(key, value []byte) error {
+			// the prefix matches paths continuing with ':' as well
+			archived, err := strconv.ParseInt(string(bytes.TrimPrefix(key, prefix)), 10, 64)
+			if err != nil {
+				return nil
+			}
+			entry := &HistoryEntry{Archived: archived, FileData: &FileData{}}
+			if err := json.Unmarshal(value, entry.FileData); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal '%s'", key)
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	}); err != nil {
+		return nil, errors.Wrapf(err, "cannot read history of '%s'", FileKey(source, path))
+	}
+	return entries, nil
+}
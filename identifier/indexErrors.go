@@ -0,0 +1,116 @@
+package identifier
+
+import (
+	"encoding/json"
+	"io/fs"
+	"regexp"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+const (
+	ActionStat  = "stat"
+	ActionOpen  = "open"
+	ActionIndex = "index"
+)
+
+// IndexError is the value of an error key "error:<source>:<path>" and documents a file, which could not be indexed
+type IndexError struct {
+	Source   string `json:"source"`
+	Path     string `json:"path"`
+	Action   string `json:"action"`
+	Message  string `json:"message"`
+	Attempts int64  `json:"attempts"`
+	First    int64  `json:"first"`
+	Time     int64  `json:"time"`
+}
+
+func errorKey(source, path string) []byte {
+	return []byte("error:" + source + ":" + path)
+}
+
+var actionRegexp = regexp.MustCompile(`action '([^']+)'`)
+
+// FailedAction guesses the step of the indexer, which caused err
+func FailedAction(err error) string {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		return ActionOpen
+	}
+	if matches := actionRegexp.FindStringSubmatch(err.Error()); matches != nil {
+		return matches[1]
+	}
+	return ActionIndex
+}
+
+func getIndexError(txn Txn, source, path string) (*IndexError, error) {
+	value, err := getValue(txn, errorKey(source, path))
+	if err != nil || value == nil {
+		return nil, err
+	}
+	indexError := &IndexError{}
+	if err := json.Unmarshal(value, indexError); err != nil {
+		return nil, errors.Wrapf(err, "cannot unmarshal '%s'", errorKey(source, path))
+	}
+	return indexError, nil
+}
+
+// StoreIndexError records the failure of a file and counts the attempts
+func StoreIndexError(store Store, source, path, action string, indexErr error) error {
+	return errors.WithStack(updateWithRetry(store, func(txn Txn) error {
+		indexError, err := getIndexError(txn, source, path)
+		if err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		if indexError == nil {
+			indexError = &IndexError{Source: source, Path: path, First: now}
+		}
+		indexError.Action = action
+		indexError.Message = indexErr.Error()
+		indexError.Attempts++
+		indexError.Time = now
+		data, err := json.Marshal(indexError)
+		if err != nil {
+			return errors.Wrapf(err, "cannot marshal '%s'", errorKey(source, path))
+		}
+		return errors.Wrapf(txn.Set(errorKey(source, path), data), "cannot write '%s'", errorKey(source, path))
+	}))
+}
+
+// ClearIndexError removes the error record of a file, if there is one
+func ClearIndexError(store Store, source, path string) error {
+	return errors.WithStack(updateWithRetry(store, func(txn Txn) error {
+		if value, err := getValue(txn, errorKey(source, path)); err != nil || value == nil {
+			return err
+		}
+		return errors.Wrapf(txn.Delete(errorKey(source, path)), "cannot delete '%s'", errorKey(source, path))
+	}))
+}
+
+// LoadIndexErrors returns the error records of a source or of all sources, if source is empty
+func LoadIndexErrors(store Store, source string) ([]*IndexError, error) {
+	var indexErrors = []*IndexError{}
+	prefix := "error:"
+	if source != "" {
+		prefix = string(errorKey(source, ""))
+	}
+	if err := store.View(func(txn Txn) error {
+		return txn.Iterate([]byte(prefix), func(key, value []byte) error {
+			indexError := &IndexError{}
+			if err := json.Unmarshal(value, indexError); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal '%s'", key)
+			}
+			indexErrors = append(indexErrors, indexError)
+			return nil
+		})
+	}); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate error records")
+	}
+	return indexErrors, nil
+}
+
+// IndexErrors returns the error records of a source or of all sources, if source is empty
+func (r *StoreIterator) IndexErrors(source string) ([]*IndexError, error) {
+	return LoadIndexErrors(r.store, source)
+}
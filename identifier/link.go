@@ -0,0 +1,167 @@
+package identifier
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+type LinkMode string
+
+const (
+	LinkHard    LinkMode = "hardlink"
+	LinkReflink LinkMode = "reflink"
+)
+
+var ErrReflinkNotSupported = errors.New("reflinks are not supported")
+
+// LinkInfo marks a file, which has been replaced by a link to an identical copy
+type LinkInfo struct {
+	Source string   `json:"source"`
+	Target string   `json:"target"`
+	Mode   LinkMode `json:"mode"`
+	Time   int64    `json:"time"`
+}
+
+// SameContent compares two files byte by byte
+func SameContent(name1, name2 string) (bool, error) {
+	fp1, err := os.Open(name1)
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot open '%s'", name1)
+	}
+	defer fp1.Close()
+	fp2, err := os.Open(name2)
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot open '%s'", name2)
+	}
+	defer fp2.Close()
+	r1 := bufio.NewReaderSize(fp1, 1024*1024)
+	r2 := bufio.NewReaderSize(fp2, 1024*1024)
+	buf1 := make([]byte, 64*1024)
+	buf2 := make([]byte, 64*1024)
+	for {
+		n1, err1 := io.ReadFull(r1, buf1)
+		n2, err2 := io.ReadFull(r2, buf2)
+		if n1 != n2 || !bytes.Equal(buf1[:n1], buf2[:n2]) {
+			return false, nil
+		}
+		eof1 := err1 == io.EOF || err1 == io.ErrUnexpectedEOF
+		eof2 := err2 == io.EOF || err2 == io.ErrUnexpectedEOF
+		if err1 != nil && !eof1 {
+			return false, errors.Wrapf(err1, "cannot read '%s'", name1)
+		}
+		if err2 != nil && !eof2 {
+			return false, errors.Wrapf(err2, "cannot read '%s'", name2)
+		}
+		if eof1 || eof2 {
+			return eof1 == eof2, nil
+		}
+	}
+}
+
+// ReplaceWithLink replaces dup with a hard link or reflink to keep after verifying, that both files are identical.
+// The link is created next to dup and renamed afterwards, so dup is never lost.
+func ReplaceWithLink(keep, dup string, mode LinkMode) error {
+	equal, err := SameContent(keep, dup)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !equal {
+		return errors.Errorf("'%s' and '%s' differ", keep, dup)
+	}
+	dupInfo, err := os.Stat(dup)
+	if err != nil {
+		return errors.Wrapf(err, "cannot stat '%s'", dup)
+	}
+	tmp := filepath.Join(filepath.Dir(dup), fmt.Sprintf(".%s.identifier-%d", filepath.Base(dup), time.Now().UnixNano()))
+	switch mode {
+	case LinkHard:
+		if err := os.Link(keep, tmp); err != nil {
+			return errors.Wrapf(err, "cannot link '%s' to '%s'", keep, tmp)
+		}
+	case LinkReflink:
+		if err := reflink(keep, tmp, dupInfo.Mode().Perm()); err != nil {
+			return errors.Wrapf(err, "cannot clone '%s' to '%s'", keep, tmp)
+		}
+		// a clone is an independent file, which keeps the metadata of the replaced copy
+		if err := os.Chtimes(tmp, time.Time{}, dupInfo.ModTime()); err != nil {
+			os.Remove(tmp)
+			return errors.Wrapf(err, "cannot set modification time of '%s'", tmp)
+		}
+	default:
+		return errors.Errorf("unknown link mode '%s'", mode)
+	}
+	if err := os.Rename(tmp, dup); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "cannot rename '%s' to '%s'", tmp, dup)
+	}
+	return nil
+}
+
+// LinkJournalEntry documents the replacement of a file by a link
+type LinkJournalEntry struct {
+	Time       int64    `json:"time"`
+	Mode       LinkMode `json:"mode"`
+	KeepSource string   `json:"keepsource"`
+	Keep       string   `json:"keep"`
+	Source     string   `json:"source"`
+	Path       string   `json:"path"`
+	Checksum   string   `json:"checksum"`
+	Size       int64    `json:"size"`
+	Outcome    string   `json:"outcome"`
+	Message    string   `json:"message,omitempty"`
+}
+
+// NewLinkJournal opens a jsonl journal for appending
+func NewLinkJournal(name string) (*LinkJournal, error) {
+	fp, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open journal '%s'", name)
+	}
+	return &LinkJournal{fp: fp, encoder: json.NewEncoder(fp)}, nil
+}
+
+type LinkJournal struct {
+	fp      *os.File
+	encoder *json.Encoder
+}
+
+// Write appends the entry and flushes it to disk
+func (j *LinkJournal) Write(entry *LinkJournalEntry) error {
+	if err := j.encoder.Encode(entry); err != nil {
+		return errors.Wrap(err, "cannot write journal entry")
+	}
+	return errors.Wrap(j.fp.Sync(), "cannot sync journal")
+}
+
+func (j *LinkJournal) Close() error {
+	return errors.WithStack(j.fp.Close())
+}
+
+// SetLink marks the record of a file as linked and stores its new modification time
+func (r *StoreIterator) SetLink(source, path string, link *LinkInfo, lastMod int64) error {
+	if r.readOnly {
+		return errors.New("cannot store link in read only database")
+	}
+	sumLock.Lock()
+	defer sumLock.Unlock()
+	return errors.WithStack(updateWithRetry(r.store, func(txn Txn) error {
+		fData, err := getFileData(txn, source, path)
+		if err != nil {
+			return err
+		}
+		if fData == nil {
+			return errors.Errorf("no record for '%s'", FileKey(source, path))
+		}
+		fData.Link = link
+		fData.LastMod = lastMod
+		return setFileData(txn, fData)
+	}))
+}
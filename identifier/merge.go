@@ -0,0 +1,356 @@
+package identifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/checksum"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"golang.org/x/exp/slices"
+)
+
+// ConflictRule decides, which record is kept, if a merged database contains a different record with the same key
+type ConflictRule string
+
+const (
+	// ConflictNewest keeps the record seen last (file records by lastseen, runs by update, errors by time, sources by creation)
+	ConflictNewest ConflictRule = "newest"
+	// ConflictPrefer keeps the record of the preferred database
+	ConflictPrefer ConflictRule = "prefer"
+	// ConflictReport keeps the existing record and reports the conflict
+	ConflictReport ConflictRule = "report"
+)
+
+var ConflictRules = []ConflictRule{ConflictNewest, ConflictPrefer, ConflictReport}
+
+// ErrSourceLocation is returned by MergeStore, if a source of the merged database has the id of a source with another location
+var ErrSourceLocation = errors.New("same source id with different locations")
+
+// MergeResult counts the records of a merged database
+type MergeResult struct {
+	Records   int64
+	Added     int64
+	Replaced  int64
+	Conflicts int64
+}
+
+// recordTime returns the time used by ConflictNewest. Records without time (i.e. ai results) return 0.
+func recordTime(key, value []byte) int64 {
+	var t struct {
+		LastSeen int64 `json:"lastseen"`
+		Updated  int64 `json:"updated"`
+		Time     int64 `json:"time"`
+		Created  int64 `json:"created"`
+	}
+	if err := json.Unmarshal(value, &t); err != nil {
+		return 0
+	}
+	switch {
+	case bytes.HasPrefix(key, []byte("file:")):
+		return t.LastSeen
+	case bytes.HasPrefix(key, []byte("run:")):
+		return t.Updated
+	case bytes.HasPrefix(key, []byte("error:")), bytes.HasPrefix(key, []byte("fixity:")):
+		return t.Time
+	case bytes.HasPrefix(key, []byte("source:")):
+		return t.Created
+	}
+	return 0
+}
+
+// sameRecord checks, whether two records differ only in the fields, which are maintained by the merge.
+// keep is the record to be stored: the file record with the later lastseen or the source created first.
+func sameRecord(key, existing, value []byte) (same bool, keep []byte) {
+	if bytes.Equal(existing, value) {
+		return true, existing
+	}
+	switch {
+	case bytes.HasPrefix(key, []byte("file:")):
+		return sameFileRecord(existing, value)
+	case bytes.HasPrefix(key, []byte("source:")):
+		return sameSourceRecord(existing, value)
+	}
+	return false, nil
+}
+
+// sameFileRecord compares file records without duplicate flag and lastseen
+func sameFileRecord(existing, value []byte) (same bool, keep []byte) {
+	a, b := &FileData{}, &FileData{}
+	if json.Unmarshal(existing, a) != nil || json.Unmarshal(value, b) != nil {
+		return false, nil
+	}
+	keep = existing
+	if b.LastSeen > a.LastSeen {
+		keep = value
+	}
+	// duplicate flags are recomputed after the merge
+	a.Duplicate, b.Duplicate = false, false
+	a.LastSeen, b.LastSeen = 0, 0
+	aData, errA := json.Marshal(a)
+	bData, errB := json.Marshal(b)
+	if errA != nil || errB != nil || !bytes.Equal(aData, bData) {
+		return false, nil
+	}
+	return true, keep
+}
+
+// sameSourceRecord compares sources by id and location, a source registered in both databases
+// keeps the earlier creation time. A missing location (migrated from older databases) is taken from the other record.
+func sameSourceRecord(existing, value []byte) (same bool, keep []byte) {
+	a, b := &Source{}, &Source{}
+	if json.Unmarshal(existing, a) != nil || json.Unmarshal(value, b) != nil {
+		return false, nil
+	}
+	if a.ID != b.ID || (a.Location != "" && b.Location != "" && a.Location != b.Location) {
+		return false, nil
+	}
+	keep, source, other := existing, a, b
+	if b.Created < a.Created {
+		keep, source, other = value, b, a
+	}
+	if source.Location != "" || other.Location == "" {
+		return true, keep
+	}
+	source.Location = other.Location
+	data, err := json.Marshal(source)
+	if err != nil {
+		return false, nil
+	}
+	return true, data
+}
+
+// checkSourceLocations refuses sources with the same id and different locations, their files would be mixed.
+// Sources without location (migrated from older databases) are not checked.
+func checkSourceLocations(store, from Store) error {
+	sources, err := LoadSources(store)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	fromSources, err := LoadSources(from)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var locations = map[string]string{}
+	for _, source := range sources {
+		locations[source.ID] = source.Location
+	}
+	var conflicts = []string{}
+	for _, source := range fromSources {
+		location := locations[source.ID]
+		if location != "" && source.Location != "" && location != source.Location {
+			conflicts = append(conflicts, fmt.Sprintf("'%s' is '%s' in the database and '%s' in the merged database", source.ID, location, source.Location))
+		}
+	}
+	if len(conflicts) > 0 {
+		return errors.Wrapf(ErrSourceLocation, "source %s - index one of them with another source id", strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// MergeStore copies the records of from into store. Conflicting records are resolved by rule.
+// With ConflictPrefer the records of from win, if preferred is set, otherwise the existing records are kept.
+// conflict is called for every conflicting record with the decision.
+// Sources with the same id and different locations are refused with ErrSourceLocation before any record is copied.
+// Secondary indexes and duplicate flags must be rebuilt afterwards (see RebuildSecondary and UpdateDuplicates).
+func MergeStore(store, from Store, rule ConflictRule, preferred bool, logger zLogger.ZLogger, conflict func(key string, replaced bool)) (*MergeResult, error) {
+	if !slices.Contains(ConflictRules, rule) {
+		return nil, errors.Errorf("unknown conflict rule '%s'", rule)
+	}
+	if err := checkSourceLocations(store, from); err != nil {
+		return nil, err
+	}
+	result := &MergeResult{}
+	type record struct {
+		key   []byte
+		value []byte
+	}
+	var batch = []record{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := store.Update(func(txn Txn) error {
+			for _, r := range batch {
+				if string(r.key) == digestsKey {
+					if err := mergeDigests(txn, r.value); err != nil {
+						return err
+					}
+					continue
+				}
+				existing, err := getValue(txn, r.key)
+				if err != nil {
+					return err
+				}
+				value := r.value
+				if existing == nil {
+					result.Added++
+				} else {
+					same, keep := sameRecord(r.key, existing, r.value)
+					if same {
+						if bytes.Equal(keep, existing) {
+							continue
+						}
+						value = keep
+					} else {
+						var replace bool
+						switch rule {
+						case ConflictNewest:
+							replace = recordTime(r.key, r.value) > recordTime(r.key, existing)
+						case ConflictPrefer:
+							replace = preferred
+						}
+						result.Conflicts++
+						if conflict != nil {
+							conflict(string(r.key), replace)
+						}
+						if !replace {
+							continue
+						}
+					}
+					result.Replaced++
+				}
+				if err := txn.Set(r.key, value); err != nil {
+					return errors.Wrapf(err, "cannot write '%s'", r.key)
+				}
+			}
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "cannot write merged records")
+		}
+		result.Records += int64(len(batch))
+		logger.Info().Msgf("%d records merged", result.Records)
+		batch = []record{}
+		return nil
+	}
+	if err := from.View(func(txn Txn) error {
+		return txn.Iterate([]byte{}, func(key, value []byte) error {
+			if dumpSkipped(key) {
+				return nil
+			}
+			// key and value are only valid within the iteration
+			batch = append(batch, record{key: bytes.Clone(key), value: bytes.Clone(value)})
+			if len(batch) < migrationBatch {
+				return nil
+			}
+			return flush()
+		})
+	}); err != nil {
+		return result, errors.Wrap(err, "cannot read records")
+	}
+	return result, errors.WithStack(flush())
+}
+
+// mergeDigests adds the digest algorithms of a merged database
+func mergeDigests(txn Txn, value []byte) error {
+	var digests = []checksum.DigestAlgorithm{}
+	if err := json.Unmarshal(value, &digests); err != nil {
+		return errors.Wrapf(err, "cannot unmarshal '%s'", digestsKey)
+	}
+	stored, err := loadDigests(txn)
+	if err != nil {
+		return err
+	}
+	for _, digest := range digests {
+		if !slices.Contains(stored, digest) {
+			stored = append(stored, digest)
+		}
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal '%s'", digestsKey)
+	}
+	return errors.Wrapf(txn.Set([]byte(digestsKey), data), "cannot write '%s'", digestsKey)
+}
+
+// UpdateDuplicates sets the duplicate flags of all file records from the checksum index and returns the number of changed records.
+// All files of a group with more than one member are marked as duplicate.
+func UpdateDuplicates(store Store, digest checksum.DigestAlgorithm, logger zLogger.ZLogger) (int64, error) {
+	var duplicates = map[fileRef]bool{}
+	prefix := []byte(fmt.Sprintf("%s%s:%s:", secondaryPrefix, IndexSum, digest))
+	if err := store.View(func(txn Txn) error {
+		var group = []fileRef{}
+		var groupSum string
+		flush := func() {
+			if len(group) > 1 {
+				for _, ref := range group {
+					duplicates[ref] = true
+				}
+			}
+			group = []fileRef{}
+		}
+		if err := txn.Iterate(prefix, func(key, value []byte) error {
+			parts := strings.SplitN(string(bytes.TrimPrefix(key, prefix)), ":", 3)
+			if len(parts) != 3 {
+				return nil
+			}
+			entry := &IndexEntry{}
+			if err := json.Unmarshal(value, entry); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal '%s'", key)
+			}
+			if entry.Size == 0 {
+				return nil
+			}
+			if parts[0] != groupSum {
+				flush()
+				groupSum = parts[0]
+			}
+			group = append(group, fileRef{source: parts[1], path: parts[2]})
+			return nil
+		}); err != nil {
+			return err
+		}
+		flush()
+		return nil
+	}); err != nil {
+		return 0, errors.Wrapf(err, "cannot read duplicates of '%s'", digest)
+	}
+
+	var count int64
+	var batch = []*FileData{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := store.Update(func(txn Txn) error {
+			for _, fData := range batch {
+				if err := setFileData(txn, fData); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "cannot write duplicate flags")
+		}
+		count += int64(len(batch))
+		batch = []*FileData{}
+		return nil
+	}
+	if err := store.View(func(txn Txn) error {
+		return txn.Iterate([]byte("file:"), func(key, value []byte) error {
+			fData := &FileData{}
+			if err := json.Unmarshal(value, fData); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal '%s'", key)
+			}
+			duplicate := duplicates[fileRef{source: fData.Source, path: fData.Path}]
+			if fData.Duplicate == duplicate {
+				return nil
+			}
+			fData.Duplicate = duplicate
+			batch = append(batch, fData)
+			if len(batch) < rebuildBatch {
+				return nil
+			}
+			return flush()
+		})
+	}); err != nil {
+		return count, errors.Wrap(err, "cannot read file records")
+	}
+	if err := flush(); err != nil {
+		return count, err
+	}
+	logger.Info().Msgf("duplicate flags of %d file records updated", count)
+	return count, nil
+}
@@ -0,0 +1,45 @@
+package identifier
+
+import (
+	"testing"
+)
+
+func TestMergeSourceCreated(t *testing.T) {
+	store, from := testStore(t), testStore(t)
+	for _, s := range []struct {
+		store  Store
+		source *Source
+	}{
+		{store, &Source{ID: "a", Location: "/data/a", Created: 2000}},
+		{from, &Source{ID: "a", Location: "/data/a", Created: 1000}},
+		{store, &Source{ID: "b", Created: 1000}},
+		{from, &Source{ID: "b", Location: "/data/b", Created: 2000}},
+	} {
+		if err := StoreSource(s.store, s.source); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err := MergeStore(store, from, ConflictReport, false, testLogger(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Conflicts != 0 {
+		t.Errorf("conflicts: got %d, want 0", result.Conflicts)
+	}
+	sources, err := LoadSources(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want = map[string]Source{
+		"a": {ID: "a", Location: "/data/a", Created: 1000},
+		"b": {ID: "b", Location: "/data/b", Created: 1000},
+	}
+	if len(sources) != len(want) {
+		t.Fatalf("sources: got %d, want %d", len(sources), len(want))
+	}
+	for _, source := range sources {
+		if *source != want[source.ID] {
+			t.Errorf("source '%s': got %+v, want %+v", source.ID, *source, want[source.ID])
+		}
+	}
+}
@@ -0,0 +1,37 @@
+//go:build linux
+
+package identifier
+
+import (
+	"io/fs"
+	"os"
+
+	"emperror.dev/errors"
+	"golang.org/x/sys/unix"
+)
+
+// reflink creates dst as copy-on-write clone of src (btrfs, xfs, ...)
+func reflink(src, dst string, perm fs.FileMode) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return errors.Wrapf(err, "cannot open '%s'", src)
+	}
+	defer srcFile.Close()
+	dstFile, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return errors.Wrapf(err, "cannot create '%s'", dst)
+	}
+	if err := unix.IoctlFileClone(int(dstFile.Fd()), int(srcFile.Fd())); err != nil {
+		dstFile.Close()
+		os.Remove(dst)
+		if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EXDEV) || errors.Is(err, unix.EINVAL) {
+			return errors.Wrapf(ErrReflinkNotSupported, "file system of '%s': %v", dst, err)
+		}
+		return errors.Wrapf(err, "cannot clone '%s'", src)
+	}
+	if err := dstFile.Close(); err != nil {
+		os.Remove(dst)
+		return errors.Wrapf(err, "cannot close '%s'", dst)
+	}
+	return nil
+}
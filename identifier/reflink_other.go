@@ -0,0 +1,13 @@
+//go:build !linux
+
+package identifier
+
+import (
+	"io/fs"
+
+	"emperror.dev/errors"
+)
+
+func reflink(src, dst string, perm fs.FileMode) error {
+	return errors.Wrapf(ErrReflinkNotSupported, "cannot clone '%s' on this platform", src)
+}
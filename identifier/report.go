@@ -0,0 +1,280 @@
+package identifier
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/checksum"
+)
+
+// ReportStat counts the files and bytes of a format
+type ReportStat struct {
+	Name  string `json:"name"`
+	Files int64  `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+// ReportFolder is a folder with the numbers of its subtree
+type ReportFolder struct {
+	// Path is the path of the folder without leading slash, the root folder is ""
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	Depth   int    `json:"depth"`
+	Files   int64  `json:"files"`
+	Folders int64  `json:"folders"`
+	Size    int64  `json:"size"`
+	// Subs are the subfolders ordered by name
+	Subs []*ReportFolder `json:"subs,omitempty"`
+}
+
+// Report contains the statistics of the files of a database for the collection reports.
+// The file lists are read from the database while the report is written.
+type Report struct {
+	Created  time.Time
+	Database string
+	Sources  []*Source
+	// Source is the selected source, empty for all sources
+	Source    string
+	Prefix    string
+	Where     *Where
+	Digests   []checksum.DigestAlgorithm
+	DupDigest checksum.DigestAlgorithm
+
+	Files           int64
+	Size            int64
+	EmptyFiles      int64
+	Unidentified    int64
+	DuplicateGroups int64
+	DuplicateFiles  int64
+	Wasted          int64
+	AIDescriptions  int64
+	Pronom          []*ReportStat
+	Mime            []*ReportStat
+
+	iterator *StoreIterator
+	folders  *pathElement
+}
+
+// NewReport reads the statistics of the files of source (all sources if empty) with the path prefix, which match the filter expression
+func NewReport(iterator *StoreIterator, database string, source string, prefix string, where *Where, dupDigest checksum.DigestAlgorithm) (*Report, error) {
+	r := &Report{
+		Created:   time.Now(),
+		Database:  database,
+		Source:    source,
+		Prefix:    prefix,
+		Where:     where,
+		DupDigest: dupDigest,
+		iterator:  iterator,
+		folders:   NewPathElement("", true, 0, nil),
+	}
+	var err error
+	if r.Sources, err = iterator.Sources(); err != nil {
+		return nil, errors.Wrap(err, "cannot load sources")
+	}
+	if r.Digests, err = iterator.Digests(); err != nil {
+		return nil, errors.Wrap(err, "cannot load digests")
+	}
+
+	var pronom = map[string]*ReportStat{}
+	var mime = map[string]*ReportStat{}
+	addStat := func(stats map[string]*ReportStat, name string, size int64) {
+		stat, ok := stats[name]
+		if !ok {
+			stat = &ReportStat{Name: name}
+			stats[name] = stat
+		}
+		stat.Files++
+		stat.Size += size
+	}
+	if err := r.IterateFiles(func(fData *FileData) error {
+		r.Files++
+		r.Size += fData.Size
+		if fData.Size == 0 {
+			r.EmptyFiles++
+		} else if Unidentified(fData) {
+			r.Unidentified++
+		}
+		addStat(pronom, fData.Indexer.Pronom, fData.Size)
+		addStat(mime, fData.Indexer.Mimetype, fData.Size)
+		parts := r.pathParts(fData.Source, fData.Path)
+		curr := r.folders
+		for i, part := range parts {
+			if i == len(parts)-1 {
+				curr = curr.AddSub(part, false, fData.Size)
+			} else {
+				curr = curr.AddSub(part, true, 0)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	r.Pronom, r.Mime = sortStats(pronom), sortStats(mime)
+
+	if err := r.IterateDuplicates(func(group *DuplicateGroup) error {
+		r.DuplicateGroups++
+		r.DuplicateFiles += int64(len(group.Files))
+		r.Wasted += group.Wasted()
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := r.IterateAI(func(source, model string, ai *AIResultStruct) error {
+		r.AIDescriptions++
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// sortStats returns the statistics with the most files first
+func sortStats(stats map[string]*ReportStat) []*ReportStat {
+	var result = []*ReportStat{}
+	for _, stat := range stats {
+		result = append(result, stat)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Files != result[j].Files {
+			return result[i].Files > result[j].Files
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Unidentified checks, whether the format of a file is unknown
+func Unidentified(fData *FileData) bool {
+	return fData.Indexer == nil || fData.Indexer.Pronom == "" || strings.EqualFold(fData.Indexer.Pronom, "UNKNOWN")
+}
+
+// pathParts returns the path elements of a file in the folder tree.
+// With several sources and none selected, every source is a top level folder.
+func (r *Report) pathParts(source, filePath string) []string {
+	pathStr := path.Clean(filepath.ToSlash(filePath))
+	if r.Source == "" && len(r.Sources) > 1 {
+		pathStr = path.Join(source, pathStr)
+	}
+	var parts = []string{}
+	for _, part := range strings.Split(pathStr, "/") {
+		if part != "." && part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// FileFolders returns the paths of all folders containing the file, starting with the root folder ""
+func (r *Report) FileFolders(fData *FileData) []string {
+	parts := r.pathParts(fData.Source, fData.Path)
+	var folders = []string{""}
+	for i := 1; i < len(parts); i++ {
+		folders = append(folders, strings.Join(parts[:i], "/"))
+	}
+	return folders
+}
+
+// FolderTree returns the root folder with the numbers of all files
+func (r *Report) FolderTree() *ReportFolder {
+	var build func(elem *pathElement, folderPath string, depth int) *ReportFolder
+	build = func(elem *pathElement, folderPath string, depth int) *ReportFolder {
+		size, files, folders := elem.SubFolderHierarchyAggregation()
+		folder := &ReportFolder{
+			Path:    folderPath,
+			Name:    elem.Name(),
+			Depth:   depth,
+			Files:   files,
+			Folders: folders,
+			Size:    size,
+			Subs:    []*ReportFolder{},
+		}
+		for _, sub := range elem.subs {
+			if sub.IsDir() {
+				folder.Subs = append(folder.Subs, build(sub, strings.TrimPrefix(folderPath+"/"+sub.Name(), "/"), depth+1))
+			}
+		}
+		sort.Slice(folder.Subs, func(i, j int) bool { return folder.Subs[i].Name < folder.Subs[j].Name })
+		return folder
+	}
+	return build(r.folders, "", 0)
+}
+
+// FolderPath returns the path of a folder of a source in the folder tree
+func (r *Report) FolderPath(source, folder string) string {
+	return strings.Join(r.pathParts(source, folder), "/")
+}
+
+// Folders returns all folders in tree order, every folder is followed by its subfolders
+func (r *Report) Folders() []*ReportFolder {
+	var folders = []*ReportFolder{}
+	var walk func(folder *ReportFolder)
+	walk = func(folder *ReportFolder) {
+		folders = append(folders, folder)
+		for _, sub := range folder.Subs {
+			walk(sub)
+		}
+	}
+	walk(r.FolderTree())
+	return folders
+}
+
+// IterateFiles calls do for all files of the report in the order of the database
+func (r *Report) IterateFiles(do func(fData *FileData) error) error {
+	if err := r.iterator.IterateFiles(r.Source, r.Prefix, func(fData *FileData) (remove bool, err error) {
+		if fData.Basename == "" || fData.Indexer == nil || !r.Where.Match(fData) {
+			return false, nil
+		}
+		return false, do(fData)
+	}); err != nil {
+		return errors.Wrap(err, "cannot iterate files")
+	}
+	return nil
+}
+
+// IterateDuplicates calls do for all groups with at least two files of the report
+func (r *Report) IterateDuplicates(do func(group *DuplicateGroup) error) error {
+	return errors.WithStack(r.iterator.IterateDuplicates(r.DupDigest, r.Source, func(group *DuplicateGroup) error {
+		var files = []*DuplicateFile{}
+		for _, file := range group.Files {
+			if !strings.HasPrefix(file.Path, r.Prefix) {
+				continue
+			}
+			if !r.Where.Empty() {
+				fData, err := LoadFileData(r.iterator.Store(), file.Source, file.Path)
+				if err != nil {
+					return errors.Wrapf(err, "cannot load record of '%s'", file.Path)
+				}
+				if fData == nil || !r.Where.Match(fData) {
+					continue
+				}
+			}
+			files = append(files, file)
+		}
+		if len(files) < 2 {
+			return nil
+		}
+		group.Files = files
+		group.Sort(KeepShortest, "")
+		return do(group)
+	}))
+}
+
+// IterateAI calls do for all ai descriptions of folders of the report
+func (r *Report) IterateAI(do func(source, model string, ai *AIResultStruct) error) error {
+	prefix := "ai:"
+	if r.Source != "" {
+		prefix += r.Source + ":"
+	}
+	return errors.WithStack(r.iterator.IterateAI(prefix, func(key string, ai *AIResultStruct) (remove bool, err error) {
+		// ai:<source>:<model>:<folder>
+		parts := strings.SplitN(strings.TrimPrefix(key, "ai:"), ":", 3)
+		if len(parts) != 3 || !strings.HasPrefix(filepath.ToSlash(ai.Folder), r.Prefix) {
+			return false, nil
+		}
+		return false, do(parts[0], parts[1], ai)
+	}))
+}
@@ -0,0 +1,176 @@
+package identifier
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+//go:embed reportHTML.gohtml
+var reportHTMLTemplate string
+
+// reportHTMLChartBars is the number of bars in the charts, the remaining formats are combined as "other"
+const reportHTMLChartBars = 15
+
+var reportHTMLTmpl = template.Must(template.New("report").Funcs(template.FuncMap{
+	"humanSize": humanSize,
+	"percent": func(value float64) string {
+		return fmt.Sprintf("%.1f", value)
+	},
+	"datetime": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05")
+	},
+	"unix": func(t int64) string {
+		return time.Unix(t, 0).Format("2006-01-02 15:04:05")
+	},
+	"join": strings.Join,
+}).Parse(reportHTMLTemplate))
+
+type reportHTMLBar struct {
+	Name         string
+	Files        int64
+	Size         int64
+	FilesPercent float64
+	SizePercent  float64
+	Hue          int
+}
+
+type reportHTMLAI struct {
+	Source  string
+	Model   string
+	Folder  string
+	Persons []string
+	*AIResultStruct
+}
+
+type reportHTMLFolder struct {
+	*ReportFolder
+	SizePercent float64
+	AI          []*reportHTMLAI
+	Subs        []*reportHTMLFolder
+}
+
+type reportHTML struct {
+	*Report
+	SourceList       string
+	Folders          int
+	Limit            int
+	PronomChart      []*reportHTMLBar
+	MimeChart        []*reportHTMLBar
+	Tree             *reportHTMLFolder
+	AI               []*reportHTMLAI
+	Duplicates       []*DuplicateGroup
+	DuplicatesMore   int64
+	Unidentified     []*FileData
+	UnidentifiedMore int64
+}
+
+// reportHTMLChart returns the bars of the largest formats of the statistics
+func reportHTMLChart(stats []*ReportStat, files, size int64) []*reportHTMLBar {
+	var bars = []*reportHTMLBar{}
+	for i, stat := range stats {
+		if i == reportHTMLChartBars {
+			other := &reportHTMLBar{Name: fmt.Sprintf("other (%d)", len(stats)-i)}
+			for _, s := range stats[i:] {
+				other.Files += s.Files
+				other.Size += s.Size
+			}
+			bars = append(bars, other)
+			break
+		}
+		name := stat.Name
+		if name == "" {
+			name = "(none)"
+		}
+		bars = append(bars, &reportHTMLBar{Name: name, Files: stat.Files, Size: stat.Size})
+	}
+	for i, bar := range bars {
+		if files > 0 {
+			bar.FilesPercent = float64(bar.Files) * 100 / float64(files)
+		}
+		if size > 0 {
+			bar.SizePercent = float64(bar.Size) * 100 / float64(size)
+		}
+		bar.Hue = (i * 137) % 360
+	}
+	return bars
+}
+
+// WriteHTML writes the report as a single html file without external resources.
+// It contains charts of the pronom and mime formats, the folder tree with the ai descriptions and
+// the tables of the duplicates and unidentified files, which are cut after limit rows (0 for no limit).
+func (r *Report) WriteHTML(w io.Writer, limit int) error {
+	data := &reportHTML{
+		Report:      r,
+		Limit:       limit,
+		PronomChart: reportHTMLChart(r.Pronom, r.Files, r.Size),
+		MimeChart:   reportHTMLChart(r.Mime, r.Files, r.Size),
+		AI:          []*reportHTMLAI{},
+	}
+	var sources = []string{}
+	for _, source := range r.Sources {
+		if r.Source == "" || r.Source == source.ID {
+			sources = append(sources, source.ID)
+		}
+	}
+	data.SourceList = strings.Join(sources, ", ")
+
+	var folderAI = map[string][]*reportHTMLAI{}
+	if err := r.IterateAI(func(source, model string, ai *AIResultStruct) error {
+		entry := &reportHTMLAI{Source: source, Model: model, Folder: r.FolderPath(source, ai.Folder), AIResultStruct: ai}
+		for _, person := range ai.Persons {
+			entry.Persons = append(entry.Persons, person.String())
+		}
+		data.AI = append(data.AI, entry)
+		folderAI[entry.Folder] = append(folderAI[entry.Folder], entry)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var build func(folder *ReportFolder) *reportHTMLFolder
+	build = func(folder *ReportFolder) *reportHTMLFolder {
+		data.Folders++
+		f := &reportHTMLFolder{ReportFolder: folder, AI: folderAI[folder.Path], Subs: []*reportHTMLFolder{}}
+		if r.Size > 0 {
+			f.SizePercent = float64(folder.Size) * 100 / float64(r.Size)
+		}
+		for _, sub := range folder.Subs {
+			f.Subs = append(f.Subs, build(sub))
+		}
+		return f
+	}
+	data.Tree = build(r.FolderTree())
+	data.Folders--
+
+	if err := r.IterateDuplicates(func(group *DuplicateGroup) error {
+		if limit > 0 && len(data.Duplicates) >= limit {
+			data.DuplicatesMore++
+			return nil
+		}
+		data.Duplicates = append(data.Duplicates, group)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := r.IterateFiles(func(fData *FileData) error {
+		if fData.Size == 0 || !Unidentified(fData) {
+			return nil
+		}
+		if limit > 0 && len(data.Unidentified) >= limit {
+			data.UnidentifiedMore++
+			return nil
+		}
+		data.Unidentified = append(data.Unidentified, fData)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return errors.Wrap(reportHTMLTmpl.Execute(w, data), "cannot render html report")
+}
@@ -0,0 +1,173 @@
+package identifier
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	human "github.com/dustin/go-humanize"
+)
+
+// humanSize returns the size as readable text (i.e. "15 MB")
+func humanSize(size int64) string {
+	return human.Bytes(uint64(size))
+}
+
+// WriteXLSX writes the report as workbook with the sheets summary, files, folders, pronom, mime, duplicates, empty files and ai.
+// The folders are linked to their first file in the files sheet.
+func (r *Report) WriteXLSX(w io.Writer) error {
+	x := NewXLSXStream(w)
+	x.FreezeHeader = true
+	x.AutoFilter = true
+
+	if err := r.writeXLSXSummary(x); err != nil {
+		return err
+	}
+
+	// location of the first file of every folder in the files sheet
+	var folderLocation = map[string]string{}
+	var fields = []string{"source", "path", "folder", "basename", "size (bytes)", "size", "lastmod", "duplicate", "mimetype", "pronom", "type", "subtype"}
+	for _, digest := range r.Digests {
+		fields = append(fields, string(digest))
+	}
+	fields = append(fields, "width", "height", "duration")
+	if err := x.AddSheet("files", fields); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := r.IterateFiles(func(fData *FileData) error {
+		record := []any{fData.Source, fData.Path, fData.Folder, fData.Basename, fData.Size, humanSize(fData.Size), time.Unix(fData.LastMod, 0), fData.Duplicate,
+			fData.Indexer.Mimetype, fData.Indexer.Pronom, fData.Indexer.Type, fData.Indexer.Subtype}
+		for _, digest := range r.Digests {
+			record = append(record, fData.Indexer.Checksum[string(digest)])
+		}
+		record = append(record, fData.Indexer.Width, fData.Indexer.Height, fData.Indexer.Duration)
+		if err := x.WriteRow(record); err != nil {
+			return errors.WithStack(err)
+		}
+		for _, folder := range r.FileFolders(fData) {
+			if _, ok := folderLocation[folder]; !ok {
+				folderLocation[folder] = x.Location()
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := x.AddSheet("folders", []string{"folder", "files", "folders", "size (bytes)", "size"}); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, folder := range r.Folders() {
+		if err := x.WriteRow([]any{
+			XLSXLink{Text: "/" + folder.Path, Location: folderLocation[folder.Path]},
+			folder.Files,
+			folder.Folders,
+			folder.Size,
+			humanSize(folder.Size),
+		}); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, stats := range []struct {
+		name  string
+		stats []*ReportStat
+	}{{"pronom", r.Pronom}, {"mime", r.Mime}} {
+		if err := x.AddSheet(stats.name, []string{stats.name, "files", "size (bytes)", "size"}); err != nil {
+			return errors.WithStack(err)
+		}
+		for _, stat := range stats.stats {
+			if err := x.WriteRow([]any{stat.Name, stat.Files, stat.Size, humanSize(stat.Size)}); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	if err := x.AddSheet("duplicates", []string{"checksum", "size (bytes)", "size", "copies", "wasted (bytes)", "wasted", "source", "path", "keep"}); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := r.IterateDuplicates(func(group *DuplicateGroup) error {
+		for i, file := range group.Files {
+			if err := x.WriteRow([]any{
+				string(group.Digest) + ":" + group.Checksum,
+				group.Size,
+				humanSize(group.Size),
+				len(group.Files),
+				group.Wasted(),
+				humanSize(group.Wasted()),
+				file.Source,
+				file.Path,
+				i == 0,
+			}); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := x.AddSheet("empty files", []string{"source", "path", "lastmod"}); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := r.IterateFiles(func(fData *FileData) error {
+		if fData.Size != 0 {
+			return nil
+		}
+		return errors.WithStack(x.WriteRow([]any{fData.Source, fData.Path, time.Unix(fData.LastMod, 0)}))
+	}); err != nil {
+		return err
+	}
+
+	if err := x.AddSheet("ai", []string{"source", "model", "folder", "title", "description", "place", "date", "tags", "persons", "institutions"}); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := r.IterateAI(func(source, model string, ai *AIResultStruct) error {
+		var persons []string
+		for _, person := range ai.Persons {
+			persons = append(persons, person.String())
+		}
+		return errors.WithStack(x.WriteRow([]any{source, model, ai.Folder, ai.Title, ai.Description, ai.Place, ai.Date, ai.Tags, persons, ai.Institutions}))
+	}); err != nil {
+		return err
+	}
+
+	return errors.Wrap(x.Close(), "cannot write workbook")
+}
+
+func (r *Report) writeXLSXSummary(x *XLSXStream) error {
+	if err := x.AddSheet("summary", []string{"property", "value", "size"}); err != nil {
+		return errors.WithStack(err)
+	}
+	var sources = []string{}
+	for _, source := range r.Sources {
+		if r.Source == "" || r.Source == source.ID {
+			sources = append(sources, source.ID)
+		}
+	}
+	var rows = [][]any{
+		{"created", r.Created, nil},
+		{"database", r.Database, nil},
+		{"sources", strings.Join(sources, ", "), nil},
+		{"prefix", r.Prefix, nil},
+		{"filter", r.Where.String(), nil},
+		{"files", r.Files, nil},
+		{"size (bytes)", r.Size, humanSize(r.Size)},
+		{"folders", int64(len(r.Folders()) - 1), nil},
+		{"pronom formats", len(r.Pronom), nil},
+		{"mime types", len(r.Mime), nil},
+		{"unidentified files", r.Unidentified, nil},
+		{"empty files", r.EmptyFiles, nil},
+		{"duplicate groups (" + string(r.DupDigest) + ")", r.DuplicateGroups, nil},
+		{"duplicate files", r.DuplicateFiles, nil},
+		{"wasted (bytes)", r.Wasted, humanSize(r.Wasted)},
+		{"ai descriptions", r.AIDescriptions, nil},
+	}
+	for _, row := range rows {
+		if err := x.WriteRow(row); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
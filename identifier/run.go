@@ -0,0 +1,89 @@
+package identifier
+
+import (
+	"encoding/json"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+// Run is the checkpoint of the last index run of a source, stored as "run:<source>"
+type Run struct {
+	Source      string `json:"source"`
+	Started     int64  `json:"started"`
+	Updated     int64  `json:"updated"`
+	Files       int64  `json:"files"`
+	Interrupted bool   `json:"interrupted"`
+	Finished    bool   `json:"finished"`
+}
+
+func runKey(source string) []byte {
+	return []byte("run:" + source)
+}
+
+// LoadRun returns the checkpoint of the last index run of source or nil, if there is none
+func LoadRun(store Store, source string) (*Run, error) {
+	var run *Run
+	if err := store.View(func(txn Txn) error {
+		value, err := getValue(txn, runKey(source))
+		if err != nil || value == nil {
+			return err
+		}
+		run = &Run{}
+		return errors.Wrapf(json.Unmarshal(value, run), "cannot unmarshal '%s'", runKey(source))
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return run, nil
+}
+
+// StoreRun persists the checkpoint of an index run
+func StoreRun(store Store, run *Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal '%s'", runKey(run.Source))
+	}
+	return errors.WithStack(updateWithRetry(store, func(txn Txn) error {
+		return errors.Wrapf(txn.Set(runKey(run.Source), data), "cannot write '%s'", runKey(run.Source))
+	}))
+}
+
+// ErrRunUnfinished is returned by PruneTime, if the last index run of a source has not been finished
+var ErrRunUnfinished = errors.New("last index run is unfinished")
+
+// PruneTime returns the start time of the last index run of source, records not seen since are stale.
+// It returns 0, if there is no index run. Records of an unfinished run are incomplete, so it returns ErrRunUnfinished.
+// The newest lastseen of the records is no substitute, files of a retry are stamped with the time of the retry.
+func PruneTime(store Store, source string) (int64, error) {
+	run, err := LoadRun(store, source)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if run == nil {
+		return 0, nil
+	}
+	if !run.Finished {
+		return 0, errors.Wrapf(ErrRunUnfinished, "source '%s' (started %s) - use 'index --resume' to finish it", source, time.Unix(run.Started, 0).Format(time.RFC3339))
+	}
+	return run.Started, nil
+}
+
+// CompletedPaths returns the paths and sizes of the files of source, which have been indexed by the run started at started
+func CompletedPaths(store Store, source string, started int64) (map[string]int64, error) {
+	var paths = map[string]int64{}
+	if err := store.View(func(txn Txn) error {
+		return txn.Iterate(FileKey(source, ""), func(key, value []byte) error {
+			fData := &FileData{}
+			if err := json.Unmarshal(value, fData); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal '%s'", key)
+			}
+			if fData.LastSeen >= started {
+				paths[fData.Path] = fData.Size
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate database")
+	}
+	return paths, nil
+}
@@ -0,0 +1,71 @@
+package identifier
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/je4/utils/v2/pkg/checksum"
+	"github.com/ocfl-archive/indexer/v3/pkg/indexer"
+)
+
+func testStore(t *testing.T) Store {
+	t.Helper()
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "index.db"), false, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestPruneTimeAfterRetry(t *testing.T) {
+	store := testStore(t)
+
+	const started, retried = 1000, 2000
+	if err := StoreRun(store, &Run{Source: "src", Started: started, Updated: started + 10, Files: 3, Finished: true}); err != nil {
+		t.Fatal(err)
+	}
+	for path, lastSeen := range map[string]int64{
+		"a.txt":       started,
+		"retried.txt": retried, // stamped by 'index retry' after the run
+		"c.txt":       started,
+		"deleted.txt": started - 500,
+	} {
+		if err := StoreFileData(store, &FileData{Source: "src", Path: path, Basename: path, LastSeen: lastSeen, Indexer: &indexer.ResultV2{Checksum: map[string]string{"sha512": path}}}, checksum.DigestSHA512); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before, err := PruneTime(store, "src")
+	if err != nil {
+		t.Fatalf("prune time: %v", err)
+	}
+	if before != started {
+		t.Fatalf("prune time: got %d, want start of the run %d", before, started)
+	}
+	var stale = []string{}
+	if err := IterateStale(store, "src", before, func(key string, fData *FileData) error {
+		stale = append(stale, fData.Path)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0] != "deleted.txt" {
+		t.Errorf("stale records: got %v, want [deleted.txt]", stale)
+	}
+}
+
+func TestPruneTimeUnfinished(t *testing.T) {
+	store := testStore(t)
+
+	if before, err := PruneTime(store, "src"); err != nil || before != 0 {
+		t.Errorf("no run: got %d, %v, want 0", before, err)
+	}
+	if err := StoreRun(store, &Run{Source: "src", Started: 1000, Updated: 1010, Interrupted: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PruneTime(store, "src"); !errors.Is(err, ErrRunUnfinished) {
+		t.Errorf("interrupted run: got %v, want ErrRunUnfinished", err)
+	}
+}
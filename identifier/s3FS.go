@@ -0,0 +1,406 @@
+package identifier
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config contains the endpoint and credentials for s3 data roots.
+// Without access key the credentials are taken from the environment (AWS_ACCESS_KEY_ID, MINIO_ROOT_USER, ...)
+// or from ~/.aws/credentials.
+type S3Config struct {
+	Endpoint  string `toml:"endpoint"`
+	AccessKey string `toml:"accesskey"`
+	SecretKey string `toml:"secretkey"`
+	Region    string `toml:"region"`
+	Insecure  bool   `toml:"insecure"`
+}
+
+// ETagInfo is implemented by the file infos of object stores
+type ETagInfo interface {
+	ETag() string
+}
+
+// ETagOf returns the etag of an object or an empty string for files without etag
+func ETagOf(finfo fs.FileInfo) string {
+	if info, ok := finfo.(ETagInfo); ok {
+		return info.ETag()
+	}
+	return ""
+}
+
+// parseS3URL parses an s3://bucket/prefix url
+func parseS3URL(location string) (bucket string, prefix string, err error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "cannot parse '%s'", location)
+	}
+	if u.User != nil {
+		return "", "", errors.Errorf("credentials in '%s' not allowed - use config file or environment", u.Redacted())
+	}
+	if u.Host == "" {
+		return "", "", errors.Errorf("no bucket in '%s'", location)
+	}
+	prefix = strings.Trim(path.Clean("/"+u.Path), "/")
+	return u.Host, prefix, nil
+}
+
+// s3Location returns the normalized s3://bucket/prefix url
+func s3Location(bucket, prefix string) string {
+	if prefix == "" {
+		return "s3://" + bucket
+	}
+	return "s3://" + bucket + "/" + prefix
+}
+
+// s3Credentials returns the static credentials of the config or the credentials of the environment
+func s3Credentials(conf *S3Config) *credentials.Credentials {
+	if conf.AccessKey != "" {
+		return credentials.NewStaticV4(conf.AccessKey, conf.SecretKey, "")
+	}
+	return credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{},
+	})
+}
+
+// NewS3FS connects to the bucket of an s3://bucket/prefix url
+func NewS3FS(location string, conf *S3Config, logger zLogger.ZLogger) (*S3FS, error) {
+	if conf == nil {
+		conf = &S3Config{}
+	}
+	bucket, prefix, err := parseS3URL(location)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	endpoint := conf.Endpoint
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  s3Credentials(conf),
+		Secure: !conf.Insecure,
+		Region: conf.Region,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create s3 client for '%s'", endpoint)
+	}
+	logger.Info().Msgf("connecting to bucket '%s' on '%s'", bucket, endpoint)
+	exists, err := client.BucketExists(context.Background(), bucket)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot check bucket '%s' on '%s'", bucket, endpoint)
+	}
+	if !exists {
+		return nil, errors.Errorf("bucket '%s' does not exist on '%s'", bucket, endpoint)
+	}
+	return NewS3FSFromClient(client, bucket, prefix), nil
+}
+
+// NewS3FSFromClient creates the file system for prefix in bucket on an existing client (i.e. of an in-memory server)
+func NewS3FSFromClient(client *minio.Client, bucket, prefix string) *S3FS {
+	return &S3FS{client: client, bucket: bucket, prefix: strings.Trim(prefix, "/")}
+}
+
+// S3FS exposes the objects below a prefix as file system. Folders are derived from the "/" in the object keys.
+type S3FS struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func (s *S3FS) String() string {
+	return s3Location(s.bucket, s.prefix)
+}
+
+// key returns the object key of name
+func (s *S3FS) key(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return s.prefix, nil
+	}
+	if s.prefix == "" {
+		return name, nil
+	}
+	return s.prefix + "/" + name, nil
+}
+
+// dirPrefix returns the prefix of the objects within the folder key
+func dirPrefix(key string) string {
+	if key == "" {
+		return ""
+	}
+	return key + "/"
+}
+
+// pathError converts the errors of the s3 client to errors of io/fs
+func (s *S3FS) pathError(op, name string, err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case minio.NoSuchKey, minio.NoSuchBucket:
+		err = fs.ErrNotExist
+	case "AccessDenied":
+		err = fs.ErrPermission
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// isDir checks, whether there are objects below key
+func (s *S3FS) isDir(key string) (bool, error) {
+	for object := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{Prefix: dirPrefix(key), MaxKeys: 1}) {
+		if object.Err != nil {
+			return false, object.Err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (s *S3FS) stat(op, name string) (*s3FileInfo, error) {
+	key, err := s.key(op, name)
+	if err != nil {
+		return nil, err
+	}
+	if name == "." {
+		return &s3FileInfo{name: ".", dir: true}, nil
+	}
+	object, err := s.client.StatObject(context.Background(), s.bucket, key, minio.StatObjectOptions{})
+	if err == nil {
+		return newS3FileInfo(path.Base(name), object), nil
+	}
+	if minio.ToErrorResponse(err).Code != minio.NoSuchKey {
+		return nil, s.pathError(op, name, err)
+	}
+	isDir, err := s.isDir(key)
+	if err != nil {
+		return nil, s.pathError(op, name, err)
+	}
+	if !isDir {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return &s3FileInfo{name: path.Base(name), dir: true}, nil
+}
+
+func (s *S3FS) Open(name string) (fs.File, error) {
+	info, err := s.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.dir {
+		return &dirFile{name: name, info: info, readDir: s.ReadDir}, nil
+	}
+	key, _ := s.key("open", name)
+	object, err := s.client.GetObject(context.Background(), s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.pathError("open", name, err)
+	}
+	return &s3File{Object: object, info: info}, nil
+}
+
+func (s *S3FS) Stat(name string) (fs.FileInfo, error) {
+	info, err := s.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *S3FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	key, err := s.key("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	prefix := dirPrefix(key)
+	var entries = []fs.DirEntry{}
+	for object := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			return nil, s.pathError("readdir", name, object.Err)
+		}
+		rel := strings.TrimPrefix(object.Key, prefix)
+		switch {
+		case rel == "":
+			// folder marker
+			continue
+		case strings.HasSuffix(rel, "/"):
+			entries = append(entries, fs.FileInfoToDirEntry(&s3FileInfo{name: strings.TrimSuffix(rel, "/"), dir: true}))
+		default:
+			entries = append(entries, fs.FileInfoToDirEntry(newS3FileInfo(rel, object)))
+		}
+	}
+	if len(entries) == 0 && name != "." {
+		if _, err := s.stat("readdir", name); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// objects returns the keys of key and of all objects below key
+func (s *S3FS) objects(key string) ([]string, error) {
+	var keys = []string{}
+	if _, err := s.client.StatObject(context.Background(), s.bucket, key, minio.StatObjectOptions{}); err == nil {
+		keys = append(keys, key)
+	}
+	for object := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{Prefix: dirPrefix(key), Recursive: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		keys = append(keys, object.Key)
+	}
+	return keys, nil
+}
+
+func (s *S3FS) Remove(name string) error {
+	info, err := s.stat("remove", name)
+	if err != nil {
+		return err
+	}
+	key, _ := s.key("remove", name)
+	if info.dir {
+		isDir, err := s.isDir(key)
+		if err != nil {
+			return s.pathError("remove", name, err)
+		}
+		if isDir {
+			return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+		}
+	}
+	if err := s.client.RemoveObject(context.Background(), s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return s.pathError("remove", name, err)
+	}
+	return nil
+}
+
+func (s *S3FS) RemoveAll(name string) error {
+	key, err := s.key("removeall", name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return errors.Errorf("cannot remove root folder '%s'", s)
+	}
+	keys, err := s.objects(key)
+	if err != nil {
+		return s.pathError("removeall", name, err)
+	}
+	for _, key := range keys {
+		if err := s.client.RemoveObject(context.Background(), s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+			return s.pathError("removeall", name, err)
+		}
+	}
+	return nil
+}
+
+// Rename copies the object or all objects of the folder to the new key and removes the originals.
+// Object stores have no atomic rename.
+func (s *S3FS) Rename(oldName, newName string) error {
+	oldKey, err := s.key("rename", oldName)
+	if err != nil {
+		return err
+	}
+	newKey, err := s.key("rename", newName)
+	if err != nil {
+		return err
+	}
+	if oldName == "." || newName == "." {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrInvalid}
+	}
+	keys, err := s.objects(oldKey)
+	if err != nil {
+		return s.pathError("rename", oldName, err)
+	}
+	if len(keys) == 0 {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrNotExist}
+	}
+	for _, key := range keys {
+		target := newKey + strings.TrimPrefix(key, oldKey)
+		// ComposeObject copies objects larger than 5GiB as well
+		if _, err := s.client.ComposeObject(context.Background(),
+			minio.CopyDestOptions{Bucket: s.bucket, Object: target},
+			minio.CopySrcOptions{Bucket: s.bucket, Object: key},
+		); err != nil {
+			return s.pathError("rename", oldName, err)
+		}
+		if err := s.client.RemoveObject(context.Background(), s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+			return s.pathError("rename", oldName, err)
+		}
+	}
+	return nil
+}
+
+func (s *S3FS) Close() error {
+	return nil
+}
+
+// s3File is an opened object. The object supports random access (i.e. for zip containers).
+type s3File struct {
+	*minio.Object
+	info *s3FileInfo
+}
+
+func (f *s3File) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// Seek supports negative offsets relative to the current position, which are rejected by minio.Object
+func (f *s3File) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekCurrent && offset < 0 {
+		pos, err := f.Object.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		return f.Object.Seek(pos+offset, io.SeekStart)
+	}
+	return f.Object.Seek(offset, whence)
+}
+
+// newS3FileInfo returns the file info of an object. The modification time is truncated to seconds,
+// which is the precision of StatObject (http header) in contrast to ListObjects.
+func newS3FileInfo(name string, object minio.ObjectInfo) *s3FileInfo {
+	return &s3FileInfo{
+		name:    name,
+		size:    object.Size,
+		modTime: object.LastModified.Truncate(time.Second),
+		etag:    strings.Trim(object.ETag, `"`),
+	}
+}
+
+type s3FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	etag    string
+	dir     bool
+}
+
+func (i *s3FileInfo) Name() string       { return i.name }
+func (i *s3FileInfo) Size() int64        { return i.size }
+func (i *s3FileInfo) ModTime() time.Time { return i.modTime }
+func (i *s3FileInfo) IsDir() bool        { return i.dir }
+func (i *s3FileInfo) Sys() any           { return nil }
+func (i *s3FileInfo) ETag() string       { return i.etag }
+func (i *s3FileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+var (
+	_ fs.ReadDirFS = (*S3FS)(nil)
+	_ fs.StatFS    = (*S3FS)(nil)
+	_ ETagInfo     = (*s3FileInfo)(nil)
+)
@@ -0,0 +1,201 @@
+package identifier
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// more objects than returned by a single list request
+const testS3ManyObjects = 1205
+
+// startS3Server starts an in-memory s3 server with the bucket "test" and returns the config of its endpoint
+func startS3Server(t *testing.T, objects map[string]string) *S3Config {
+	t.Helper()
+	server := httptest.NewServer(gofakes3.New(s3mem.New()).Server())
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &S3Config{Endpoint: u.Host, AccessKey: "access", SecretKey: "secret", Region: "us-east-1", Insecure: true}
+	client, err := minio.New(conf.Endpoint, &minio.Options{Creds: credentials.NewStaticV4(conf.AccessKey, conf.SecretKey, ""), Region: conf.Region})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := client.MakeBucket(ctx, "test", minio.MakeBucketOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for key, content := range objects {
+		if _, err := client.PutObject(ctx, "test", key, bytes.NewReader([]byte(content)), int64(len(content)), minio.PutObjectOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return conf
+}
+
+func testS3Objects() map[string]string {
+	var objects = map[string]string{
+		"data/a.txt":        "alpha",
+		"data/sub/b.txt":    "bravo",
+		"data/sub/deep/c":   "charlie",
+		"database/x.txt":    "not below data/",
+		"other/outside.txt": "outside",
+	}
+	for i := 0; i < testS3ManyObjects; i++ {
+		objects[fmt.Sprintf("data/many/%04d.txt", i)] = fmt.Sprintf("%d", i)
+	}
+	return objects
+}
+
+func TestS3FS(t *testing.T) {
+	conf := startS3Server(t, testS3Objects())
+
+	fsys, err := NewS3FS("s3://test/data/", conf, testLogger())
+	if err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+	defer fsys.Close()
+	if fsys.String() != "s3://test/data" {
+		t.Errorf("location: got '%s', want 's3://test/data'", fsys)
+	}
+
+	entries, err := fsys.ReadDir(".")
+	if err != nil {
+		t.Fatalf("cannot read root folder: %v", err)
+	}
+	var names = []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, ",") != "a.txt,many,sub" {
+		t.Errorf("root folder: got %v, want [a.txt many sub]", names)
+	}
+
+	// the listing is continued over several pages
+	entries, err = fsys.ReadDir("many")
+	if err != nil {
+		t.Fatalf("cannot read folder 'many': %v", err)
+	}
+	if len(entries) != testS3ManyObjects {
+		t.Errorf("folder 'many': got %d entries, want %d", len(entries), testS3ManyObjects)
+	}
+
+	var files int
+	if err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.Contains(path, "outside") || strings.Contains(path, "x.txt") {
+			t.Errorf("walk: '%s' is not below the prefix", path)
+		}
+		if !d.IsDir() {
+			files++
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("cannot walk: %v", err)
+	}
+	if files != testS3ManyObjects+3 {
+		t.Errorf("walk: got %d files, want %d", files, testS3ManyObjects+3)
+	}
+
+	data, err := fs.ReadFile(fsys, "sub/deep/c")
+	if err != nil {
+		t.Fatalf("cannot read file: %v", err)
+	}
+	if string(data) != "charlie" {
+		t.Errorf("read: got %q, want %q", data, "charlie")
+	}
+	info, err := fsys.Stat("many/0042.txt")
+	if err != nil {
+		t.Fatalf("cannot stat file: %v", err)
+	}
+	if info.Size() != 2 || ETagOf(info) == "" {
+		t.Errorf("stat: got size %d and etag '%s'", info.Size(), ETagOf(info))
+	}
+
+	sub, err := NewS3FS("s3://test/data/sub", conf, testLogger())
+	if err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+	if err := fstest.TestFS(sub, "b.txt", "deep/c"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestS3FSPrefix(t *testing.T) {
+	conf := startS3Server(t, testS3Objects())
+
+	// "dat" is no folder, although it is a prefix of the keys "data/..."
+	fsys, err := NewS3FS("s3://test/dat", conf, testLogger())
+	if err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+	entries, err := fsys.ReadDir(".")
+	if err != nil {
+		t.Fatalf("cannot read root folder: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("prefix 'dat': got %d entries, want none", len(entries))
+	}
+
+	// the whole bucket
+	fsys, err = NewS3FS("s3://test", conf, testLogger())
+	if err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+	data, err := fs.ReadFile(fsys, "other/outside.txt")
+	if err != nil {
+		t.Fatalf("cannot read file: %v", err)
+	}
+	if string(data) != "outside" {
+		t.Errorf("read: got %q, want %q", data, "outside")
+	}
+	if _, err := fsys.Stat("data/many"); err != nil {
+		t.Errorf("stat folder: %v", err)
+	}
+}
+
+func TestS3FSMissing(t *testing.T) {
+	conf := startS3Server(t, testS3Objects())
+
+	fsys, err := NewS3FS("s3://test/data", conf, testLogger())
+	if err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+	for _, name := range []string{"missing.txt", "sub/missing", "many/9999.txt"} {
+		if _, err := fsys.Open(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("open '%s': got %v, want fs.ErrNotExist", name, err)
+		}
+		if _, err := fsys.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("stat '%s': got %v, want fs.ErrNotExist", name, err)
+		}
+	}
+	if _, err := fsys.ReadDir("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("readdir: got %v, want fs.ErrNotExist", err)
+	}
+	if _, err := fsys.Open("../x.txt"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("open '../x.txt': got %v, want fs.ErrInvalid", err)
+	}
+
+	if _, err := NewS3FS("s3://missing", conf, testLogger()); err == nil {
+		t.Error("missing bucket: no error")
+	}
+	if _, err := NewS3FS("s3://user:password@test", conf, testLogger()); err == nil {
+		t.Error("credentials in url: no error")
+	}
+}
@@ -0,0 +1,231 @@
+package identifier
+
+import (
+	"encoding/json"
+	"runtime"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+// SchemaVersion is the version of the database layout and of the records written by this version
+const SchemaVersion = 4
+
+// key of the schema record
+const schemaKey = "meta:schema"
+
+// ErrSchemaOutdated is returned for databases, which must be migrated with 'db migrate'
+var ErrSchemaOutdated = errors.New("database schema is outdated - use 'db migrate'")
+
+// ErrSchemaUnsupported is returned for databases written by a newer version
+var ErrSchemaUnsupported = errors.New("database schema is newer than supported")
+
+// Schema is the value of "meta:schema"
+type Schema struct {
+	Version int `json:"version"`
+	// Created is the time, the schema record has been written first
+	Created  int64 `json:"created,omitempty"`
+	Migrated int64 `json:"migrated,omitempty"`
+	// Detected is set for databases of older versions without schema record
+	Detected bool `json:"-"`
+}
+
+// Migration upgrades the database from one schema version to the next
+type Migration struct {
+	From        int
+	To          int
+	Description string
+	count       func(store Store) (int64, error)
+	migrate     func(store Store, logger zLogger.ZLogger) error
+}
+
+// Count returns the number of records touched by the migration
+func (m *Migration) Count(store Store) (int64, error) {
+	return m.count(store)
+}
+
+var migrations = []*Migration{
+	{
+		From:        1,
+		To:          2,
+		Description: "assign records to source '" + DefaultSource + "'",
+		count: func(store Store) (int64, error) {
+			return countKeys(store, "file:", "fixity:", "ai:")
+		},
+		migrate: migrateSources,
+	},
+	{
+		From:        2,
+		To:          3,
+		Description: "create secondary indexes from file records",
+		count: func(store Store) (int64, error) {
+			// the checksum index of version 2 is replaced
+			return countKeys(store, "file:", "sum:")
+		},
+		migrate: func(store Store, logger zLogger.ZLogger) error {
+			_, err := RebuildSecondary(store, logger)
+			return err
+		},
+	},
+	{
+		From:        3,
+		To:          4,
+		Description: "add unidentified files to the pronom and mime indexes",
+		count: func(store Store) (int64, error) {
+			return countKeys(store, "file:")
+		},
+		migrate: func(store Store, logger zLogger.ZLogger) error {
+			_, err := RebuildSecondary(store, logger)
+			return err
+		},
+	},
+}
+
+// countKeys returns the number of keys with the prefixes
+func countKeys(store Store, prefixes ...string) (int64, error) {
+	var count int64
+	if err := store.View(func(txn Txn) error {
+		for _, prefix := range prefixes {
+			if err := txn.IterateKeys([]byte(prefix), func(key []byte) error {
+				count++
+				return nil
+			}); err != nil {
+				return errors.Wrapf(err, "cannot count keys with prefix '%s'", prefix)
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return count, nil
+}
+
+// detectSchema determines the version of databases without schema record
+func detectSchema(txn Txn) (int, error) {
+	hasFiles, err := hasPrefix(txn, []byte("file:"))
+	if err != nil || !hasFiles {
+		// empty databases have the current version
+		return SchemaVersion, err
+	}
+	hasSources, err := hasPrefix(txn, []byte("source:"))
+	if err != nil || !hasSources {
+		return 1, err
+	}
+	hasIndex, err := hasPrefix(txn, []byte(secondaryPrefix))
+	if err != nil || !hasIndex {
+		return 2, err
+	}
+	return 3, nil
+}
+
+// LoadSchema reads the schema record or detects the version of older databases
+func LoadSchema(store Store) (*Schema, error) {
+	schema := &Schema{}
+	if err := store.View(func(txn Txn) error {
+		value, err := getValue(txn, []byte(schemaKey))
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			return errors.Wrapf(json.Unmarshal(value, schema), "cannot unmarshal '%s'", schemaKey)
+		}
+		schema.Detected = true
+		schema.Version, err = detectSchema(txn)
+		return err
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return schema, nil
+}
+
+func storeSchema(store Store, schema *Schema) error {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal '%s'", schemaKey)
+	}
+	return errors.WithStack(store.Update(func(txn Txn) error {
+		return errors.Wrapf(txn.Set([]byte(schemaKey), data), "cannot write '%s'", schemaKey)
+	}))
+}
+
+// CheckSchema checks, whether the database has the current schema version.
+// The schema record of new databases is written, unless the database is read only.
+func CheckSchema(store Store, readOnly bool) error {
+	schema, err := LoadSchema(store)
+	if err != nil {
+		return err
+	}
+	switch {
+	case schema.Version > SchemaVersion:
+		return errors.Wrapf(ErrSchemaUnsupported, "schema version %d, supported version %d", schema.Version, SchemaVersion)
+	case schema.Version < SchemaVersion:
+		return errors.Wrapf(ErrSchemaOutdated, "schema version %d, current version %d", schema.Version, SchemaVersion)
+	}
+	if schema.Detected && !readOnly {
+		schema.Created = time.Now().Unix()
+		return storeSchema(store, schema)
+	}
+	return nil
+}
+
+// PendingMigrations returns the migrations from the schema version to the current version
+func PendingMigrations(schema *Schema) []*Migration {
+	var pending = []*Migration{}
+	for _, m := range migrations {
+		if m.From >= schema.Version {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// MigrateStore opens the database at location and applies the pending migrations step by step.
+// The schema record is updated after every step. Without apply the database is not changed.
+// do is called for every pending migration with the number of records touched.
+func MigrateStore(location string, apply bool, logger zLogger.ZLogger, do func(schema *Schema, m *Migration, count int64)) (*Schema, error) {
+	readOnly := !apply
+	if runtime.GOOS == "windows" {
+		readOnly = false
+	}
+	store, err := openStore(location, readOnly, logger)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	schema, err := LoadSchema(store)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot load schema of database '%s'", location)
+	}
+	if schema.Version > SchemaVersion {
+		return schema, errors.Wrapf(ErrSchemaUnsupported, "schema version %d, supported version %d", schema.Version, SchemaVersion)
+	}
+	pending := PendingMigrations(schema)
+	for _, m := range pending {
+		count, err := m.Count(store)
+		if err != nil {
+			return schema, errors.Wrapf(err, "cannot count records of migration %d -> %d", m.From, m.To)
+		}
+		do(schema, m, count)
+		if !apply {
+			continue
+		}
+		logger.Info().Msgf("migrating database '%s' from schema version %d to %d: %s", location, m.From, m.To, m.Description)
+		if err := m.migrate(store, logger); err != nil {
+			return schema, errors.Wrapf(err, "cannot migrate database '%s' from schema version %d to %d", location, m.From, m.To)
+		}
+		schema.Version = m.To
+		schema.Migrated = time.Now().Unix()
+		if err := storeSchema(store, schema); err != nil {
+			return schema, errors.Wrapf(err, "cannot store schema version %d", m.To)
+		}
+	}
+	if apply && schema.Detected && len(pending) == 0 {
+		// databases of the current version without schema record
+		schema.Created = time.Now().Unix()
+		if err := storeSchema(store, schema); err != nil {
+			return schema, errors.WithStack(err)
+		}
+	}
+	return schema, nil
+}
@@ -0,0 +1,267 @@
+package identifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/checksum"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+// secondaryPrefix is the key space of the secondary indexes "idx:<index>:<value>:<source>:<path>"
+const secondaryPrefix = "idx:"
+
+// SecondaryIndex is the name of a secondary index
+type SecondaryIndex string
+
+const (
+	// IndexSum contains the checksums "idx:sum:<digest>:<checksum>:<source>:<path>"
+	IndexSum SecondaryIndex = "sum"
+	// IndexPronom contains the pronom ids "idx:pronom:<puid>:<source>:<path>"
+	IndexPronom SecondaryIndex = "pronom"
+	// IndexMime contains the mime types "idx:mime:<mimetype>:<source>:<path>"
+	IndexMime SecondaryIndex = "mime"
+)
+
+// indexEmptyValue is the value part of keys of unidentified files (empty pronom id or mime type).
+// Escaped values never consist of a single '%'.
+const indexEmptyValue = "%"
+
+// IndexEntry is the value of all secondary index keys.
+// It contains the data needed for duplicate groups and statistics without reading the file record.
+type IndexEntry struct {
+	Size      int64  `json:"size"`
+	LastMod   int64  `json:"lastmod"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Container string `json:"container,omitempty"`
+}
+
+// IndexedFile is a file found in a secondary index
+type IndexedFile struct {
+	Value  string
+	Source string
+	Path   string
+	Entry  *IndexEntry
+}
+
+// values must not contain the separator of the key parts
+var indexValueEscaper = strings.NewReplacer("%", "%25", ":", "%3a")
+var indexValueUnescaper = strings.NewReplacer("%3a", ":", "%25", "%")
+
+// IndexPrefix returns the key prefix of all files with value in the index. An empty value addresses the whole index.
+func IndexPrefix(index SecondaryIndex, value string) []byte {
+	if value == "" {
+		return []byte(secondaryPrefix + string(index) + ":")
+	}
+	return []byte(secondaryPrefix + string(index) + ":" + indexValueEscaper.Replace(value) + ":")
+}
+
+func indexKey(index SecondaryIndex, value, source, path string) []byte {
+	if value == "" {
+		return []byte(secondaryPrefix + string(index) + ":" + indexEmptyValue + ":" + source + ":" + path)
+	}
+	return append(IndexPrefix(index, value), []byte(source+":"+path)...)
+}
+
+// parseIndexKey splits a key of the index into value, source and path
+func parseIndexKey(index SecondaryIndex, key []byte) (value, source, path string, ok bool) {
+	parts := strings.SplitN(string(bytes.TrimPrefix(key, IndexPrefix(index, ""))), ":", 3)
+	if len(parts) != 3 {
+		return "", "", "", false
+	}
+	if parts[0] == indexEmptyValue {
+		return "", parts[1], parts[2], true
+	}
+	return indexValueUnescaper.Replace(parts[0]), parts[1], parts[2], true
+}
+
+// the value of the checksum index consists of digest and checksum
+func sumPrefix(digest checksum.DigestAlgorithm, sum string) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s:%s:", secondaryPrefix, IndexSum, digest, sum))
+}
+
+func sumKey(digest checksum.DigestAlgorithm, sum string, source, path string) []byte {
+	return append(sumPrefix(digest, sum), []byte(source+":"+path)...)
+}
+
+// secondaryKeys returns all keys, which are maintained together with the file record
+func secondaryKeys(fData *FileData) [][]byte {
+	var keys = [][]byte{}
+	if fData.Indexer == nil {
+		return keys
+	}
+	for alg, sum := range fData.Indexer.Checksum {
+		if sum != "" {
+			keys = append(keys, sumKey(checksum.DigestAlgorithm(alg), sum, fData.Source, fData.Path))
+		}
+	}
+	// unidentified files are indexed with an empty value to be part of the statistics
+	keys = append(keys, indexKey(IndexPronom, fData.Indexer.Pronom, fData.Source, fData.Path))
+	keys = append(keys, indexKey(IndexMime, fData.Indexer.Mimetype, fData.Source, fData.Path))
+	return keys
+}
+
+func setSecondaryKeys(txn Txn, fData *FileData) error {
+	entry, err := json.Marshal(&IndexEntry{Size: fData.Size, LastMod: fData.LastMod, Duplicate: fData.Duplicate, Container: fData.Container})
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal index entry")
+	}
+	for _, key := range secondaryKeys(fData) {
+		if err := txn.Set(key, entry); err != nil {
+			return errors.Wrapf(err, "cannot write '%s'", key)
+		}
+	}
+	return nil
+}
+
+func deleteSecondaryKeys(txn Txn, fData *FileData) error {
+	for _, key := range secondaryKeys(fData) {
+		if err := txn.Delete(key); err != nil {
+			return errors.Wrapf(err, "cannot delete '%s'", key)
+		}
+	}
+	return nil
+}
+
+// IterateSecondary calls do for all files with value in the pronom or mime index. An empty value iterates over the whole index.
+// If source is not empty, only files of this source are considered. Duplicates are iterated by IterateDuplicates.
+func (r *StoreIterator) IterateSecondary(index SecondaryIndex, value, source string, do func(file *IndexedFile) error) error {
+	if err := r.store.View(func(txn Txn) error {
+		return txn.Iterate(IndexPrefix(index, value), func(key, val []byte) error {
+			fileValue, fileSource, path, ok := parseIndexKey(index, key)
+			if !ok || (source != "" && fileSource != source) {
+				return nil
+			}
+			entry := &IndexEntry{}
+			if err := json.Unmarshal(val, entry); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal '%s'", key)
+			}
+			return do(&IndexedFile{Value: fileValue, Source: fileSource, Path: path, Entry: entry})
+		})
+	}); err != nil {
+		return errors.Wrapf(err, "cannot iterate index '%s'", index)
+	}
+	return nil
+}
+
+// IterateIndexed calls do for the records of all files with value in the index (see IterateFiles)
+func (r *StoreIterator) IterateIndexed(index SecondaryIndex, value, source, prefix string, do func(fData *FileData) (remove bool, err error)) error {
+	var removeFiles = []*IndexedFile{}
+	if err := r.store.View(func(txn Txn) error {
+		var files = []*IndexedFile{}
+		if err := txn.IterateKeys(IndexPrefix(index, value), func(key []byte) error {
+			fileValue, fileSource, path, ok := parseIndexKey(index, key)
+			if !ok || (source != "" && fileSource != source) || !strings.HasPrefix(path, prefix) {
+				return nil
+			}
+			files = append(files, &IndexedFile{Value: fileValue, Source: fileSource, Path: path})
+			return nil
+		}); err != nil {
+			return errors.WithStack(err)
+		}
+		for _, file := range files {
+			fData, err := getFileData(txn, file.Source, file.Path)
+			if err != nil {
+				return err
+			}
+			if fData == nil {
+				r.logger.Warn().Msgf("no record for index entry '%s'", indexKey(index, file.Value, file.Source, file.Path))
+				continue
+			}
+			remove, err := do(fData)
+			if err != nil {
+				return errors.Wrapf(err, "cannot iterate data for key '%s'", FileKey(file.Source, file.Path))
+			}
+			if remove {
+				removeFiles = append(removeFiles, file)
+			}
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "cannot iterate index '%s' with value '%s'", index, value)
+	}
+	if !r.readOnly && len(removeFiles) > 0 {
+		r.logger.Info().Msgf("removing %d file records", len(removeFiles))
+		for _, file := range removeFiles {
+			if err := r.RemoveFileData(file.Source, file.Path); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
+
+// number of records per transaction of index rebuilds
+const rebuildBatch = 1000
+
+// RebuildSecondary removes all secondary indexes and creates them from the file records
+func RebuildSecondary(store Store, logger zLogger.ZLogger) (int64, error) {
+	// "sum:" is the checksum index of older versions
+	for _, prefix := range []string{secondaryPrefix, "sum:"} {
+		var keys = [][]byte{}
+		if err := store.View(func(txn Txn) error {
+			return txn.IterateKeys([]byte(prefix), func(key []byte) error {
+				keys = append(keys, key)
+				return nil
+			})
+		}); err != nil {
+			return 0, errors.Wrapf(err, "cannot read '%s'", prefix)
+		}
+		logger.Info().Msgf("removing %d index keys with prefix '%s'", len(keys), prefix)
+		for start := 0; start < len(keys); start += rebuildBatch {
+			batch := keys[start:min(start+rebuildBatch, len(keys))]
+			if err := store.Update(func(txn Txn) error {
+				for _, key := range batch {
+					if err := txn.Delete(key); err != nil {
+						return errors.Wrapf(err, "cannot delete '%s'", key)
+					}
+				}
+				return nil
+			}); err != nil {
+				return 0, errors.Wrap(err, "cannot remove index keys")
+			}
+		}
+	}
+
+	var count int64
+	var batch = []*FileData{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := store.Update(func(txn Txn) error {
+			for _, fData := range batch {
+				if err := setSecondaryKeys(txn, fData); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "cannot write index keys")
+		}
+		count += int64(len(batch))
+		logger.Info().Msgf("%d file records indexed", count)
+		batch = []*FileData{}
+		return nil
+	}
+	// the file records are read in a separate transaction, index keys are not part of the iteration
+	if err := store.View(func(txn Txn) error {
+		return txn.Iterate([]byte("file:"), func(key, value []byte) error {
+			fData := &FileData{}
+			if err := json.Unmarshal(value, fData); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal '%s'", key)
+			}
+			batch = append(batch, fData)
+			if len(batch) < rebuildBatch {
+				return nil
+			}
+			return flush()
+		})
+	}); err != nil {
+		return count, errors.Wrap(err, "cannot read file records")
+	}
+	return count, errors.WithStack(flush())
+}
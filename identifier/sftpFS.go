@@ -0,0 +1,329 @@
+package identifier
+
+import (
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPConfig contains the credentials for sftp data roots.
+// Without password and key file the keys of the ssh agent (SSH_AUTH_SOCK) are used.
+type SFTPConfig struct {
+	User                  string `toml:"user"`
+	Password              string `toml:"password"`
+	KeyFile               string `toml:"keyfile"`
+	KeyPassphrase         string `toml:"keypassphrase"`
+	KnownHosts            string `toml:"knownhosts"`
+	InsecureIgnoreHostKey bool   `toml:"insecureignorehostkey"`
+	Timeout               string `toml:"timeout"`
+}
+
+// expandHome replaces a leading '~' with the home directory
+func expandHome(name string) string {
+	if name != "~" && !strings.HasPrefix(name, "~/") {
+		return name
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(home, name[1:])
+}
+
+// sshAuth returns the authentication methods of the config and the ssh agent
+func sshAuth(conf *SFTPConfig) ([]ssh.AuthMethod, func() error, error) {
+	var methods = []ssh.AuthMethod{}
+	var closer = func() error { return nil }
+	if conf.KeyFile != "" {
+		key, err := os.ReadFile(expandHome(conf.KeyFile))
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "cannot read key file '%s'", conf.KeyFile)
+		}
+		var signer ssh.Signer
+		if conf.KeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(conf.KeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "cannot parse key file '%s'", conf.KeyFile)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "cannot connect to ssh agent '%s'", socket)
+		}
+		closer = conn.Close
+		methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	if conf.Password != "" {
+		methods = append(methods, ssh.Password(conf.Password))
+	}
+	if len(methods) == 0 {
+		return nil, nil, errors.New("no sftp credentials - configure password or key file or start ssh agent")
+	}
+	return methods, closer, nil
+}
+
+// sshHostKeyCallback checks the host key against the known hosts file
+func sshHostKeyCallback(conf *SFTPConfig) (ssh.HostKeyCallback, error) {
+	if conf.InsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	knownHosts := expandHome(conf.KnownHosts)
+	if knownHosts == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get home directory")
+		}
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read known hosts file '%s'", knownHosts)
+	}
+	return callback, nil
+}
+
+// parseSFTPURL parses an sftp://user@host[:port]/path url and adds the user of the config, if the url has none.
+// Passwords must not be part of the url, they are taken from the config.
+func parseSFTPURL(location string, conf *SFTPConfig) (*url.URL, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse '%s'", location)
+	}
+	if _, ok := u.User.Password(); ok {
+		return nil, errors.Errorf("password in '%s' not allowed - use config file or ssh agent", u.Redacted())
+	}
+	user := u.User.Username()
+	if user == "" && conf != nil {
+		user = conf.User
+	}
+	if user == "" {
+		return nil, errors.Errorf("no user for '%s'", location)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.Errorf("no host in '%s'", location)
+	}
+	u.User = url.User(user)
+	u.Path = strings.TrimSuffix(path.Clean("/"+u.Path), "/")
+	u.RawQuery, u.Fragment = "", ""
+	return u, nil
+}
+
+// NewSFTPFS connects to the server of an sftp://user@host[:port]/path url
+func NewSFTPFS(location string, conf *SFTPConfig, logger zLogger.ZLogger) (*SFTPFS, error) {
+	if conf == nil {
+		conf = &SFTPConfig{}
+	}
+	u, err := parseSFTPURL(location, conf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	user := u.User.Username()
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "22")
+	}
+	timeout := 30 * time.Second
+	if conf.Timeout != "" {
+		if timeout, err = time.ParseDuration(conf.Timeout); err != nil {
+			return nil, errors.Wrapf(err, "invalid sftp timeout '%s'", conf.Timeout)
+		}
+	}
+	auth, authCloser, err := sshAuth(conf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer authCloser()
+	hostKeyCallback, err := sshHostKeyCallback(conf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	logger.Info().Msgf("connecting to sftp://%s@%s", user, host)
+	conn, err := ssh.Dial("tcp", host, &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot connect to '%s'", host)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "cannot start sftp session on '%s'", host)
+	}
+	root := u.Path
+	if root == "" {
+		root = "."
+	}
+	fi, err := client.Stat(root)
+	if err != nil || !fi.IsDir() {
+		client.Close()
+		conn.Close()
+		return nil, errors.Errorf("'%s' is not a directory on '%s'", root, host)
+	}
+	fsys := NewSFTPFSFromClient(client, root, u.String())
+	fsys.conn = conn
+	return fsys, nil
+}
+
+// NewSFTPFSFromClient creates the file system for root on an existing sftp session (i.e. of an in-process server)
+func NewSFTPFSFromClient(client *sftp.Client, root string, location string) *SFTPFS {
+	return &SFTPFS{client: client, root: root, location: location}
+}
+
+type SFTPFS struct {
+	client   *sftp.Client
+	conn     *ssh.Client
+	root     string
+	location string
+}
+
+func (s *SFTPFS) String() string {
+	return s.location
+}
+
+func (s *SFTPFS) fullpath(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join(s.root, name), nil
+}
+
+// pathError converts the errors of the sftp client to errors of io/fs
+func (s *SFTPFS) pathError(op, name string, err error) error {
+	var statusErr *sftp.StatusError
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		err = fs.ErrNotExist
+	case errors.Is(err, os.ErrPermission):
+		err = fs.ErrPermission
+	case errors.As(err, &statusErr) && statusErr.FxCode() == sftp.ErrSSHFxNoSuchFile:
+		err = fs.ErrNotExist
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (s *SFTPFS) Open(name string) (fs.File, error) {
+	fullpath, err := s.fullpath("open", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := s.client.Stat(fullpath)
+	if err != nil {
+		return nil, s.pathError("open", name, err)
+	}
+	if fi.IsDir() {
+		return &dirFile{name: name, info: fi, readDir: s.ReadDir}, nil
+	}
+	fp, err := s.client.Open(fullpath)
+	if err != nil {
+		return nil, s.pathError("open", name, err)
+	}
+	return fp, nil
+}
+
+func (s *SFTPFS) Stat(name string) (fs.FileInfo, error) {
+	fullpath, err := s.fullpath("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := s.client.Stat(fullpath)
+	if err != nil {
+		return nil, s.pathError("stat", name, err)
+	}
+	return fi, nil
+}
+
+func (s *SFTPFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fullpath, err := s.fullpath("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := s.client.ReadDir(fullpath)
+	if err != nil {
+		return nil, s.pathError("readdir", name, err)
+	}
+	var entries = make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (s *SFTPFS) Remove(name string) error {
+	fullpath, err := s.fullpath("remove", name)
+	if err != nil {
+		return err
+	}
+	if err := s.client.Remove(fullpath); err != nil {
+		return s.pathError("remove", name, err)
+	}
+	return nil
+}
+
+func (s *SFTPFS) RemoveAll(name string) error {
+	fullpath, err := s.fullpath("removeall", name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return errors.Errorf("cannot remove root folder '%s'", s.location)
+	}
+	if err := s.client.RemoveAll(fullpath); err != nil {
+		return s.pathError("removeall", name, err)
+	}
+	return nil
+}
+
+func (s *SFTPFS) Rename(oldName, newName string) error {
+	oldPath, err := s.fullpath("rename", oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := s.fullpath("rename", newName)
+	if err != nil {
+		return err
+	}
+	if err := s.client.Rename(oldPath, newPath); err != nil {
+		return s.pathError("rename", oldName, err)
+	}
+	return nil
+}
+
+func (s *SFTPFS) Close() error {
+	var errs = []error{}
+	if err := s.client.Close(); err != nil {
+		errs = append(errs, errors.Wrap(err, "cannot close sftp session"))
+	}
+	if s.conn != nil {
+		if err := s.conn.Close(); err != nil {
+			errs = append(errs, errors.Wrap(err, "cannot close ssh connection"))
+		}
+	}
+	return errors.Combine(errs...)
+}
+
+var (
+	_ fs.ReadDirFS = (*SFTPFS)(nil)
+	_ fs.StatFS    = (*SFTPFS)(nil)
+)
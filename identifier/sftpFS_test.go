@@ -0,0 +1,217 @@
+package identifier
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pkg/sftp"
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/ssh"
+)
+
+const testSFTPPassword = "secret"
+
+// startSFTPServer starts an ssh server with sftp subsystem on a loopback port, which serves the local file system
+func startSFTPServer(t *testing.T) string {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "test" && string(password) == testSFTPPassword {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(conn, config)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveSFTP(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					go func() {
+						defer channel.Close()
+						server, err := sftp.NewServer(channel)
+						if err != nil {
+							return
+						}
+						server.Serve()
+					}()
+				}
+			}
+		}()
+	}
+}
+
+func testSFTPTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.txt":         "alpha",
+		"sub/b.txt":     "bravo",
+		"sub/deep/c.md": "charlie",
+		"empty.bin":     "",
+	} {
+		full := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func testLogger() *zerolog.Logger {
+	logger := zerolog.Nop()
+	return &logger
+}
+
+func TestSFTPFS(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	addr := startSFTPServer(t)
+	dir := testSFTPTree(t)
+
+	fsys, err := NewSFTPFS("sftp://test@"+addr+filepath.ToSlash(dir), &SFTPConfig{Password: testSFTPPassword, InsecureIgnoreHostKey: true}, testLogger())
+	if err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+	defer fsys.Close()
+
+	if err := fstest.TestFS(fsys, "a.txt", "sub/b.txt", "sub/deep/c.md", "empty.bin"); err != nil {
+		t.Fatal(err)
+	}
+
+	var files = []string{}
+	if err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("cannot walk: %v", err)
+	}
+	want := []string{"a.txt", "empty.bin", "sub/b.txt", "sub/deep/c.md"}
+	if len(files) != len(want) {
+		t.Fatalf("walk: got %v, want %v", files, want)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Fatalf("walk: got %v, want %v", files, want)
+		}
+	}
+
+	data, err := fs.ReadFile(fsys, "sub/deep/c.md")
+	if err != nil {
+		t.Fatalf("cannot read file: %v", err)
+	}
+	if string(data) != "charlie" {
+		t.Errorf("read: got %q, want %q", data, "charlie")
+	}
+}
+
+func TestSFTPFSMissing(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	addr := startSFTPServer(t)
+	dir := testSFTPTree(t)
+
+	fsys, err := NewSFTPFS("sftp://test@"+addr+filepath.ToSlash(dir), &SFTPConfig{Password: testSFTPPassword, InsecureIgnoreHostKey: true}, testLogger())
+	if err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+	defer fsys.Close()
+
+	for _, name := range []string{"missing.txt", "sub/missing"} {
+		if _, err := fsys.Open(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("open '%s': got %v, want fs.ErrNotExist", name, err)
+		}
+		if _, err := fsys.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("stat '%s': got %v, want fs.ErrNotExist", name, err)
+		}
+	}
+	if _, err := fsys.ReadDir("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("readdir: got %v, want fs.ErrNotExist", err)
+	}
+	if _, err := fsys.Open("../a.txt"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("open '../a.txt': got %v, want fs.ErrInvalid", err)
+	}
+
+	if _, err := NewSFTPFS("sftp://test@"+addr+filepath.ToSlash(dir)+"/missing", &SFTPConfig{Password: testSFTPPassword, InsecureIgnoreHostKey: true}, testLogger()); err == nil {
+		t.Error("missing root folder: no error")
+	}
+}
+
+func TestSFTPFSAuthFailure(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	addr := startSFTPServer(t)
+	dir := testSFTPTree(t)
+
+	fsys, err := NewSFTPFS("sftp://test@"+addr+filepath.ToSlash(dir), &SFTPConfig{Password: "wrong", InsecureIgnoreHostKey: true}, testLogger())
+	if err == nil {
+		fsys.Close()
+		t.Fatal("wrong password: no error")
+	}
+	if _, err := NewSFTPFS("sftp://test@"+addr+filepath.ToSlash(dir), &SFTPConfig{InsecureIgnoreHostKey: true}, testLogger()); err == nil {
+		t.Fatal("no credentials: no error")
+	}
+	// the host key is not in the known hosts file
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(knownHosts, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSFTPFS("sftp://test@"+addr+filepath.ToSlash(dir), &SFTPConfig{Password: testSFTPPassword, KnownHosts: knownHosts}, testLogger()); err == nil {
+		t.Fatal("unknown host key: no error")
+	}
+}
@@ -0,0 +1,224 @@
+package identifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+// DefaultSource is the source of records from databases without sources
+const DefaultSource = "default"
+
+// Source is a data root, which has been indexed into the database
+type Source struct {
+	ID       string `json:"id"`
+	Location string `json:"location,omitempty"`
+	Created  int64  `json:"created"`
+}
+
+// ValidSourceID checks, whether id can be used as part of database keys
+func ValidSourceID(id string) error {
+	if id == "" {
+		return errors.New("empty source id")
+	}
+	if strings.ContainsAny(id, ":/\\") {
+		return errors.Errorf("source id '%s' must not contain ':', '/' or '\\'", id)
+	}
+	return nil
+}
+
+// FileKey returns the database key of a file record
+func FileKey(source, path string) []byte {
+	return []byte("file:" + source + ":" + path)
+}
+
+func sourceKey(id string) []byte {
+	return []byte("source:" + id)
+}
+
+func getSource(txn Txn, id string) (*Source, error) {
+	value, err := getValue(txn, sourceKey(id))
+	if err != nil || value == nil {
+		return nil, err
+	}
+	source := &Source{}
+	if err := json.Unmarshal(value, source); err != nil {
+		return nil, errors.Wrapf(err, "cannot unmarshal 'source:%s'", id)
+	}
+	return source, nil
+}
+
+func setSource(txn Txn, source *Source) error {
+	data, err := json.Marshal(source)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal 'source:%s'", source.ID)
+	}
+	return errors.Wrapf(txn.Set(sourceKey(source.ID), data), "cannot write 'source:%s'", source.ID)
+}
+
+func loadSources(txn Txn) ([]*Source, error) {
+	var sources = []*Source{}
+	if err := txn.Iterate([]byte("source:"), func(key, value []byte) error {
+		source := &Source{}
+		if err := json.Unmarshal(value, source); err != nil {
+			return errors.Wrapf(err, "cannot unmarshal '%s'", key)
+		}
+		sources = append(sources, source)
+		return nil
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return sources, nil
+}
+
+// LoadSources returns all sources of the database
+func LoadSources(store Store) ([]*Source, error) {
+	var sources []*Source
+	if err := store.View(func(txn Txn) error {
+		var err error
+		sources, err = loadSources(txn)
+		return err
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return sources, nil
+}
+
+// StoreSource creates or updates the record of a source
+func StoreSource(store Store, source *Source) error {
+	if err := ValidSourceID(source.ID); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(store.Update(func(txn Txn) error {
+		return setSource(txn, source)
+	}))
+}
+
+// Sources returns all sources of the database
+func (r *StoreIterator) Sources() ([]*Source, error) {
+	return LoadSources(r.store)
+}
+
+// Source returns the source with the given id or nil, if it does not exist
+func (r *StoreIterator) Source(id string) (*Source, error) {
+	var source *Source
+	if err := r.store.View(func(txn Txn) error {
+		var err error
+		source, err = getSource(txn, id)
+		return err
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return source, nil
+}
+
+// IterateFiles calls do for all file records of a source with the given path prefix.
+// An empty source iterates over the records of all sources.
+func (r *StoreIterator) IterateFiles(source, prefix string, do func(fData *FileData) (remove bool, err error)) error {
+	if source != "" {
+		return r.IterateIndex(string(FileKey(source, prefix)), do)
+	}
+	return r.IterateIndex("file:", func(fData *FileData) (remove bool, err error) {
+		if !strings.HasPrefix(fData.Path, prefix) {
+			return false, nil
+		}
+		return do(fData)
+	})
+}
+
+// number of records per transaction of migrations
+const migrationBatch = 1000
+
+// maximum size of keys and values per transaction of migrations
+const migrationBatchBytes = 4 << 20
+
+// migrateSources assigns all records of an older database to the default source.
+// The source record is written last, an interrupted migration is continued by the next run:
+// records, which already belong to the default source, are skipped.
+func migrateSources(store Store, logger zLogger.ZLogger) error {
+	logger.Info().Msgf("assigning records to source '%s'", DefaultSource)
+	var count int64
+	// the checksum index is rebuilt with the secondary indexes
+	for _, prefix := range []string{"file:", "fixity:", "ai:"} {
+		// the keys are read first, records with new keys must not be part of the iteration
+		var keys = [][]byte{}
+		if err := store.View(func(txn Txn) error {
+			return txn.IterateKeys([]byte(prefix), func(key []byte) error {
+				keys = append(keys, bytes.Clone(key))
+				return nil
+			})
+		}); err != nil {
+			return errors.Wrapf(err, "cannot read keys with prefix '%s'", prefix)
+		}
+		maxBatch := migrationBatch
+		for len(keys) > 0 {
+			var done int
+			var migrated int64
+			err := store.Update(func(txn Txn) error {
+				done, migrated = 0, 0
+				var size int
+				for _, key := range keys[:min(maxBatch, len(keys))] {
+					if size >= migrationBatchBytes {
+						break
+					}
+					done++
+					value, err := getValue(txn, key)
+					if err != nil {
+						return err
+					}
+					rest := string(bytes.TrimPrefix(key, []byte(prefix)))
+					var newKey string
+					switch prefix {
+					case "file:":
+						fData := &FileData{}
+						if err := json.Unmarshal(value, fData); err != nil {
+							return errors.Wrapf(err, "cannot unmarshal '%s'", key)
+						}
+						// records of version 1 have no source
+						if fData.Source != "" {
+							continue
+						}
+						fData.Source = DefaultSource
+						if value, err = json.Marshal(fData); err != nil {
+							return errors.Wrapf(err, "cannot marshal '%s'", key)
+						}
+						newKey = string(FileKey(DefaultSource, rest))
+					default:
+						if strings.HasPrefix(rest, DefaultSource+":") {
+							continue
+						}
+						newKey = prefix + DefaultSource + ":" + rest
+					}
+					if err := txn.Delete(key); err != nil {
+						return errors.Wrapf(err, "cannot delete '%s'", key)
+					}
+					if err := txn.Set([]byte(newKey), value); err != nil {
+						return errors.Wrapf(err, "cannot write '%s'", newKey)
+					}
+					size += len(key) + len(newKey) + len(value)
+					migrated++
+				}
+				return nil
+			})
+			if errors.Is(err, ErrTxnTooBig) && maxBatch > 1 {
+				maxBatch /= 2
+				logger.Debug().Msgf("transaction too big - reducing batch to %d records", maxBatch)
+				continue
+			}
+			if err != nil {
+				return errors.Wrap(err, "cannot write migrated records")
+			}
+			keys = keys[done:]
+			count += migrated
+		}
+	}
+	if err := StoreSource(store, &Source{ID: DefaultSource, Created: time.Now().Unix()}); err != nil {
+		return errors.WithStack(err)
+	}
+	logger.Info().Msgf("%d records assigned to source '%s'", count, DefaultSource)
+	return nil
+}
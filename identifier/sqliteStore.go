@@ -0,0 +1,208 @@
+package identifier
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteSchema stores the records as json values with their keys.
+// The views expose the records for plain sql (i.e. "SELECT path, size FROM files WHERE mimetype = 'application/pdf'").
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS records (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+) WITHOUT ROWID;
+CREATE VIEW IF NOT EXISTS files AS SELECT
+	json_extract(value, '$.source')           AS source,
+	json_extract(value, '$.path')             AS path,
+	json_extract(value, '$.folder')           AS folder,
+	json_extract(value, '$.basename')         AS basename,
+	json_extract(value, '$.size')             AS size,
+	json_extract(value, '$.lastmod')          AS lastmod,
+	json_extract(value, '$.etag')             AS etag,
+	json_extract(value, '$.lastseen')         AS lastseen,
+	json_extract(value, '$.duplicate')        AS duplicate,
+	json_extract(value, '$.container')        AS container,
+	json_extract(value, '$.indexer.mimetype') AS mimetype,
+	json_extract(value, '$.indexer.pronom')   AS pronom,
+	json_extract(value, '$.indexer.type')     AS type,
+	json_extract(value, '$.indexer.subtype')  AS subtype,
+	json_extract(value, '$.indexer.checksum') AS checksum
+FROM records WHERE key >= 'file:' AND key < 'file;';
+CREATE VIEW IF NOT EXISTS checksums AS SELECT
+	files.source AS source,
+	files.path   AS path,
+	sums.key     AS digest,
+	sums.value   AS checksum
+FROM files, json_each(files.checksum) AS sums;
+CREATE VIEW IF NOT EXISTS sources AS SELECT
+	json_extract(value, '$.id')       AS id,
+	json_extract(value, '$.location') AS location,
+	json_extract(value, '$.created')  AS created
+FROM records WHERE key >= 'source:' AND key < 'source;';
+`
+
+// NewSQLiteStore opens the sqlite database file and creates it, if it does not exist
+func NewSQLiteStore(path string, readOnly bool, logger zLogger.ZLogger) (*SQLiteStore, error) {
+	// the path is part of an uri
+	name := "file:" + strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(path)
+	if readOnly {
+		if _, err := os.Stat(path); err != nil {
+			return nil, errors.Wrapf(err, "cannot open sqlite database '%s'", path)
+		}
+		name += "?mode=ro&_pragma=busy_timeout(10000)"
+		logger.Info().Msgf("open read only sqlite database '%s'", path)
+	} else {
+		// write transactions lock the database immediately, readers are not blocked in wal mode
+		name += "?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+		logger.Info().Msgf("open read write sqlite database '%s'", path)
+	}
+	db, err := sql.Open("sqlite", name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open sqlite database '%s'", path)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "cannot open sqlite database '%s'", path)
+	}
+	if !readOnly {
+		if _, err := db.Exec(sqliteSchema); err != nil {
+			db.Close()
+			return nil, errors.Wrapf(err, "cannot create schema in sqlite database '%s'", path)
+		}
+	}
+	return &SQLiteStore{db: db, readOnly: readOnly}, nil
+}
+
+type SQLiteStore struct {
+	db       *sql.DB
+	readOnly bool
+}
+
+func (s *SQLiteStore) run(readOnly bool, fn func(txn Txn) error) error {
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: readOnly})
+	if err != nil {
+		return sqliteError(errors.Wrap(err, "cannot begin transaction"))
+	}
+	if err := fn(&sqliteTxn{tx: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if readOnly {
+		return errors.WithStack(tx.Rollback())
+	}
+	return sqliteError(errors.Wrap(tx.Commit(), "cannot commit transaction"))
+}
+
+func (s *SQLiteStore) View(fn func(txn Txn) error) error {
+	return s.run(true, fn)
+}
+
+func (s *SQLiteStore) Update(fn func(txn Txn) error) error {
+	if s.readOnly {
+		return errors.New("cannot write to read only database")
+	}
+	return s.run(false, fn)
+}
+
+func (s *SQLiteStore) Close() error {
+	return errors.WithStack(s.db.Close())
+}
+
+// sqliteError converts busy databases to conflicts, which can be retried
+func sqliteError(err error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code()&0xff == sqlite3.SQLITE_BUSY {
+		return errors.WithStack(ErrConflict)
+	}
+	return err
+}
+
+type sqliteTxn struct {
+	tx *sql.Tx
+}
+
+func (t *sqliteTxn) Get(key []byte) ([]byte, error) {
+	var value []byte
+	if err := t.tx.QueryRow("SELECT value FROM records WHERE key = ?", string(key)).Scan(&value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, sqliteError(errors.WithStack(err))
+	}
+	return value, nil
+}
+
+func (t *sqliteTxn) Set(key, value []byte) error {
+	_, err := t.tx.Exec("INSERT INTO records (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value", string(key), string(value))
+	return sqliteError(errors.WithStack(err))
+}
+
+func (t *sqliteTxn) Delete(key []byte) error {
+	_, err := t.tx.Exec("DELETE FROM records WHERE key = ?", string(key))
+	return sqliteError(errors.WithStack(err))
+}
+
+// prefixEnd returns the first key after all keys with the prefix or nil, if there is none
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+func (t *sqliteTxn) query(columns string, prefix []byte) (*sql.Rows, error) {
+	if end := prefixEnd(prefix); end != nil {
+		return t.tx.Query("SELECT "+columns+" FROM records WHERE key >= ? AND key < ? ORDER BY key", string(prefix), string(end))
+	}
+	return t.tx.Query("SELECT "+columns+" FROM records WHERE key >= ? ORDER BY key", string(prefix))
+}
+
+func (t *sqliteTxn) Iterate(prefix []byte, do func(key, value []byte) error) error {
+	rows, err := t.query("key, value", prefix)
+	if err != nil {
+		return sqliteError(errors.Wrapf(err, "cannot query prefix '%s'", prefix))
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			return errors.Wrapf(err, "cannot read record of prefix '%s'", prefix)
+		}
+		if err := do(key, value); err != nil {
+			return err
+		}
+	}
+	return sqliteError(errors.WithStack(rows.Err()))
+}
+
+func (t *sqliteTxn) IterateKeys(prefix []byte, do func(key []byte) error) error {
+	rows, err := t.query("key", prefix)
+	if err != nil {
+		return sqliteError(errors.Wrapf(err, "cannot query prefix '%s'", prefix))
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key []byte
+		if err := rows.Scan(&key); err != nil {
+			return errors.Wrapf(err, "cannot read key of prefix '%s'", prefix)
+		}
+		if err := do(key); err != nil {
+			return err
+		}
+	}
+	return sqliteError(errors.WithStack(rows.Err()))
+}
+
+var _ Store = (*SQLiteStore)(nil)
@@ -0,0 +1,101 @@
+package identifier
+
+import (
+	"runtime"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+// ErrKeyNotFound is returned by Txn.Get for missing keys
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrConflict is returned by Store.Update, if the transaction conflicts with a concurrent transaction
+var ErrConflict = errors.New("transaction conflict")
+
+// ErrTxnTooBig is returned by Store.Update, if the transaction exceeds the size limit of the database
+var ErrTxnTooBig = errors.New("transaction too big")
+
+// Store is the ordered key value store of the index database.
+// File records are stored as "file:<source>:<path>", secondary keys (i.e. "sum:...") refer to them.
+type Store interface {
+	// View runs fn in a read only transaction
+	View(fn func(txn Txn) error) error
+	// Update runs fn in a read write transaction, which is committed if fn returns nil
+	Update(fn func(txn Txn) error) error
+	Close() error
+}
+
+// Txn is a transaction of a Store
+type Txn interface {
+	// Get returns the value of key or ErrKeyNotFound
+	Get(key []byte) ([]byte, error)
+	Set(key, value []byte) error
+	Delete(key []byte) error
+	// Iterate calls do for all records with the key prefix in key order. The value is only valid within do.
+	Iterate(prefix []byte, do func(key, value []byte) error) error
+	// IterateKeys calls do for all keys with the prefix without reading the values (i.e. for lookups of secondary keys)
+	IterateKeys(prefix []byte, do func(key []byte) error) error
+}
+
+// sqliteScheme is the prefix of database locations, which are sqlite files
+const sqliteScheme = "sqlite://"
+
+// IsSQLiteLocation checks, whether location addresses an sqlite database file
+func IsSQLiteLocation(location string) bool {
+	return strings.HasPrefix(location, sqliteScheme)
+}
+
+// openStore opens the database at location without migration
+func openStore(location string, readOnly bool, logger zLogger.ZLogger) (Store, error) {
+	if IsSQLiteLocation(location) {
+		return NewSQLiteStore(strings.TrimPrefix(location, sqliteScheme), readOnly, logger)
+	}
+	return NewBadgerStore(location, readOnly, logger)
+}
+
+// OpenStore opens the database and checks its schema version (see CheckSchema).
+// "sqlite:///path/to/index.db" opens an sqlite database file, all other locations are badger database folders.
+func OpenStore(location string, readOnly bool, logger zLogger.ZLogger) (Store, error) {
+	if runtime.GOOS == "windows" {
+		readOnly = false
+	}
+	store, err := openStore(location, readOnly, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckSchema(store, readOnly); err != nil {
+		store.Close()
+		return nil, errors.Wrapf(err, "cannot use database '%s'", location)
+	}
+	return store, nil
+}
+
+// errStopIteration ends an iteration early
+var errStopIteration = errors.New("stop iteration")
+
+// hasPrefix checks, whether there is at least one key with the prefix
+func hasPrefix(txn Txn, prefix []byte) (bool, error) {
+	var found bool
+	err := txn.IterateKeys(prefix, func(key []byte) error {
+		found = true
+		return errStopIteration
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return false, err
+	}
+	return found, nil
+}
+
+// getValue returns the value of key or nil, if it does not exist
+func getValue(txn Txn, key []byte) ([]byte, error) {
+	value, err := txn.Get(key)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "cannot read '%s'", key)
+	}
+	return value, nil
+}
@@ -0,0 +1,194 @@
+package identifier
+
+import (
+	"encoding/json"
+	"runtime"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/checksum"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"golang.org/x/exp/slices"
+)
+
+// key of the list of digest algorithms used in the database
+const digestsKey = "meta:digests"
+
+func loadDigests(txn Txn) ([]checksum.DigestAlgorithm, error) {
+	var digests = []checksum.DigestAlgorithm{}
+	value, err := getValue(txn, []byte(digestsKey))
+	if err != nil || value == nil {
+		return digests, err
+	}
+	if err := json.Unmarshal(value, &digests); err != nil {
+		return nil, errors.Wrapf(err, "cannot unmarshal '%s'", digestsKey)
+	}
+	return digests, nil
+}
+
+// AddDigests adds digest algorithms to the list of algorithms used in the database
+func AddDigests(store Store, digests []checksum.DigestAlgorithm) error {
+	return errors.WithStack(store.Update(func(txn Txn) error {
+		stored, err := loadDigests(txn)
+		if err != nil {
+			return err
+		}
+		for _, digest := range digests {
+			if !slices.Contains(stored, digest) {
+				stored = append(stored, digest)
+			}
+		}
+		data, err := json.Marshal(stored)
+		if err != nil {
+			return errors.Wrapf(err, "cannot marshal '%s'", digestsKey)
+		}
+		return errors.Wrapf(txn.Set([]byte(digestsKey), data), "cannot write '%s'", digestsKey)
+	}))
+}
+
+// NewStoreIterator opens the database at location (see OpenStore)
+func NewStoreIterator(location string, readOnly bool, logger zLogger.ZLogger) (*StoreIterator, error) {
+	if runtime.GOOS == "windows" {
+		readOnly = false
+	}
+	var err error
+	reader := &StoreIterator{readOnly: readOnly, logger: logger}
+	if location != "" {
+		if readOnly {
+			logger.Info().Msgf("open read only database '%s'", location)
+		} else {
+			logger.Info().Msgf("open read write database '%s'", location)
+		}
+		if reader.store, err = OpenStore(location, readOnly, logger); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return reader, nil
+}
+
+type StoreIterator struct {
+	store    Store
+	readOnly bool
+	logger   zLogger.ZLogger
+}
+
+// Store returns the database of the iterator
+func (r *StoreIterator) Store() Store {
+	return r.store
+}
+
+func (r *StoreIterator) Close() error {
+	if r.store != nil {
+		return errors.WithStack(r.store.Close())
+	}
+	return nil
+}
+
+// Digests returns the digest algorithms used in the database
+func (r *StoreIterator) Digests() ([]checksum.DigestAlgorithm, error) {
+	return LoadDigests(r.store)
+}
+
+// LoadDigests returns the digest algorithms used in the database
+func LoadDigests(store Store) ([]checksum.DigestAlgorithm, error) {
+	var digests []checksum.DigestAlgorithm
+	if err := store.View(func(txn Txn) error {
+		var err error
+		digests, err = loadDigests(txn)
+		return err
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(digests) == 0 {
+		// databases of older versions contain sha512 only
+		digests = []checksum.DigestAlgorithm{checksum.DigestSHA512}
+	}
+	return digests, nil
+}
+
+func (r *StoreIterator) IterateAI(prefix string, do func(key string, fData *AIResultStruct) (remove bool, err error)) error {
+	if err := r.Iterate(prefix, func(key, value []byte) (remove bool, err error) {
+		fData := &AIResultStruct{}
+		if err := json.Unmarshal(value, fData); err != nil {
+			return false, errors.Wrapf(err, "cannot unmarshal data for key '%s': %s", string(key), string(value))
+		}
+		remove, err = do(string(key), fData)
+		if err != nil {
+			return false, errors.Wrapf(err, "cannot iterate data for key '%s': %s", string(key), string(value))
+		}
+		return remove, nil
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (r *StoreIterator) IterateIndex(prefix string, do func(fData *FileData) (remove bool, err error)) error {
+	var removeFiles = []*FileData{}
+	if err := r.Iterate(prefix, func(key, value []byte) (remove bool, err error) {
+		fData := &FileData{}
+		if err := json.Unmarshal(value, fData); err != nil {
+			return false, errors.Wrapf(err, "cannot unmarshal data for key '%s': %s", string(key), string(value))
+		}
+		remove, err = do(fData)
+		if err != nil {
+			return false, errors.Wrapf(err, "cannot iterate data for key '%s': %s", string(key), string(value))
+		}
+		if remove {
+			// file records are removed together with their checksum index entries
+			removeFiles = append(removeFiles, &FileData{Source: fData.Source, Path: fData.Path})
+		}
+		return false, nil
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	if !r.readOnly && len(removeFiles) > 0 {
+		r.logger.Info().Msgf("removing %d file records", len(removeFiles))
+		for _, fData := range removeFiles {
+			if err := r.RemoveFileData(fData.Source, fData.Path); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
+
+// number of removed keys per transaction
+const removeBatch = 100
+
+func (r *StoreIterator) Iterate(prefix string, do func(key, value []byte) (remove bool, err error)) error {
+	var removeKeys = [][]byte{}
+	if err := r.store.View(func(txn Txn) error {
+		return txn.Iterate([]byte(prefix), func(key, value []byte) error {
+			remove, err := do(key, value)
+			if err != nil {
+				return err
+			}
+			if remove {
+				removeKeys = append(removeKeys, key)
+			}
+			return nil
+		})
+	}); err != nil {
+		return errors.Wrapf(err, "cannot iterate over database with prefix '%s'", prefix)
+	}
+	if !r.readOnly && len(removeKeys) > 0 {
+		r.logger.Info().Msgf("removing %d keys", len(removeKeys))
+		for start := 0; start < len(removeKeys); start += removeBatch {
+			batch := removeKeys[start:min(start+removeBatch, len(removeKeys))]
+			if err := r.store.Update(func(txn Txn) error {
+				for _, k := range batch {
+					r.logger.Info().Msgf("removing key '%s'", k)
+					if err := txn.Delete(k); err != nil {
+						r.logger.Error().Err(err).Msgf("cannot remove key '%s'", k)
+					}
+				}
+				return nil
+			}); err != nil {
+				r.logger.Error().Err(err).Msgf("cannot commit transaction")
+				return errors.Wrapf(err, "cannot commit transaction")
+			}
+			r.logger.Info().Msgf("committed %d removed keys", start+len(batch))
+		}
+	}
+	return nil
+}
@@ -7,14 +7,19 @@ import (
 )
 
 type FileData struct {
+	Source    string            `json:"source,omitempty"`
 	Path      string            `json:"path,omitempty"`
 	Folder    string            `json:"folder,omitempty"`
 	Basename  string            `json:"basename,omitempty"`
 	Size      int64             `json:"size,omitempty"`
 	Duplicate bool              `json:"duplicate,omitempty"`
 	LastMod   int64             `json:"lastmod,omitempty"`
+	ETag      string            `json:"etag,omitempty"`
 	Indexer   *indexer.ResultV2 `json:"indexer,omitempty"`
 	LastSeen  int64             `json:"lastseen,omitempty"`
+	Container string            `json:"container,omitempty"`
+	Fixity    *FixityEvent      `json:"fixity,omitempty"`
+	Link      *LinkInfo         `json:"link,omitempty"`
 }
 
 type AIPerson struct {
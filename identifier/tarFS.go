@@ -0,0 +1,175 @@
+package identifier
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type tarEntry struct {
+	name     string
+	info     fs.FileInfo
+	offset   int64
+	size     int64
+	children []string
+}
+
+// newTarFS reads all headers of a tar archive and provides random access to its files
+func newTarFS(ra io.ReaderAt, size int64) (*tarFS, error) {
+	tfs := &tarFS{
+		ra: ra,
+		entries: map[string]*tarEntry{
+			".": {name: ".", info: &tarDirInfo{name: "."}},
+		},
+	}
+	counter := &countingReader{r: io.NewSectionReader(ra, 0, size)}
+	tr := tar.NewReader(counter)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "cannot read tar header")
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if name == "." || !fs.ValidPath(name) {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			tfs.addDir(name, hdr.FileInfo())
+		case tar.TypeReg:
+			tfs.addDir(path.Dir(name), nil)
+			tfs.entries[name] = &tarEntry{name: name, info: hdr.FileInfo(), offset: counter.n, size: hdr.Size}
+			tfs.addChild(name)
+		}
+	}
+	return tfs, nil
+}
+
+type tarFS struct {
+	ra      io.ReaderAt
+	entries map[string]*tarEntry
+}
+
+func (t *tarFS) addDir(name string, info fs.FileInfo) {
+	if entry, ok := t.entries[name]; ok {
+		if info != nil {
+			entry.info = info
+		}
+		return
+	}
+	if info == nil {
+		info = &tarDirInfo{name: path.Base(name)}
+	}
+	t.entries[name] = &tarEntry{name: name, info: info}
+	if name != "." {
+		t.addDir(path.Dir(name), nil)
+		t.addChild(name)
+	}
+}
+
+func (t *tarFS) addChild(name string) {
+	parent := t.entries[path.Dir(name)]
+	if !slices.Contains(parent.children, name) {
+		parent.children = append(parent.children, name)
+	}
+}
+
+func (t *tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := t.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if entry.info.IsDir() {
+		return &tarDir{fsys: t, entry: entry}, nil
+	}
+	return &tarFile{SectionReader: io.NewSectionReader(t.ra, entry.offset, entry.size), entry: entry}, nil
+}
+
+func (t *tarFS) Stat(name string) (fs.FileInfo, error) {
+	entry, ok := t.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return entry.info, nil
+}
+
+type tarFile struct {
+	*io.SectionReader
+	entry *tarEntry
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) {
+	return f.entry.info, nil
+}
+
+func (f *tarFile) Close() error {
+	return nil
+}
+
+type tarDir struct {
+	fsys   *tarFS
+	entry  *tarEntry
+	offset int
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) {
+	return d.entry.info, nil
+}
+
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: errors.New("is a directory")}
+}
+
+func (d *tarDir) Close() error {
+	return nil
+}
+
+func (d *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	children := d.entry.children[d.offset:]
+	if n > 0 && len(children) > n {
+		children = children[:n]
+	}
+	if n > 0 && len(children) == 0 {
+		return nil, io.EOF
+	}
+	var result = make([]fs.DirEntry, 0, len(children))
+	for _, child := range children {
+		result = append(result, fs.FileInfoToDirEntry(d.fsys.entries[child].info))
+	}
+	d.offset += len(children)
+	return result, nil
+}
+
+type tarDirInfo struct {
+	name string
+}
+
+func (i *tarDirInfo) Name() string       { return i.name }
+func (i *tarDirInfo) Size() int64        { return 0 }
+func (i *tarDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (i *tarDirInfo) ModTime() time.Time { return time.Time{} }
+func (i *tarDirInfo) IsDir() bool        { return true }
+func (i *tarDirInfo) Sys() any           { return nil }
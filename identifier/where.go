@@ -0,0 +1,571 @@
+package identifier
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"emperror.dev/errors"
+	human "github.com/dustin/go-humanize"
+	"golang.org/x/exp/slices"
+)
+
+type whereKind int
+
+const (
+	whereAny whereKind = iota
+	whereString
+	whereNumber
+	whereBool
+)
+
+// whereField reads a field of a file record, nil stands for a missing value
+type whereField struct {
+	kind whereKind
+	get  func(fData *FileData) any
+}
+
+func indexerField(get func(fData *FileData) any) func(fData *FileData) any {
+	return func(fData *FileData) any {
+		if fData.Indexer == nil {
+			return nil
+		}
+		return get(fData)
+	}
+}
+
+var whereFields = map[string]whereField{
+	"source":    {whereString, func(fData *FileData) any { return fData.Source }},
+	"path":      {whereString, func(fData *FileData) any { return fData.Path }},
+	"folder":    {whereString, func(fData *FileData) any { return fData.Folder }},
+	"basename":  {whereString, func(fData *FileData) any { return fData.Basename }},
+	"container": {whereString, func(fData *FileData) any { return fData.Container }},
+	"etag":      {whereString, func(fData *FileData) any { return fData.ETag }},
+	"size":      {whereNumber, func(fData *FileData) any { return float64(fData.Size) }},
+	"lastmod":   {whereNumber, func(fData *FileData) any { return float64(fData.LastMod) }},
+	"lastseen":  {whereNumber, func(fData *FileData) any { return float64(fData.LastSeen) }},
+	"duplicate": {whereBool, func(fData *FileData) any { return fData.Duplicate }},
+	"fixity": {whereString, func(fData *FileData) any {
+		if fData.Fixity == nil {
+			return nil
+		}
+		return fData.Fixity.Outcome
+	}},
+	"mimetype": {whereString, indexerField(func(fData *FileData) any { return fData.Indexer.Mimetype })},
+	"pronom":   {whereString, indexerField(func(fData *FileData) any { return fData.Indexer.Pronom })},
+	"type":     {whereString, indexerField(func(fData *FileData) any { return fData.Indexer.Type })},
+	"subtype":  {whereString, indexerField(func(fData *FileData) any { return fData.Indexer.Subtype })},
+	"width":    {whereNumber, indexerField(func(fData *FileData) any { return float64(fData.Indexer.Width) })},
+	"height":   {whereNumber, indexerField(func(fData *FileData) any { return float64(fData.Indexer.Height) })},
+	"duration": {whereNumber, indexerField(func(fData *FileData) any { return float64(fData.Indexer.Duration) })},
+}
+
+// lookupWhereField returns the field with the name, including checksum.<digest> and metadata.<path>
+func lookupWhereField(name string) (whereField, bool) {
+	if field, ok := whereFields[name]; ok {
+		return field, true
+	}
+	if digest, ok := strings.CutPrefix(name, "checksum."); ok && digest != "" {
+		return whereField{whereString, indexerField(func(fData *FileData) any {
+			if sum, ok := fData.Indexer.Checksum[digest]; ok {
+				return sum
+			}
+			return nil
+		})}, true
+	}
+	if metaPath, ok := strings.CutPrefix(name, "metadata."); ok && metaPath != "" {
+		parts := strings.Split(metaPath, ".")
+		return whereField{whereAny, indexerField(func(fData *FileData) any {
+			var value any = fData.Indexer.Metadata
+			for _, part := range parts {
+				switch v := value.(type) {
+				case map[string]any:
+					value = v[part]
+				case []any:
+					i, err := strconv.Atoi(part)
+					if err != nil || i < 0 || i >= len(v) {
+						return nil
+					}
+					value = v[i]
+				default:
+					return nil
+				}
+			}
+			return whereValue(value)
+		})}, true
+	}
+	return whereField{}, false
+}
+
+// whereValue converts metadata values to the value types of the expressions
+func whereValue(value any) any {
+	switch v := value.(type) {
+	case string, float64, bool:
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case nil:
+		return nil
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Where is a parsed filter expression for file records
+type Where struct {
+	expr   string
+	root   whereNode
+	fields []string
+}
+
+// ParseWhere parses a filter expression, i.e. `size > 10MB && pronom in ("fmt/43","fmt/44") && path ~ "^payload/"`. An empty expression matches all files.
+func ParseWhere(expr string) (*Where, error) {
+	where := &Where{expr: expr}
+	if strings.TrimSpace(expr) == "" {
+		return where, nil
+	}
+	tokens, err := whereTokens(expr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid expression '%s'", expr)
+	}
+	p := &whereParser{tokens: tokens}
+	if where.root, err = p.or(); err != nil {
+		return nil, errors.Wrapf(err, "invalid expression '%s'", expr)
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, errors.Errorf("invalid expression '%s': unexpected '%s' at position %d", expr, tok.text, tok.pos)
+	}
+	where.fields = p.fields
+	return where, nil
+}
+
+// Match checks, whether the file record matches the expression
+func (w *Where) Match(fData *FileData) bool {
+	if w == nil || w.root == nil {
+		return true
+	}
+	return w.root.eval(fData)
+}
+
+// Uses checks, whether the expression references the field
+func (w *Where) Uses(field string) bool {
+	return w != nil && slices.Contains(w.fields, field)
+}
+
+// Empty checks, whether the expression matches all files
+func (w *Where) Empty() bool {
+	return w == nil || w.root == nil
+}
+
+func (w *Where) String() string {
+	if w == nil {
+		return ""
+	}
+	return w.expr
+}
+
+type whereNode interface {
+	eval(fData *FileData) bool
+}
+
+type whereAnd struct{ left, right whereNode }
+
+func (n *whereAnd) eval(fData *FileData) bool { return n.left.eval(fData) && n.right.eval(fData) }
+
+type whereOr struct{ left, right whereNode }
+
+func (n *whereOr) eval(fData *FileData) bool { return n.left.eval(fData) || n.right.eval(fData) }
+
+type whereNot struct{ node whereNode }
+
+func (n *whereNot) eval(fData *FileData) bool { return !n.node.eval(fData) }
+
+// whereTruth is a field without operator (i.e. "duplicate")
+type whereTruth struct{ field whereField }
+
+func (n *whereTruth) eval(fData *FileData) bool {
+	switch v := n.field.get(fData).(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	}
+	return false
+}
+
+type whereCompare struct {
+	field  whereField
+	op     string
+	values []any
+	regex  *regexp.Regexp
+}
+
+func (n *whereCompare) eval(fData *FileData) bool {
+	value := n.field.get(fData)
+	switch n.op {
+	case "~", "!~":
+		if value == nil {
+			return n.op == "!~"
+		}
+		return n.regex.MatchString(fmt.Sprint(value)) == (n.op == "~")
+	case "in":
+		for _, v := range n.values {
+			if cmp, ok := whereCmp(value, v); ok && cmp == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	cmp, ok := whereCmp(value, n.values[0])
+	if !ok {
+		return n.op == "!="
+	}
+	switch n.op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// whereCmp compares a field value with a literal. Values of different types are not comparable.
+func whereCmp(value, literal any) (int, bool) {
+	switch l := literal.(type) {
+	case float64:
+		v, ok := value.(float64)
+		if !ok {
+			s, isString := value.(string)
+			if !isString {
+				return 0, false
+			}
+			// numbers in metadata are often strings
+			var err error
+			if v, err = strconv.ParseFloat(s, 64); err != nil {
+				return 0, false
+			}
+		}
+		switch {
+		case v < l:
+			return -1, true
+		case v > l:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		v, ok := value.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(v, l), true
+	case bool:
+		v, ok := value.(bool)
+		if !ok {
+			return 0, false
+		}
+		if v == l {
+			return 0, true
+		}
+		if !v {
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+type whereTokenKind int
+
+const (
+	tokEOF whereTokenKind = iota
+	tokIdent
+	tokString
+	tokLiteral
+	tokOp
+)
+
+type whereToken struct {
+	kind whereTokenKind
+	text string
+	pos  int
+}
+
+var whereOps = []string{"&&", "||", "==", "!=", "<=", ">=", "!~", "<", ">", "~", "!", "=", "(", ")", ","}
+
+func whereTokens(expr string) ([]whereToken, error) {
+	var tokens = []whereToken{}
+	runes := []rune(expr)
+	isIdent := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-'
+	}
+	isLiteral := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(".:+-_", r)
+	}
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			end := i + 1
+			for ; end < len(runes) && runes[end] != r; end++ {
+				if runes[end] == '\\' && r == '"' {
+					end++
+				}
+			}
+			if end >= len(runes) {
+				return nil, errors.Errorf("unterminated string at position %d", i)
+			}
+			text := string(runes[i+1 : end])
+			if r == '"' {
+				var err error
+				if text, err = strconv.Unquote(string(runes[i : end+1])); err != nil {
+					return nil, errors.Wrapf(err, "invalid string at position %d", i)
+				}
+			}
+			tokens = append(tokens, whereToken{kind: tokString, text: text, pos: i})
+			i = end + 1
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			end := i + 1
+			for end < len(runes) && isLiteral(runes[end]) {
+				end++
+			}
+			tokens = append(tokens, whereToken{kind: tokLiteral, text: string(runes[i:end]), pos: i})
+			i = end
+		case unicode.IsLetter(r) || r == '_':
+			end := i + 1
+			for end < len(runes) && isIdent(runes[end]) {
+				end++
+			}
+			tokens = append(tokens, whereToken{kind: tokIdent, text: string(runes[i:end]), pos: i})
+			i = end
+		default:
+			var found bool
+			for _, op := range whereOps {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, whereToken{kind: tokOp, text: op, pos: i})
+					i += len([]rune(op))
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, errors.Errorf("unexpected '%c' at position %d", r, i)
+			}
+		}
+	}
+	return append(tokens, whereToken{kind: tokEOF, pos: len(runes)}), nil
+}
+
+type whereParser struct {
+	tokens []whereToken
+	pos    int
+	// names of the referenced fields
+	fields []string
+}
+
+func (p *whereParser) peek() whereToken {
+	return p.tokens[p.pos]
+}
+
+func (p *whereParser) next() whereToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *whereParser) isOp(ops ...string) bool {
+	tok := p.peek()
+	return tok.kind == tokOp && slices.Contains(ops, tok.text)
+}
+
+func (p *whereParser) expect(op string) error {
+	if tok := p.next(); tok.kind != tokOp || tok.text != op {
+		return errors.Errorf("expected '%s' at position %d", op, tok.pos)
+	}
+	return nil
+}
+
+func (p *whereParser) or() (whereNode, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &whereOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *whereParser) and() (whereNode, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		p.next()
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = &whereAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *whereParser) not() (whereNode, error) {
+	if p.isOp("!") {
+		p.next()
+		node, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &whereNot{node: node}, nil
+	}
+	return p.compare()
+}
+
+func (p *whereParser) compare() (whereNode, error) {
+	if p.isOp("(") {
+		p.next()
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")")
+	}
+	tok := p.next()
+	if tok.kind != tokIdent {
+		return nil, errors.Errorf("expected field at position %d", tok.pos)
+	}
+	field, ok := lookupWhereField(tok.text)
+	if !ok {
+		return nil, errors.Errorf("unknown field '%s' at position %d", tok.text, tok.pos)
+	}
+	p.fields = append(p.fields, tok.text)
+	opTok := p.peek()
+	switch {
+	case opTok.kind == tokIdent && opTok.text == "in":
+		p.next()
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		node := &whereCompare{field: field, op: "in"}
+		for {
+			value, err := p.value(field)
+			if err != nil {
+				return nil, err
+			}
+			node.values = append(node.values, value)
+			if !p.isOp(",") {
+				break
+			}
+			p.next()
+		}
+		return node, p.expect(")")
+	case p.isOp("~", "!~"):
+		p.next()
+		valTok := p.next()
+		if valTok.kind != tokString {
+			return nil, errors.Errorf("expected regular expression string at position %d", valTok.pos)
+		}
+		regex, err := regexp.Compile(valTok.text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid regular expression at position %d", valTok.pos)
+		}
+		return &whereCompare{field: field, op: opTok.text, regex: regex}, nil
+	case p.isOp("==", "=", "!=", "<", "<=", ">", ">="):
+		p.next()
+		value, err := p.value(field)
+		if err != nil {
+			return nil, err
+		}
+		op := opTok.text
+		if op == "=" {
+			op = "=="
+		}
+		return &whereCompare{field: field, op: op, values: []any{value}}, nil
+	}
+	return &whereTruth{field: field}, nil
+}
+
+// dates are compared with unix timestamps
+var whereDateRegexp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+
+// value parses a literal, which must fit to the type of the field
+func (p *whereParser) value(field whereField) (any, error) {
+	tok := p.next()
+	var value any
+	switch tok.kind {
+	case tokString:
+		value = tok.text
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		default:
+			return nil, errors.Errorf("unexpected '%s' at position %d - strings must be quoted", tok.text, tok.pos)
+		}
+	case tokLiteral:
+		if whereDateRegexp.MatchString(tok.text) {
+			t, err := time.ParseInLocation("2006-01-02", tok.text, time.Local)
+			if err != nil {
+				if t, err = time.Parse(time.RFC3339, tok.text); err != nil {
+					return nil, errors.Errorf("invalid date '%s' at position %d", tok.text, tok.pos)
+				}
+			}
+			value = float64(t.Unix())
+		} else if f, err := strconv.ParseFloat(tok.text, 64); err == nil {
+			value = f
+		} else if size, err := human.ParseBytes(tok.text); err == nil {
+			value = float64(size)
+		} else {
+			return nil, errors.Errorf("invalid number '%s' at position %d", tok.text, tok.pos)
+		}
+	default:
+		return nil, errors.Errorf("expected value at position %d", tok.pos)
+	}
+	var ok bool
+	switch field.kind {
+	case whereString:
+		_, ok = value.(string)
+	case whereNumber:
+		_, ok = value.(float64)
+	case whereBool:
+		_, ok = value.(bool)
+	default:
+		ok = true
+	}
+	if !ok {
+		return nil, errors.Errorf("value at position %d does not match the type of the field", tok.pos)
+	}
+	return value, nil
+}
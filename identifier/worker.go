@@ -1,7 +1,7 @@
 package identifier
 
 import (
-	"encoding/csv"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,106 +15,68 @@ import (
 	"time"
 
 	"emperror.dev/errors"
-	"github.com/dgraph-io/badger/v4"
 	human "github.com/dustin/go-humanize"
 	"github.com/je4/utils/v2/pkg/checksum"
 	"github.com/je4/utils/v2/pkg/zLogger"
 	"github.com/ocfl-archive/indexer/v3/pkg/util"
-	"github.com/tealeg/xlsx/v3"
+	"github.com/rs/zerolog"
 	"golang.org/x/exp/slices"
 )
 
-var serialWriterLock sync.Mutex
-
-func JsonlWriteLine(w io.Writer, fData *FileData) error {
-	d, err := json.Marshal(fData)
-	if err != nil {
-		return errors.Wrapf(err, "cannot marshal data")
-	}
-	serialWriterLock.Lock()
-	defer serialWriterLock.Unlock()
-	if _, err := w.Write(append(d, []byte("\n")...)); err != nil {
-		return errors.Wrapf(err, "cannot write to output")
+// FileFields returns the names of the fields of FileRecord
+func FileFields(digests []checksum.DigestAlgorithm) []string {
+	var result = []string{"path", "folder", "basename", "size", "lastmod", "duplicate", "mimetype", "pronom", "type", "subtype"}
+	for _, digest := range digests {
+		result = append(result, string(digest))
 	}
-	return nil
+	return append(result, "width", "height", "duration")
 }
 
-var xlsxWriterLock sync.Mutex
-
-func XlsxWriteLine(sheet *xlsx.Sheet, fData *FileData) error {
-	csvWriterlock.Lock()
-	defer csvWriterlock.Unlock()
-	dupStr := "no"
-	if fData.Duplicate {
-		dupStr = "yes"
-	}
-	row := sheet.AddRow()
-	cell := row.AddCell()
-	cell.SetString(fData.Path)
-	cell = row.AddCell()
-	cell.SetString(fData.Folder)
-	cell = row.AddCell()
-	cell.SetString(fData.Basename)
-	cell = row.AddCell()
-	cell.SetInt64(int64(fData.Indexer.Size))
-	cell = row.AddCell()
-	cell.SetDateTime(time.Unix(fData.LastMod, 0))
-	cell = row.AddCell()
-	cell.SetString(dupStr)
-	cell = row.AddCell()
-	cell.SetString(fData.Indexer.Mimetype)
-	cell = row.AddCell()
-	cell.SetString(fData.Indexer.Pronom)
-	cell = row.AddCell()
-	cell.SetString(fData.Indexer.Type)
-	cell = row.AddCell()
-	cell.SetString(fData.Indexer.Subtype)
-	cell = row.AddCell()
-	cell.SetString(fData.Indexer.Checksum[string(checksum.DigestSHA512)])
-	cell = row.AddCell()
-	cell.SetInt64(int64(fData.Indexer.Width))
-	cell = row.AddCell()
-	cell.SetInt64(int64(fData.Indexer.Height))
-	cell = row.AddCell()
-	cell.SetInt64(int64(fData.Indexer.Duration))
-	return nil
+// FileFieldTypes are the types of the fields of FileRecord
+var FileFieldTypes = FieldTypes{
+	"size":      FieldInt,
+	"lastmod":   FieldTime,
+	"duplicate": FieldBool,
+	"width":     FieldInt,
+	"height":    FieldInt,
+	"duration":  FieldInt,
 }
 
-var csvWriterlock sync.Mutex
-
-func CsvWriteLine(csvWriter *csv.Writer, fData *FileData) error {
-	dupStr := "no"
-	if fData.Duplicate {
-		dupStr = "yes"
+// FileRecord returns the values of the fields of a file record for Output.Write
+func FileRecord(fData *FileData, digests []checksum.DigestAlgorithm) []any {
+	record := []any{
+		fData.Path,
+		fData.Folder,
+		fData.Basename,
+		fData.Size,
+		fData.LastMod,
+		fData.Duplicate,
+		fData.Indexer.Mimetype,
+		fData.Indexer.Pronom,
+		fData.Indexer.Type,
+		fData.Indexer.Subtype,
 	}
-	csvWriterlock.Lock()
-	defer csvWriterlock.Unlock()
-	return errors.WithStack(csvWriter.Write(
-		[]string{
-			fData.Path,
-			fData.Folder,
-			fData.Basename,
-			fmt.Sprintf("%v", fData.Indexer.Size),
-			time.Unix(fData.LastMod, 0).Format(time.RFC3339),
-			dupStr,
-			fData.Indexer.Mimetype,
-			fData.Indexer.Pronom,
-			fData.Indexer.Type,
-			fData.Indexer.Subtype,
-			fData.Indexer.Checksum[string(checksum.DigestSHA512)],
-			fmt.Sprintf("%v", fData.Indexer.Width),
-			fmt.Sprintf("%v", fData.Indexer.Height),
-			fmt.Sprintf("%v", fData.Indexer.Duration),
-		}))
+	for _, digest := range digests {
+		record = append(record, fData.Indexer.Checksum[string(digest)])
+	}
+	return append(record,
+		fData.Indexer.Width,
+		fData.Indexer.Height,
+		fData.Indexer.Duration,
+	)
 }
 
-func WriteLogger(logger zLogger.ZLogger, fData *FileData, id uint, basePath string, cached bool) {
+func WriteLogger(logger zLogger.ZLogger, fData *FileData, id uint, basePath string, cached bool, digests []checksum.DigestAlgorithm) {
+	checksums := zerolog.Dict()
+	for _, digest := range digests {
+		checksums.Str(string(digest), fData.Indexer.Checksum[string(digest)])
+	}
 	logger.Info().
 		Bool("cached", cached).
 		Str("path", fData.Path).
 		Str("mimetype", fData.Indexer.Mimetype).
 		Str("pronom", fData.Indexer.Pronom).
-		Str("checksum", fData.Indexer.Checksum[string(checksum.DigestSHA512)]).
+		Dict("checksum", checksums).
 		Int64("size", fData.Size).
 		Str("size_human", human.Bytes(uint64(fData.Size))). // human-readable size
 		Time("lastmod", time.Unix(fData.LastMod, 0)).
@@ -126,14 +88,23 @@ func WriteLogger(logger zLogger.ZLogger, fData *FileData, id uint, basePath stri
 	}
 	basePath = strings.TrimSuffix(basePath, "/")
 	p := path.Join(basePath, fData.Path)
-	logger.Debug().Msgf("#%03d:%s %s\n           [%s] - %s\n", id, cachedStr, p, fData.Indexer.Mimetype, fData.Indexer.Checksum[string(checksum.DigestSHA512)])
+	logger.Debug().Msgf("#%03d:%s %s\n           [%s] - %s\n", id, cachedStr, p, fData.Indexer.Mimetype, checksumString(fData, digests))
 	if fData.Indexer.Type == "image" && fData.Indexer.Width > 0 {
 		logger.Debug().Msgf("#           image: %vx%v\n", fData.Indexer.Width, fData.Indexer.Height)
 	}
 }
 
-func WriteConsole(logger zLogger.ZLogger, fData *FileData) {
-	fmt.Printf("'%s' - %s\n           [%s - %s] %s\n", fData.Path, fData.Indexer.Checksum[string(checksum.DigestSHA512)], fData.Indexer.Pronom, fData.Indexer.Mimetype, human.Bytes(uint64(fData.Size)))
+// checksumString returns the checksums of a file as "alg:checksum" list
+func checksumString(fData *FileData, digests []checksum.DigestAlgorithm) string {
+	var checksums = []string{}
+	for _, digest := range digests {
+		checksums = append(checksums, fmt.Sprintf("%s:%s", digest, fData.Indexer.Checksum[string(digest)]))
+	}
+	return strings.Join(checksums, " ")
+}
+
+func WriteConsole(logger zLogger.ZLogger, fData *FileData, digests []checksum.DigestAlgorithm) {
+	fmt.Printf("'%s' - %s\n           [%s - %s] %s\n", fData.Path, checksumString(fData, digests), fData.Indexer.Pronom, fData.Indexer.Mimetype, human.Bytes(uint64(fData.Size)))
 	if fData.Indexer.Type == "image" && fData.Indexer.Width > 0 {
 		fmt.Printf("#           image: %vx%v\n", fData.Indexer.Width, fData.Indexer.Height)
 	}
@@ -156,65 +127,91 @@ func isDup(t string) bool {
 	return false
 }
 
-func Worker(id uint, fsys fs.FS, actions []string, idx *util.Indexer, logger zLogger.ZLogger, jobs <-chan string, results chan<- string, badgerDB *badger.DB, startTime int64, waiter *sync.WaitGroup) {
+// hasDigests checks, whether checksums for all digest algorithms are available
+func hasDigests(fData *FileData, digests []checksum.DigestAlgorithm) bool {
+	if fData.Indexer == nil {
+		return false
+	}
+	for _, digest := range digests {
+		if fData.Indexer.Checksum[string(digest)] == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// storeIndexError records the failure of a file in the database, if there is one
+func storeIndexError(logger zLogger.ZLogger, store Store, source, path, action string, indexErr error) {
+	if store == nil {
+		return
+	}
+	if err := StoreIndexError(store, source, path, action, indexErr); err != nil {
+		logger.Error().Err(err).Msgf("cannot store error record of %s", path)
+	}
+}
+
+// unchanged checks the etag of objects and the modification time of files against the cached data
+func unchanged(fData *FileData, finfo fs.FileInfo) bool {
+	if etag := ETagOf(finfo); etag != "" {
+		return fData.ETag == etag
+	}
+	return fData.LastMod == finfo.ModTime().Unix()
+}
+
+// WorkerResult reports the start (Done is false) and the end of a job
+type WorkerResult struct {
+	Worker    uint
+	Path      string
+	Container string
+	Size      int64
+	Cached    bool
+	Failed    bool
+	Done      bool
+}
+
+func Worker(ctx context.Context, id uint, fsys fs.FS, source string, actions []string, digests []checksum.DigestAlgorithm, dupDigest checksum.DigestAlgorithm, idx *util.Indexer, logger zLogger.ZLogger, jobs <-chan string, results chan<- *WorkerResult, store Store, startTime int64, history bool, waiter *sync.WaitGroup) {
 	for path := range jobs {
+		if ctx.Err() != nil {
+			// cancelled: drain the queue
+			waiter.Done()
+			continue
+		}
+		results <- &WorkerResult{Worker: id, Path: path}
 		finfo, err := fs.Stat(fsys, path)
 		if err != nil {
 			logger.Error().Err(err).Msgf("cannot stat (%s)%s", fsys, path)
+			storeIndexError(logger, store, source, path, ActionStat, err)
+			results <- &WorkerResult{Worker: id, Path: path, Done: true, Failed: true}
 			waiter.Done()
 			continue
 		}
 		if finfo.IsDir() {
 			logger.Error().Err(err).Msgf("cannot index (%s)%s: is a directory", fsys, path)
+			results <- &WorkerResult{Worker: id, Path: path, Done: true, Failed: true}
 			waiter.Done()
 			continue
 		}
+		container := ContainerOf(fsys, path)
 
 		var fData *FileData
 		var fromCache bool
-		if badgerDB != nil {
-			err := badgerDB.View(func(txn *badger.Txn) error {
-				key := []byte("file:" + path)
-				if data, err := txn.Get(key); err != nil {
-					if !errors.Is(err, badger.ErrKeyNotFound) {
-						return errors.Wrapf(err, "cannot read from badger db")
-					}
-				} else {
-					fData = &FileData{}
-					data.Value(func(val []byte) error {
-						logger.Info().Uint("worker", id).Str("path", path).Msg("loading from cache")
-						if err := json.Unmarshal(val, fData); err != nil {
-							return errors.Wrapf(err, "cannot unmarshal data")
-						}
-						fData.LastSeen = startTime
-						fData.Duplicate = fData.Size > 0 && isDup(fData.Indexer.Checksum[string(checksum.DigestSHA512)])
-						if err := badgerDB.Update(func(txn *badger.Txn) error {
-							//key := []byte("file:"+path)
-							value, err := json.Marshal(fData)
-							if err != nil {
-								return errors.Wrapf(err, "cannot marshal result")
-							}
-							if err := txn.Set(key, value); err != nil {
-								return errors.Wrapf(err, "cannot write to badger db")
-							}
-							return nil
-						}); err != nil {
-							logger.Error().Err(err).Msgf("cannot write to badger db")
-						}
-						return nil
-					})
-				}
-				return nil
-			})
+		// former version of a changed file
+		var previous *FileData
+		if store != nil {
+			fData, err = LoadFileData(store, source, path)
 			if err != nil {
-				logger.Error().Err(err).Msgf("cannot read from badger db")
-			} else {
-				if fData != nil {
-					if fData.Size != finfo.Size() || fData.LastMod != finfo.ModTime().Unix() {
-						fData = nil
-					} else {
-						fromCache = true
-					}
+				logger.Error().Err(err).Msgf("cannot read from database")
+			} else if fData != nil {
+				logger.Info().Uint("worker", id).Str("path", path).Msg("loading from cache")
+				changed := fData.Size != finfo.Size() || !unchanged(fData, finfo)
+				if changed {
+					previous = fData
+				} else if hasDigests(fData, digests) {
+					fData.LastSeen = startTime
+					fromCache = true
+				}
+				if !fromCache {
+					fData = nil
 				}
 			}
 		}
@@ -223,122 +220,127 @@ func Worker(id uint, fsys fs.FS, actions []string, idx *util.Indexer, logger zLo
 			slices.Sort(actions)
 			actions = slices.Compact(actions)
 			logger.Info().Uint("worker", id).Str("path", path).Msg("indexing")
-			r, cs, err := idx.Index(fsys, path, "", actions, []checksum.DigestAlgorithm{checksum.DigestSHA512}, io.Discard, logger)
+			r, cs, err := idx.Index(fsys, path, "", actions, digests, io.Discard, logger)
 			if err != nil {
 				logger.Error().Err(err).Msgf("cannot index (%s)%s", fsys, path)
+				storeIndexError(logger, store, source, path, FailedAction(err), err)
+				results <- &WorkerResult{Worker: id, Path: path, Container: container, Size: finfo.Size(), Done: true, Failed: true}
 				waiter.Done()
-				return
+				continue
 			}
-			if len(r.Checksum) == 0 {
+			if r.Checksum == nil {
 				r.Checksum = make(map[string]string)
-				for alg, c := range cs {
-					r.Checksum[string(alg)] = c
-				}
 			}
-			dup := r.Size > 0 && isDup(cs[checksum.DigestSHA512])
+			for alg, c := range cs {
+				r.Checksum[string(alg)] = c
+			}
 			fData = &FileData{
-				path,
-				filepath.Dir(path),
-				filepath.Base(path),
-				int64(r.Size),
-				dup,
-				finfo.ModTime().Unix(),
-				r,
-				startTime,
+				Source:    source,
+				Path:      path,
+				Folder:    filepath.Dir(path),
+				Basename:  filepath.Base(path),
+				Size:      int64(r.Size),
+				LastMod:   finfo.ModTime().Unix(),
+				ETag:      ETagOf(finfo),
+				Indexer:   r,
+				LastSeen:  startTime,
+				Container: container,
 			}
 		}
 
-		basePath := fmt.Sprintf("%v", fsys)
-		WriteLogger(logger, fData, id, basePath, fromCache)
-
-		if badgerDB == nil {
-			WriteConsole(logger, fData)
+		if store == nil {
+			fData.Duplicate = fData.Size > 0 && isDup(fData.Indexer.Checksum[string(dupDigest)])
 		} else {
-			if err := badgerDB.Update(func(txn *badger.Txn) error {
-				key := []byte("file:" + path)
-				value, err := json.Marshal(fData)
-				if err != nil {
-					return errors.Wrapf(err, "cannot marshal result")
-				}
-				if err := txn.Set(key, value); err != nil {
-					return errors.Wrapf(err, "cannot write to badger db")
+			if history && previous != nil {
+				if err := StoreHistory(store, previous, startTime); err != nil {
+					logger.Error().Err(err).Msgf("cannot archive former record of %s", path)
 				}
-				return nil
-			}); err != nil {
-				logger.Error().Err(err).Msgf("cannot write to badger db")
 			}
+			// duplicate flag is maintained by the checksum index
+			if err := StoreFileData(store, fData, dupDigest); err != nil {
+				logger.Error().Err(err).Msgf("cannot write to database")
+			}
+			if err := ClearIndexError(store, source, path); err != nil {
+				logger.Error().Err(err).Msgf("cannot remove error record of %s", path)
+			}
+		}
+
+		basePath := fmt.Sprintf("%v", fsys)
+		WriteLogger(logger, fData, id, basePath, fromCache, digests)
+		if store == nil {
+			WriteConsole(logger, fData, digests)
 		}
 
-		results <- fmt.Sprintf("#%03d: %s done", id, path)
+		results <- &WorkerResult{Worker: id, Path: path, Container: container, Size: fData.Size, Done: true, Cached: fromCache}
 		waiter.Done()
 	}
 }
 
-func IterateBadger(logger zLogger.ZLogger, emptyFlag bool, duplicateFlag bool, removeFlag bool, regex *regexp.Regexp, jsonlWriter *os.File, csvWriter *csv.Writer, sheet *xlsx.Sheet, console bool, badgerDB *badger.DB, hit func(fData *FileData) bool) error {
+func IterateStore(logger zLogger.ZLogger, emptyFlag bool, duplicateFlag bool, removeFlag bool, regex *regexp.Regexp, output *Output, console bool, store Store, digests []checksum.DigestAlgorithm, hit func(fData *FileData) bool) error {
 	var removeList = [][]byte{}
-	if err := badgerDB.View(func(txn *badger.Txn) error {
-		options := badger.DefaultIteratorOptions
-		options.Prefix = []byte("file:")
-		options.PrefetchValues = true
-		iter := txn.NewIterator(options)
-		defer iter.Close()
-		for iter.Rewind(); iter.Valid(); iter.Next() {
-			item := iter.Item()
-			k := item.Key()
-			if err := item.Value(func(v []byte) error {
-				logger.Debug().Msg(strings.TrimPrefix(string(k), "file:"))
-				fData := &FileData{}
-				if err := json.Unmarshal(v, fData); err != nil {
-					return errors.Wrapf(err, "cannot unmarshal value")
-				}
-				/*
-				 */
-				if hit(fData) {
-					logger.Info().Msgf("found %s", fData.Path)
-					if jsonlWriter != nil {
-						if err := JsonlWriteLine(jsonlWriter, fData); err != nil {
-							logger.Error().Err(err).Msgf("cannot write to output")
-						}
-					}
-					if csvWriter != nil {
-						CsvWriteLine(csvWriter, fData)
-					}
-					if sheet != nil {
-						XlsxWriteLine(sheet, fData)
-					}
-					if console {
-						WriteConsole(logger, fData)
+	if err := store.View(func(txn Txn) error {
+		return txn.Iterate([]byte("file:"), func(k, v []byte) error {
+			logger.Debug().Msg(strings.TrimPrefix(string(k), "file:"))
+			fData := &FileData{}
+			if err := json.Unmarshal(v, fData); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal value of key %s", string(k))
+			}
+			if hit(fData) {
+				logger.Info().Msgf("found %s", fData.Path)
+				if output != nil && fData.Indexer != nil {
+					if err := output.Write(FileRecord(fData, digests), fData); err != nil {
+						logger.Error().Err(err).Msgf("cannot write to output")
 					}
-					if removeFlag {
-						if err := os.Remove(fData.Path); err != nil {
-							logger.Error().Err(err).Msgf("cannot remove file %s", fData.Path)
-						} else {
-							logger.Info().Msgf("removed file %s", fData.Path)
-							removeList = append(removeList, k)
-						}
+				}
+				if console {
+					WriteConsole(logger, fData, digests)
+				}
+				if removeFlag {
+					if err := os.Remove(fData.Path); err != nil {
+						logger.Error().Err(err).Msgf("cannot remove file %s", fData.Path)
+					} else {
+						logger.Info().Msgf("removed file %s", fData.Path)
+						removeList = append(removeList, k)
+						removeList = append(removeList, secondaryKeys(fData)...)
 					}
 				}
-				return nil
-			}); err != nil {
-				return errors.Wrapf(err, "cannot get data for key %s", string(k))
 			}
-		}
-		if len(removeList) > 0 {
-			if err := badgerDB.Update(func(txn *badger.Txn) error {
-				var errs = []error{}
-				for _, k := range removeList {
-					if err := txn.Delete(k); err != nil {
-						errs = append(errs, errors.Wrapf(err, "cannot delete key %s", string(k)))
-					}
+			return nil
+		})
+	}); err != nil {
+		return errors.Wrapf(err, "cannot iterate database")
+	}
+	if len(removeList) > 0 {
+		if err := store.Update(func(txn Txn) error {
+			var errs = []error{}
+			for _, k := range removeList {
+				if err := txn.Delete(k); err != nil {
+					errs = append(errs, errors.Wrapf(err, "cannot delete key %s", string(k)))
 				}
-				return errors.Combine(errs...)
-			}); err != nil {
-				return errors.Wrapf(err, "cannot delete keys")
 			}
+			return errors.Combine(errs...)
+		}); err != nil {
+			return errors.Wrapf(err, "cannot delete keys")
 		}
-		return nil
+	}
+	return nil
+}
+
+// IterateStale calls do for every file record of source, which has not been seen by the index run started at lastSeen
+func IterateStale(store Store, source string, lastSeen int64, do func(key string, fData *FileData) error) error {
+	if err := store.View(func(txn Txn) error {
+		return txn.Iterate(FileKey(source, ""), func(k, v []byte) error {
+			fData := &FileData{}
+			if err := json.Unmarshal(v, fData); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal value of key %s", string(k))
+			}
+			if fData.LastSeen >= lastSeen {
+				return nil
+			}
+			return do(string(k), fData)
+		})
 	}); err != nil {
-		return errors.Wrapf(err, "cannot iterate badger db")
+		return errors.Wrapf(err, "cannot iterate database")
 	}
 	return nil
 }
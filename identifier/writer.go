@@ -0,0 +1,211 @@
+package identifier
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"golang.org/x/exp/slices"
+)
+
+// FieldType is the type of the values of an output field, which is used by typed formats (i.e. parquet)
+type FieldType int
+
+const (
+	FieldString FieldType = iota
+	FieldInt
+	FieldFloat
+	FieldBool
+	// FieldTime values are time.Time or unix seconds
+	FieldTime
+	// FieldList values are []string
+	FieldList
+)
+
+// Field is a column of the output
+type Field struct {
+	Name string
+	Type FieldType
+}
+
+// FieldTypes declares the types of the fields of a command, undeclared fields are strings
+type FieldTypes map[string]FieldType
+
+// Fields returns the fields with their declared types
+func (t FieldTypes) Fields(names []string) []Field {
+	var fields = []Field{}
+	for _, name := range names {
+		fields = append(fields, Field{Name: name, Type: t[name]})
+	}
+	return fields
+}
+
+// fieldNames returns the names of the fields
+func fieldNames(fields []Field) []string {
+	var names = []string{}
+	for _, field := range fields {
+		names = append(names, field.Name)
+	}
+	return names
+}
+
+// Writer writes the records of a command in one output format
+type Writer interface {
+	// WriteHeader is called once with the fields before the first record
+	WriteHeader(fields []Field) error
+	// Write writes a record with the values of the fields. data is the complete structure of the record (i.e. for json).
+	Write(record []any, data any) error
+	Close() error
+}
+
+// WriterConfig is the configuration of a writer given by "format:path[?options]"
+type WriterConfig struct {
+	Format string
+	// Path is the output file, "-" is stdout
+	Path string
+	// Name of the output (i.e. sheet name)
+	Name    string
+	Options url.Values
+	Logger  zLogger.ZLogger
+}
+
+// WriterFactory creates a writer for the configuration
+type WriterFactory func(config *WriterConfig) (Writer, error)
+
+// writerRegistry contains the built in formats, others can be added with RegisterWriter
+var writerRegistry = map[string]WriterFactory{
+	"console": newConsoleWriter,
+	"csv":     newCSVWriter,
+	"jsonl":   newJSONLWriter,
+	"parquet": newParquetWriter,
+	"xlsx":    newXLSXWriter,
+}
+var writerRegistryLock sync.RWMutex
+
+// RegisterWriter makes an output format available for "--out format:path"
+func RegisterWriter(format string, factory WriterFactory) {
+	writerRegistryLock.Lock()
+	defer writerRegistryLock.Unlock()
+	writerRegistry[strings.ToLower(format)] = factory
+}
+
+// WriterFormats returns the names of all registered output formats
+func WriterFormats() []string {
+	writerRegistryLock.RLock()
+	defer writerRegistryLock.RUnlock()
+	var formats = []string{}
+	for format := range writerRegistry {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// ParseWriterSpec splits "format:path[?options]" into the writer configuration. A missing path is stdout.
+func ParseWriterSpec(spec string) (*WriterConfig, error) {
+	format, path, _ := strings.Cut(spec, ":")
+	config := &WriterConfig{Format: strings.ToLower(format), Path: path, Options: url.Values{}}
+	if pos := strings.LastIndex(path, "?"); pos >= 0 {
+		options, err := parseWriterOptions(path[pos+1:])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid options in '%s'", spec)
+		}
+		config.Path, config.Options = path[:pos], options
+	}
+	if config.Path == "" {
+		config.Path = "-"
+	}
+	if config.Format == "" {
+		return nil, errors.Errorf("no format in '%s' - use format:path", spec)
+	}
+	return config, nil
+}
+
+// parseWriterOptions parses "key=value&key=value". Unlike url.ParseQuery, ';' is allowed as value (i.e. csv delimiter).
+func parseWriterOptions(query string) (url.Values, error) {
+	var options = url.Values{}
+	for _, option := range strings.Split(query, "&") {
+		if option == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(option, "=")
+		key, err := url.QueryUnescape(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid option '%s'", option)
+		}
+		if value, err = url.QueryUnescape(value); err != nil {
+			return nil, errors.Wrapf(err, "invalid option '%s'", option)
+		}
+		options.Add(key, value)
+	}
+	return options, nil
+}
+
+// NewWriter creates the writer for "format:path[?options]"
+func NewWriter(spec string, name string, logger zLogger.ZLogger) (Writer, error) {
+	config, err := ParseWriterSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	config.Name = name
+	config.Logger = logger
+	writerRegistryLock.RLock()
+	factory, ok := writerRegistry[config.Format]
+	writerRegistryLock.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("unknown output format '%s' - use one of %v", config.Format, WriterFormats())
+	}
+	writer, err := factory(config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create %s output '%s'", config.Format, config.Path)
+	}
+	return writer, nil
+}
+
+// CheckOptions returns an error for options, which are not supported by the format
+func (c *WriterConfig) CheckOptions(supported ...string) error {
+	for option := range c.Options {
+		if !slices.Contains(supported, option) {
+			return errors.Errorf("unknown option '%s' of format %s - supported options: %v", option, c.Format, supported)
+		}
+	}
+	return nil
+}
+
+// formatValue returns the text of a value for text based formats. Lists are separated by "; ".
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, "; ")
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// Create opens the output file of the writer or stdout for "-"
+func (c *WriterConfig) Create() (io.WriteCloser, error) {
+	if c.Path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	fp, err := os.Create(c.Path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create file '%s'", c.Path)
+	}
+	return fp, nil
+}
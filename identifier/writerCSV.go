@@ -0,0 +1,72 @@
+package identifier
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"unicode/utf8"
+
+	"emperror.dev/errors"
+)
+
+// newCSVWriter creates a csv writer. Options: delimiter (character or "tab"), header (false omits the header line)
+func newCSVWriter(config *WriterConfig) (Writer, error) {
+	if err := config.CheckOptions("delimiter", "header"); err != nil {
+		return nil, err
+	}
+	w := &csvWriter{header: true}
+	if header := config.Options.Get("header"); header != "" {
+		var err error
+		if w.header, err = strconv.ParseBool(header); err != nil {
+			return nil, errors.Wrapf(err, "invalid header option '%s'", header)
+		}
+	}
+	var delimiter = ','
+	switch d := config.Options.Get("delimiter"); {
+	case d == "":
+	case d == "tab":
+		delimiter = '\t'
+	case utf8.RuneCountInString(d) == 1:
+		delimiter, _ = utf8.DecodeRuneInString(d)
+	default:
+		return nil, errors.Errorf("invalid delimiter option '%s'", d)
+	}
+	fp, err := config.Create()
+	if err != nil {
+		return nil, err
+	}
+	w.file = fp
+	w.writer = csv.NewWriter(fp)
+	w.writer.Comma = delimiter
+	return w, nil
+}
+
+type csvWriter struct {
+	file   io.WriteCloser
+	writer *csv.Writer
+	header bool
+}
+
+func (w *csvWriter) WriteHeader(fields []Field) error {
+	if !w.header {
+		return nil
+	}
+	return errors.WithStack(w.writer.Write(fieldNames(fields)))
+}
+
+func (w *csvWriter) Write(record []any, data any) error {
+	strs := make([]string, len(record))
+	for key, val := range record {
+		strs[key] = formatValue(val)
+	}
+	return errors.Wrap(w.writer.Write(strs), "cannot write csv")
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		w.file.Close()
+		return errors.Wrap(err, "cannot write csv")
+	}
+	return errors.Wrap(w.file.Close(), "cannot close csv file")
+}
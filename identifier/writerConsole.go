@@ -0,0 +1,49 @@
+package identifier
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"emperror.dev/errors"
+)
+
+// newConsoleWriter creates a writer for "field: value // " lines, usually to stdout
+func newConsoleWriter(config *WriterConfig) (Writer, error) {
+	if err := config.CheckOptions(); err != nil {
+		return nil, err
+	}
+	fp, err := config.Create()
+	if err != nil {
+		return nil, err
+	}
+	return &consoleWriter{file: fp, buf: bufio.NewWriter(fp)}, nil
+}
+
+type consoleWriter struct {
+	file   io.WriteCloser
+	buf    *bufio.Writer
+	fields []string
+}
+
+func (w *consoleWriter) WriteHeader(fields []Field) error {
+	w.fields = fieldNames(fields)
+	return nil
+}
+
+func (w *consoleWriter) Write(record []any, data any) error {
+	for key, field := range record {
+		fmt.Fprintf(w.buf, "%s: %s // ", w.fields[key], formatValue(field))
+	}
+	fmt.Fprintln(w.buf)
+	// the console output is mixed with other messages of the command
+	return errors.Wrap(w.buf.Flush(), "cannot write to console")
+}
+
+func (w *consoleWriter) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return errors.Wrap(err, "cannot write to console")
+	}
+	return errors.WithStack(w.file.Close())
+}
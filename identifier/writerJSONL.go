@@ -0,0 +1,44 @@
+package identifier
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"emperror.dev/errors"
+)
+
+// newJSONLWriter creates a writer for json lines with the complete structure of every record
+func newJSONLWriter(config *WriterConfig) (Writer, error) {
+	if err := config.CheckOptions(); err != nil {
+		return nil, err
+	}
+	fp, err := config.Create()
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(fp)
+	return &jsonlWriter{file: fp, buf: buf, encoder: json.NewEncoder(buf)}, nil
+}
+
+type jsonlWriter struct {
+	file    io.WriteCloser
+	buf     *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (w *jsonlWriter) WriteHeader(fields []Field) error {
+	return nil
+}
+
+func (w *jsonlWriter) Write(record []any, data any) error {
+	return errors.Wrap(w.encoder.Encode(data), "cannot write jsonl")
+}
+
+func (w *jsonlWriter) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return errors.Wrap(err, "cannot write jsonl")
+	}
+	return errors.Wrap(w.file.Close(), "cannot close jsonl file")
+}
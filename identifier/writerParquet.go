@@ -0,0 +1,209 @@
+package identifier
+
+import (
+	"io"
+	"reflect"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/encoding"
+)
+
+// newParquetWriter creates a parquet writer. The schema is derived from the types of the fields,
+// all columns are optional and empty values are written as null. The rows are flushed in row groups. Options: rowgroup (rows per row group), compression (snappy, zstd, gzip or none)
+func newParquetWriter(config *WriterConfig) (Writer, error) {
+	if err := config.CheckOptions("rowgroup", "compression"); err != nil {
+		return nil, err
+	}
+	w := &parquetWriter{config: config, rowGroup: 50000, codec: &parquet.Snappy}
+	if rowGroup := config.Options.Get("rowgroup"); rowGroup != "" {
+		var err error
+		if w.rowGroup, err = strconv.ParseInt(rowGroup, 10, 64); err != nil || w.rowGroup <= 0 {
+			return nil, errors.Errorf("invalid rowgroup option '%s'", rowGroup)
+		}
+	}
+	switch compression := config.Options.Get("compression"); compression {
+	case "", "snappy":
+	case "zstd":
+		w.codec = &parquet.Zstd
+	case "gzip":
+		w.codec = &parquet.Gzip
+	case "none":
+		w.codec = &parquet.Uncompressed
+	default:
+		return nil, errors.Errorf("invalid compression option '%s' - use snappy, zstd, gzip or none", compression)
+	}
+	fp, err := config.Create()
+	if err != nil {
+		return nil, err
+	}
+	w.file = fp
+	return w, nil
+}
+
+type parquetWriter struct {
+	config   *WriterConfig
+	file     io.WriteCloser
+	writer   *parquet.Writer
+	rowGroup int64
+	codec    compress.Codec
+	fields   []Field
+}
+
+func (w *parquetWriter) WriteHeader(fields []Field) error {
+	w.fields = fields
+	var root = parquetRecord{}
+	for key, field := range fields {
+		root = append(root, &parquetField{Node: parquet.Optional(parquetNode(field.Type)), name: field.Name, index: key})
+	}
+	schema := parquet.NewSchema(w.config.Name, root)
+	w.writer = parquet.NewWriter(w.file, schema, parquet.MaxRowsPerRowGroup(w.rowGroup), parquet.Compression(w.codec))
+	return nil
+}
+
+func (w *parquetWriter) Write(record []any, data any) error {
+	var row = make([]any, len(record))
+	for key, value := range record {
+		var err error
+		if row[key], err = parquetValue(w.fields[key].Type, value); err != nil {
+			return errors.Wrapf(err, "invalid value of field '%s'", w.fields[key].Name)
+		}
+	}
+	return errors.Wrap(w.writer.Write(row), "cannot write parquet")
+}
+
+func (w *parquetWriter) Close() error {
+	if w.writer == nil {
+		if err := w.WriteHeader([]Field{}); err != nil {
+			w.file.Close()
+			return err
+		}
+	}
+	if err := w.writer.Close(); err != nil {
+		w.file.Close()
+		return errors.Wrap(err, "cannot write parquet")
+	}
+	return errors.Wrap(w.file.Close(), "cannot close parquet file")
+}
+
+// parquetNode returns the column type of the field type
+func parquetNode(t FieldType) parquet.Node {
+	switch t {
+	case FieldInt:
+		return parquet.Int(64)
+	case FieldFloat:
+		return parquet.Leaf(parquet.DoubleType)
+	case FieldBool:
+		return parquet.Leaf(parquet.BooleanType)
+	case FieldTime:
+		return parquet.Timestamp(parquet.Millisecond)
+	case FieldList:
+		return parquet.List(parquet.String())
+	default:
+		return parquet.String()
+	}
+}
+
+// parquetValue converts the value to the go type of the column. nil and "" are null.
+func parquetValue(t FieldType, value any) (any, error) {
+	if value == nil || value == "" {
+		return nil, nil
+	}
+	v := reflect.ValueOf(value)
+	switch t {
+	case FieldInt, FieldTime:
+		var unix int64
+		switch {
+		case v.CanInt():
+			unix = v.Int()
+		case v.CanUint():
+			unix = int64(v.Uint())
+		default:
+			if tm, ok := value.(time.Time); ok && t == FieldTime {
+				return tm, nil
+			}
+			return nil, errors.Errorf("%v (%T) is not an integer", value, value)
+		}
+		if t == FieldTime {
+			tm := time.Unix(unix, 0)
+			return tm, nil
+		}
+		return unix, nil
+	case FieldFloat:
+		var f float64
+		switch {
+		case v.CanFloat():
+			f = v.Float()
+		case v.CanInt():
+			f = float64(v.Int())
+		case v.CanUint():
+			f = float64(v.Uint())
+		default:
+			return nil, errors.Errorf("%v (%T) is not a number", value, value)
+		}
+		return f, nil
+	case FieldBool:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, errors.Errorf("%v (%T) is not a boolean", value, value)
+		}
+		return b, nil
+	case FieldList:
+		list, ok := value.([]string)
+		if !ok {
+			return nil, errors.Errorf("%v (%T) is not a list", value, value)
+		}
+		if list == nil {
+			return nil, nil
+		}
+		return list, nil
+	default:
+		return formatValue(value), nil
+	}
+}
+
+// parquetRecord is the root of the schema, which keeps the columns in the order of the fields.
+// Rows are the records ([]any) of the output.
+type parquetRecord []parquet.Field
+
+func (r parquetRecord) group() parquet.Group {
+	var group = parquet.Group{}
+	for _, field := range r {
+		group[field.Name()] = field
+	}
+	return group
+}
+
+func (r parquetRecord) ID() int                     { return 0 }
+func (r parquetRecord) String() string              { return r.group().String() }
+func (r parquetRecord) Type() parquet.Type          { return r.group().Type() }
+func (r parquetRecord) Optional() bool              { return false }
+func (r parquetRecord) Repeated() bool              { return false }
+func (r parquetRecord) Required() bool              { return true }
+func (r parquetRecord) Leaf() bool                  { return false }
+func (r parquetRecord) Fields() []parquet.Field     { return r }
+func (r parquetRecord) Encoding() encoding.Encoding { return nil }
+func (r parquetRecord) Compression() compress.Codec { return nil }
+func (r parquetRecord) GoType() reflect.Type        { return reflect.TypeOf([]any{}) }
+
+// parquetField is a column of the record
+type parquetField struct {
+	parquet.Node
+	name  string
+	index int
+}
+
+func (f *parquetField) Name() string { return f.name }
+
+func (f *parquetField) Value(base reflect.Value) reflect.Value {
+	if base.Kind() == reflect.Interface {
+		base = base.Elem()
+	}
+	if !base.IsValid() {
+		return base
+	}
+	return base.Index(f.index)
+}
@@ -0,0 +1,57 @@
+package identifier
+
+import (
+	"io"
+	"strconv"
+
+	"emperror.dev/errors"
+)
+
+// newXLSXWriter creates an xlsx writer, which streams the rows into the file.
+// Options: sheet (name of the sheet), rows (maximum number of rows per sheet, more rows continue on a new sheet)
+func newXLSXWriter(config *WriterConfig) (Writer, error) {
+	if err := config.CheckOptions("sheet", "rows"); err != nil {
+		return nil, err
+	}
+	w := &xlsxWriter{name: config.Options.Get("sheet")}
+	if w.name == "" {
+		w.name = config.Name
+	}
+	var maxRows = XLSXMaxRows
+	if rows := config.Options.Get("rows"); rows != "" {
+		var err error
+		if maxRows, err = strconv.Atoi(rows); err != nil || maxRows < 2 {
+			return nil, errors.Errorf("invalid rows option '%s'", rows)
+		}
+	}
+	fp, err := config.Create()
+	if err != nil {
+		return nil, err
+	}
+	w.file = fp
+	w.stream = NewXLSXStream(fp)
+	w.stream.MaxRows = maxRows
+	return w, nil
+}
+
+type xlsxWriter struct {
+	name   string
+	file   io.WriteCloser
+	stream *XLSXStream
+}
+
+func (w *xlsxWriter) WriteHeader(fields []Field) error {
+	return errors.WithStack(w.stream.AddSheet(w.name, fieldNames(fields)))
+}
+
+func (w *xlsxWriter) Write(record []any, data any) error {
+	return errors.WithStack(w.stream.WriteRow(record))
+}
+
+func (w *xlsxWriter) Close() error {
+	if err := w.stream.Close(); err != nil {
+		w.file.Close()
+		return errors.Wrap(err, "cannot write xlsx")
+	}
+	return errors.Wrap(w.file.Close(), "cannot close xlsx file")
+}
@@ -0,0 +1,346 @@
+package identifier
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"emperror.dev/errors"
+)
+
+// XLSXMaxRows is the row limit of a sheet in excel
+const XLSXMaxRows = 1048576
+
+// xlsxMaxCellText is the maximum number of characters in a cell
+const xlsxMaxCellText = 32767
+
+// cell styles of styles.xml
+const (
+	xlsxStyleDefault = 0
+	xlsxStyleHeader  = 1
+	xlsxStyleDate    = 2
+	xlsxStyleLink    = 3
+)
+
+// XLSXLink is a cell value with a link to a location in the workbook (i.e. "'files'!A12")
+type XLSXLink struct {
+	Text     string
+	Location string
+}
+
+// XLSXStream writes a workbook sheet by sheet and row by row into a zip stream.
+// Only the current row is kept in memory. If a sheet reaches the row limit, the rows continue on a new sheet
+// with the same header ("name (2)", ...).
+type XLSXStream struct {
+	zip    *zip.Writer
+	buf    *bufio.Writer
+	sheets []string
+	// filters contains the range of the auto filter of every sheet
+	filters []string
+	current *xlsxSheet
+	// MaxRows is the number of rows of a sheet including the header (at most XLSXMaxRows)
+	MaxRows int
+	// FreezeHeader keeps the header row visible while scrolling
+	FreezeHeader bool
+	// AutoFilter adds filters to the header row
+	AutoFilter bool
+}
+
+type xlsxSheet struct {
+	name   string
+	fields []string
+	rows   int
+	part   int
+	// hyperlinks are written at the end of the sheet
+	hyperlinks []string
+}
+
+// NewXLSXStream creates a workbook, which is written to w. Close finishes the workbook, but does not close w.
+func NewXLSXStream(w io.Writer) *XLSXStream {
+	return &XLSXStream{zip: zip.NewWriter(w), MaxRows: XLSXMaxRows}
+}
+
+// AddSheet finishes the current sheet and starts a new one with a header row of the fields
+func (x *XLSXStream) AddSheet(name string, fields []string) error {
+	if err := x.finishSheet(); err != nil {
+		return err
+	}
+	x.current = &xlsxSheet{name: name, fields: fields, part: 1}
+	return x.startSheet()
+}
+
+// WriteRow writes the values as typed cells into the current sheet
+func (x *XLSXStream) WriteRow(values []any) error {
+	if x.current == nil {
+		return errors.New("no sheet")
+	}
+	if x.current.rows >= min(x.MaxRows, XLSXMaxRows) {
+		if err := x.finishSheet(); err != nil {
+			return err
+		}
+		x.current.part++
+		if err := x.startSheet(); err != nil {
+			return err
+		}
+	}
+	return x.writeRow(values, xlsxStyleDefault)
+}
+
+// Location returns the reference to the first cell of the last written row (i.e. "'files'!A12")
+func (x *XLSXStream) Location() string {
+	if x.current == nil || len(x.sheets) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("'%s'!A%d", strings.ReplaceAll(x.sheets[len(x.sheets)-1], "'", "''"), x.current.rows)
+}
+
+// Close finishes the current sheet and writes the workbook
+func (x *XLSXStream) Close() error {
+	if err := x.finishSheet(); err != nil {
+		return err
+	}
+	if len(x.sheets) == 0 {
+		// a workbook needs at least one sheet
+		x.current = &xlsxSheet{name: "Sheet", part: 1}
+		if err := x.startSheet(); err != nil {
+			return err
+		}
+		if err := x.finishSheet(); err != nil {
+			return err
+		}
+	}
+	var sheets, names, rels, types strings.Builder
+	for i, name := range x.sheets {
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(name), i+1, i+1)
+		if x.filters[i] != "" {
+			fmt.Fprintf(&names, `<definedName name="_xlnm._FilterDatabase" localSheetId="%d" hidden="1">%s</definedName>`, i, xlsxEscape(x.filters[i]))
+		}
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(x.sheets)+1)
+	var parts = []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheets.String() + `</sheets>` + xlsxDefinedNames(names.String()) + `</workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + rels.String() + `</Relationships>`},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		w, err := x.zip.Create(part.name)
+		if err != nil {
+			return errors.Wrapf(err, "cannot create '%s'", part.name)
+		}
+		if _, err := io.WriteString(w, xml.Header+part.content); err != nil {
+			return errors.Wrapf(err, "cannot write '%s'", part.name)
+		}
+	}
+	return errors.Wrap(x.zip.Close(), "cannot close xlsx")
+}
+
+// startSheet creates the zip entry of the next sheet and writes the header row
+func (x *XLSXStream) startSheet() error {
+	name := xlsxSheetName(x.current.name, x.current.part, x.sheets)
+	x.sheets = append(x.sheets, name)
+	x.filters = append(x.filters, "")
+	x.current.hyperlinks = nil
+	w, err := x.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(x.sheets)))
+	if err != nil {
+		return errors.Wrapf(err, "cannot create sheet '%s'", name)
+	}
+	x.buf = bufio.NewWriter(w)
+	x.current.rows = 0
+	x.buf.WriteString(xml.Header)
+	x.buf.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`)
+	if x.FreezeHeader && len(x.current.fields) > 0 {
+		x.buf.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	}
+	x.buf.WriteString(`<sheetData>`)
+	if len(x.current.fields) == 0 {
+		return nil
+	}
+	var header = make([]any, len(x.current.fields))
+	for i, field := range x.current.fields {
+		header[i] = field
+	}
+	return x.writeRow(header, xlsxStyleHeader)
+}
+
+func (x *XLSXStream) finishSheet() error {
+	if x.buf == nil {
+		return nil
+	}
+	x.buf.WriteString(`</sheetData>`)
+	if x.AutoFilter && len(x.current.fields) > 0 {
+		ref := fmt.Sprintf("A1:%s%d", xlsxColumn(len(x.current.fields)-1), x.current.rows)
+		fmt.Fprintf(x.buf, `<autoFilter ref="%s"/>`, ref)
+		x.filters[len(x.filters)-1] = fmt.Sprintf("'%s'!$A$1:$%s$%d", strings.ReplaceAll(x.sheets[len(x.sheets)-1], "'", "''"), xlsxColumn(len(x.current.fields)-1), x.current.rows)
+	}
+	if len(x.current.hyperlinks) > 0 {
+		x.buf.WriteString(`<hyperlinks>`)
+		for _, hyperlink := range x.current.hyperlinks {
+			x.buf.WriteString(hyperlink)
+		}
+		x.buf.WriteString(`</hyperlinks>`)
+	}
+	x.buf.WriteString(`</worksheet>`)
+	err := x.buf.Flush()
+	x.buf = nil
+	return errors.Wrapf(err, "cannot write sheet '%s'", x.sheets[len(x.sheets)-1])
+}
+
+func (x *XLSXStream) writeRow(values []any, style int) error {
+	x.current.rows++
+	row := x.current.rows
+	fmt.Fprintf(x.buf, `<row r="%d">`, row)
+	for i, value := range values {
+		ref := xlsxColumn(i) + strconv.Itoa(row)
+		if style == xlsxStyleHeader {
+			fmt.Fprintf(x.buf, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xlsxText(formatValue(value)))
+			continue
+		}
+		switch v := value.(type) {
+		case nil:
+		case bool:
+			var b = 0
+			if v {
+				b = 1
+			}
+			fmt.Fprintf(x.buf, `<c r="%s" t="b"><v>%d</v></c>`, ref, b)
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			fmt.Fprintf(x.buf, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case float32:
+			x.writeFloat(ref, float64(v))
+		case float64:
+			x.writeFloat(ref, v)
+		case XLSXLink:
+			fmt.Fprintf(x.buf, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xlsxStyleLink, xlsxText(v.Text))
+			if v.Location != "" {
+				x.current.hyperlinks = append(x.current.hyperlinks, fmt.Sprintf(`<hyperlink ref="%s" location="%s" display="%s"/>`, ref, xlsxEscape(v.Location), xlsxText(v.Text)))
+			}
+		case time.Time:
+			if v.IsZero() {
+				continue
+			}
+			// excel counts the days since 1899-12-30
+			days := float64(v.Unix())/86400 + 25569
+			fmt.Fprintf(x.buf, `<c r="%s" s="%d"><v>%s</v></c>`, ref, xlsxStyleDate, strconv.FormatFloat(days, 'f', -1, 64))
+		default:
+			fmt.Fprintf(x.buf, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xlsxText(formatValue(value)))
+		}
+	}
+	_, err := x.buf.WriteString(`</row>`)
+	return errors.Wrapf(err, "cannot write row %d of sheet '%s'", row, x.sheets[len(x.sheets)-1])
+}
+
+func (x *XLSXStream) writeFloat(ref string, f float64) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		fmt.Fprintf(x.buf, `<c r="%s" t="inlineStr"><is><t>%v</t></is></c>`, ref, f)
+		return
+	}
+	fmt.Fprintf(x.buf, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+func xlsxDefinedNames(names string) string {
+	if names == "" {
+		return ""
+	}
+	return `<definedNames>` + names + `</definedNames>`
+}
+
+// xlsxColumn returns the column letters of the zero based column index (A, B, ..., Z, AA, ...)
+func xlsxColumn(index int) string {
+	var column string
+	for index++; index > 0; index = (index - 1) / 26 {
+		column = string(rune('A'+(index-1)%26)) + column
+	}
+	return column
+}
+
+// xlsxSheetName returns a valid and unique sheet name with at most 31 characters
+func xlsxSheetName(name string, part int, existing []string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "Sheet"
+	}
+	for i := part; ; i++ {
+		var suffix string
+		if i > 1 {
+			suffix = fmt.Sprintf(" (%d)", i)
+		}
+		result := name
+		if utf8.RuneCountInString(result)+len(suffix) > 31 {
+			result = string([]rune(result)[:31-len(suffix)])
+		}
+		result += suffix
+		unique := true
+		for _, e := range existing {
+			if strings.EqualFold(e, result) {
+				unique = false
+				break
+			}
+		}
+		if unique {
+			return result
+		}
+	}
+}
+
+// xlsxText escapes the text of a cell and removes characters, which are not allowed in xml
+func xlsxText(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' || (r >= 0x20 && r != utf8.RuneError) {
+			return r
+		}
+		return -1
+	}, text)
+	if utf8.RuneCountInString(text) > xlsxMaxCellText {
+		text = string([]rune(text)[:xlsxMaxCellText])
+	}
+	return xlsxEscape(text)
+}
+
+func xlsxEscape(text string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(text))
+	return sb.String()
+}
+
+// xlsxStyles contains the default, header (centered with border), date and link style
+const xlsxStyles = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="3"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font>` +
+	`<font><u/><sz val="11"/><color rgb="FF0563C1"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill>` +
+	`<fill><patternFill patternType="solid"><fgColor rgb="FFD9D9D9"/><bgColor indexed="64"/></patternFill></fill></fills>` +
+	`<borders count="2"><border><left/><right/><top/><bottom/><diagonal/></border>` +
+	`<border><left style="thin"/><right style="thin"/><top style="thin"/><bottom style="thick"/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="2" borderId="1" xfId="0" applyFont="1" applyFill="1" applyBorder="1" applyAlignment="1"><alignment horizontal="center"/></xf>` +
+	`<xf numFmtId="22" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="0" fontId="2" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`